@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"html/template"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"github.com/devemio/v2raytun-routing/atomicfile"
+)
+
+// archiveItem is one route in a bulk export.
+type archiveItem struct {
+	Name  string
+	Link  string
+	Parts []qrPart // one part unless the link is too long for a QR code
+}
+
+// qrPart is a piece of a link and the QR code holding it. Parts of a
+// split link are joined in order to get the link back.
+type qrPart struct {
+	Label string // "1/3"; empty for a link that fits one code
+	Text  string
+	QR    string // file name inside the archive
+}
+
+// qrPartSize keeps each part well below the 2953 bytes a version 40
+// code holds at the lowest error correction, which scans poorly anyway.
+const qrPartSize = 1800
+
+// splitLink cuts link into equal parts of at most qrPartSize bytes.
+func splitLink(link string) []string {
+	n := (len(link) + qrPartSize - 1) / qrPartSize
+	if n <= 1 {
+		return []string{link}
+	}
+	size := (len(link) + n - 1) / n
+	parts := make([]string, 0, n)
+	for len(link) > size {
+		parts = append(parts, link[:size])
+		link = link[size:]
+	}
+	return append(parts, link)
+}
+
+// Href lets the custom app scheme through html/template, which only
+// trusts http(s) and mailto; links are generated here, not user input.
+func (it archiveItem) Href() template.URL {
+	return template.URL(it.Link)
+}
+
+var indexTmpl = template.Must(template.New("index").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>Routes</title>
+<style>body{font-family:sans-serif;max-width:48em;margin:2em auto}textarea{width:100%;height:6em}img{width:256px}</style>
+</head><body>
+<h1>Routes</h1>
+<p>Generated {{.Built}}. Scan a QR code or copy a link and import it in v2RayTun.</p>
+{{range .Items}}<h2>{{.Name}}</h2>
+{{if gt (len .Parts) 1}}<p>The link is too long for one QR code and is split into {{len .Parts}} parts: scan them in order and join the texts without spaces.</p>
+{{end}}{{range .Parts}}{{if .Label}}<h3>Part {{.Label}}</h3>
+{{end}}<p><img src="{{.QR}}" alt="QR code{{if .Label}} part {{.Label}}{{end}}"></p>
+{{end}}<p><a href="{{.Href}}">Import {{.Name}}</a></p>
+<textarea readonly>{{.Link}}</textarea>
+{{end}}</body></html>
+`))
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// writeArchive bundles every link as <name>.link and <name>.png plus an
+// index.html page, for handing a set of routes to a group. Oversized links
+// get numbered <name>-1of3.png/.link parts instead of a single code.
+func writeArchive(path string, items []archiveItem) error {
+	f, err := atomicfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for i := range items {
+		it := &items[i]
+		base := unsafeName.ReplaceAllString(it.Name, "_")
+
+		if err := writeZipFile(zw, base+".link", []byte(it.Link)); err != nil {
+			return err
+		}
+
+		texts := splitLink(it.Link)
+		for n, text := range texts {
+			part := qrPart{Text: text, QR: base + ".png"}
+			if len(texts) > 1 {
+				part.Label = fmt.Sprintf("%d/%d", n+1, len(texts))
+				name := fmt.Sprintf("%s-%dof%d", base, n+1, len(texts))
+				part.QR = name + ".png"
+				if err := writeZipFile(zw, name+".link", []byte(text)); err != nil {
+					return err
+				}
+			}
+
+			png, err := qrcode.Encode(text, qrcode.Low, 512)
+			if err != nil {
+				return fmt.Errorf("%s: QR code: %w", it.Name, err)
+			}
+			if err := writeZipFile(zw, part.QR, png); err != nil {
+				return err
+			}
+			it.Parts = append(it.Parts, part)
+		}
+		if len(texts) > 1 {
+			fmt.Fprintf(os.Stderr, "%s: link is %d bytes, split into %d QR codes\n", it.Name, len(it.Link), len(texts))
+		}
+	}
+
+	w, err := zw.Create("index.html")
+	if err != nil {
+		return err
+	}
+	err = indexTmpl.Execute(w, map[string]any{
+		"Built": time.Now().Format(time.DateTime),
+		"Items": items,
+	})
+	if err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+func writeZipFile(zw *zip.Writer, name string, b []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,79 @@
+// Package atomicfile writes files through a temp file in the same
+// directory and renames it into place, so readers never see partial output.
+package atomicfile
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+)
+
+type File struct {
+	*bufio.Writer
+	tmp  *os.File
+	path string
+	done bool
+}
+
+// Create starts writing path. Call Commit to publish it; Close without
+// Commit discards the temp file.
+func Create(path string) (*File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp uses 0600; published files should look like os.Create ones.
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &File{Writer: bufio.NewWriter(tmp), tmp: tmp, path: path}, nil
+}
+
+func (f *File) Commit() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	if err := f.Flush(); err != nil {
+		f.abort()
+		return err
+	}
+	if err := f.tmp.Close(); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	if err := os.Rename(f.tmp.Name(), f.path); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (f *File) Close() error {
+	if !f.done {
+		f.done = true
+		f.abort()
+	}
+	return nil
+}
+
+func (f *File) abort() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
+
+func WriteFile(path string, b []byte) error {
+	f, err := Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	return f.Commit()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/profile"
+)
+
+// build runs the full pipeline for profiles from the config and prints a
+// summary to stderr and the links to stdout.
+func build(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	configPath := fs.String("config", "profiles.yaml", "Path to the profiles config")
+	only := fs.String("profile", "", "Build only this profile")
+	jobs := fs.Int("jobs", 4, "Number of sources fetched concurrently")
+	outPath := fs.String("o", "", "Write the link(s) to this file (atomically) instead of stdout")
+	noHistory := fs.Bool("no-history", false, "Do not record the generated links in the history file")
+	archive := fs.String("archive", "", "Also write all links, QR codes and an index.html page into this zip file")
+	winners := fs.Bool("winners", false, "Print which rule and outbound every input domain hits in the generated route")
+	addLinkFlags(fs)
+	addInputFlags(fs)
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	_ = fs.Parse(args)
+	startProfile()
+	defer profile.Stop()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	var profiles []Profile
+	for _, p := range cfg.Profiles {
+		if *only == "" || p.Name == *only {
+			profiles = append(profiles, p)
+		}
+	}
+	if len(profiles) == 0 {
+		fail("no such profile: " + *only)
+	}
+
+	out := openOutput(*outPath)
+	var items []archiveItem
+	for _, p := range profiles {
+		p, variant := p.at(time.Now())
+		if variant != "" {
+			fmt.Fprintf(os.Stderr, "%s: variant %s\n", p.Name, variant)
+		}
+		res, err := buildProfile(p, *jobs)
+		if err != nil {
+			fail(p.Name + ": " + err.Error())
+		}
+		link, err := p.encodeLink(res.Route)
+		if err != nil {
+			fail(err.Error())
+		}
+
+		printBuildSummary(os.Stderr, p, res, len(link))
+		if *winners {
+			newSimulatorWith(res.Route, res.Matcher).printWinners(os.Stderr, res.Inputs)
+			fmt.Fprintln(os.Stderr)
+		}
+		if !*noHistory {
+			if err := recordHistory(link, "build "+p.Name, sourceHashes(res.Sources)); err != nil {
+				fmt.Fprintln(os.Stderr, "warning: history:", err)
+			}
+		}
+
+		items = append(items, archiveItem{Name: p.Name, Link: link})
+		if len(profiles) > 1 {
+			fmt.Fprintf(out, "%s\t%s\n", p.Name, link)
+		} else {
+			fmt.Fprint(out, link)
+		}
+	}
+	out.commit()
+
+	if *archive != "" {
+		if err := writeArchive(*archive, items); err != nil {
+			fail(err.Error())
+		}
+	}
+}
+
+func printBuildSummary(w io.Writer, p Profile, res *buildResult, size int) {
+	fmt.Fprintf(w, "== %s ==\n", p.Name)
+	printSourceStats(w, res.Stats)
+	if len(res.Excluded) > 0 {
+		fmt.Fprintf(w, "excluded: %s\n", strings.Join(res.Excluded, ", "))
+	}
+	for _, u := range res.Selected {
+		fmt.Fprintf(w, "%s: %s (size=%d) replaces %s\n", u.Rule, u.Selector, u.Size, strings.Join(u.Replaced, ", "))
+	}
+	for _, r := range res.Route.Rules {
+		fmt.Fprintf(w, "rule %s -> %s: %d entries\n", ruleLabel(r), r.OutboundTag, len(r.Domain)+len(r.IP))
+	}
+	fmt.Fprintf(w, "link: %d bytes\n\n", size)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// attrs lists the attributes of a tag with the number of rules carrying
+// each, the subsets an @attr selector can pick; without a tag, the usage
+// of every attribute in the file.
+func attrs(args []string) {
+	fs := flag.NewFlagSet("attrs", flag.ExitOnError)
+	geositePath := fs.String("geosite", "dlc.dat", "Path or URL to geosite.dat")
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	pos := parseArgs(fs, args)
+
+	if len(pos) > 1 {
+		fatal(errors.New("usage: geosite attrs [-geosite dlc.dat] [geosite:TAG]"))
+	}
+	list, err := decodeOpts.Load(context.Background(), *geositePath)
+	if err != nil {
+		fatal(err)
+	}
+	if len(pos) == 0 {
+		attrUsage(list)
+		return
+	}
+	tag, _ := geosite.ParseSelector("geosite:" + trimSelector(pos[0]))
+	site := geosite.Find(list, tag)
+	if site == nil {
+		fatal(fmt.Errorf("%s: no tag %q", *geositePath, tag))
+	}
+
+	counts := make(map[string]int)
+	plain := 0
+	for _, d := range site.Domain {
+		if len(d.Attribute) == 0 {
+			plain++
+		}
+		for _, a := range d.Attribute {
+			counts[a.Key]++
+		}
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ATTR\tRULES\tSELECTOR")
+	for _, k := range keys {
+		fmt.Fprintf(tw, "@%s\t%d\tgeosite:%s@%s\n", k, counts[k], tag, k)
+	}
+	fmt.Fprintf(tw, "(none)\t%d\t\n", plain)
+	fmt.Fprintf(tw, "total\t%d\tgeosite:%s\n", len(site.Domain), tag)
+	_ = tw.Flush()
+}
+
+// attrUsage prints every attribute key with the number of tags and rules
+// using it. A key one edit away from a more used one is likely a typo,
+// and a key on a single rule likely a leftover; both are noted.
+func attrUsage(list *router.GeoSiteList) {
+	type usage struct{ tags, rules int }
+	use := make(map[string]*usage)
+	for _, site := range list.Entry {
+		inTag := make(map[string]bool)
+		for _, d := range site.Domain {
+			for _, a := range d.Attribute {
+				u := use[a.Key]
+				if u == nil {
+					u = new(usage)
+					use[a.Key] = u
+				}
+				u.rules++
+				if !inTag[a.Key] {
+					inTag[a.Key] = true
+					u.tags++
+				}
+			}
+		}
+	}
+	keys := make([]string, 0, len(use))
+	for k := range use {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if use[keys[i]].rules != use[keys[j]].rules {
+			return use[keys[i]].rules > use[keys[j]].rules
+		}
+		return keys[i] < keys[j]
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ATTR\tTAGS\tRULES\tNOTE")
+	for i, k := range keys {
+		note := ""
+		for _, o := range keys[:i] {
+			if use[o].rules > use[k].rules && oneEditApart(k, o) {
+				note = "typo of @" + o + "?"
+				break
+			}
+		}
+		if note == "" && use[k].rules == 1 {
+			note = "single rule"
+		}
+		fmt.Fprintf(tw, "@%s\t%d\t%d\t%s\n", k, use[k].tags, use[k].rules, note)
+	}
+	_ = tw.Flush()
+}
+
+// oneEditApart reports whether a and b differ by one inserted, deleted
+// or replaced byte.
+func oneEditApart(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(b)-len(a) > 1 || a == b {
+		return false
+	}
+	i := 0
+	for i < len(a) && a[i] == b[i] {
+		i++
+	}
+	if len(a) == len(b) {
+		return a[i+1:] == b[i+1:]
+	}
+	return a[i:] == b[i+1:]
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// exitAuditIssues is returned by regex and keyword when some rule is
+// over-broad, never matches or does not compile.
+const exitAuditIssues = 2
+
+// ruleAudit runs the regexp or keyword rules of some tags over a corpus
+// of popular hosts. A rule matching hosts of many registrable domains
+// the tag does not list otherwise is likely broader than meant, the
+// usual reason a random site goes through the proxy; one matching
+// nothing is dead or too narrow.
+func ruleAudit(name string, kind router.Domain_Type, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	geositePath := fs.String("geosite", "dlc.dat", "Path or URL to geosite.dat")
+	corpusPath := fs.String("corpus", "", "Path, glob, directory or URL of files with sample hosts (one per line), - for stdin")
+	var tags listFlag
+	fs.Var(&tags, "tags", "Tags to audit (comma-separated, repeatable; default all)")
+	maxDomains := fs.Int("max", 5, "Report rules matching hosts of more than this many unrelated registrable domains")
+	all := fs.Bool("all", false, "Also list rules without issues")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	hosts := parseArgs(fs, args)
+
+	if *corpusPath != "" {
+		d, err := readDomains(*corpusPath)
+		if err != nil {
+			fatal(err)
+		}
+		hosts = append(hosts, d...)
+	}
+	if len(hosts) == 0 {
+		fatal(fmt.Errorf("usage: geosite %s [-geosite dlc.dat] [-tags google,...] [-max 5] -corpus top.txt | host...", name))
+	}
+	list, err := decodeOpts.Load(context.Background(), *geositePath)
+	if err != nil {
+		fatal(err)
+	}
+
+	var sites []*router.GeoSite
+	if len(tags) == 0 {
+		sites = list.Entry
+	}
+	for _, t := range tags {
+		site := geosite.Find(list, trimSelector(t))
+		if site == nil {
+			fatal(fmt.Errorf("%s: no tag %q", *geositePath, t))
+		}
+		sites = append(sites, site)
+	}
+
+	corpus := make([]string, 0, len(hosts))
+	seen := make(map[string]bool)
+	for _, raw := range hosts {
+		h, err := domain.Normalize(raw)
+		if err != nil || seen[h] {
+			continue
+		}
+		seen[h] = true
+		corpus = append(corpus, h)
+	}
+
+	issues, rules := 0, 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	label := "keyword"
+	if kind == router.Domain_Regex {
+		label = "regexp"
+	}
+	fmt.Fprintf(tw, "TAG\t%s\tHOSTS\tUNRELATED\tSTATUS\tEXAMPLES\n", strings.ToUpper(label))
+	for _, site := range sites {
+		tag := strings.ToLower(site.CountryCode)
+		roots := make(map[string]bool)
+		for _, d := range site.Domain {
+			if d.Type == router.Domain_RootDomain || d.Type == router.Domain_Full {
+				roots[registrable(strings.ToLower(d.Value))] = true
+			}
+		}
+		for _, d := range site.Domain {
+			if d.Type != kind {
+				continue
+			}
+			rules++
+			a := auditRule(d.Value, kind, corpus, roots, *maxDomains)
+			if a.status != "ok" {
+				issues++
+			} else if !*all {
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", tag, d.Value, a.matched, a.unrelated, a.status, strings.Join(a.examples, ", "))
+		}
+	}
+	_ = tw.Flush()
+
+	fmt.Printf("\n%d of %d %s rules have issues, checked against %d hosts\n", issues, rules, label, len(corpus))
+	if issues > 0 {
+		profile.Stop()
+		os.Exit(exitAuditIssues)
+	}
+}
+
+type ruleAuditResult struct {
+	status             string
+	matched, unrelated int
+	examples           []string // hosts of distinct unrelated domains
+}
+
+// auditRule matches one rule against the corpus. A host is related if
+// its registrable domain is in roots, the domains the tag lists.
+func auditRule(value string, kind router.Domain_Type, corpus []string, roots map[string]bool, maxDomains int) ruleAuditResult {
+	match := func(h string) bool { return strings.Contains(h, value) }
+	if kind == router.Domain_Regex {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return ruleAuditResult{status: "invalid: " + err.Error()}
+		}
+		match = re.MatchString
+	}
+
+	var a ruleAuditResult
+	regs := make(map[string]bool)
+	for _, h := range corpus {
+		if !match(h) {
+			continue
+		}
+		a.matched++
+		if r := registrable(h); !roots[r] && !regs[r] {
+			regs[r] = true
+			if len(a.examples) < 3 {
+				a.examples = append(a.examples, h)
+			}
+		}
+	}
+	a.unrelated = len(regs)
+	switch {
+	case a.matched == 0:
+		a.status = "never matches"
+	case a.unrelated > maxDomains:
+		a.status = "over-broad"
+	default:
+		a.status = "ok"
+	}
+	return a
+}
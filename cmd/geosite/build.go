@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/devemio/v2raytun-routing/atomicfile"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
+)
+
+// build compiles a domain-list-community style data directory, e.g. a
+// private one, into a .dat file.
+func build(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	dataDir := fs.String("data", "data", "Directory with one list file per tag")
+	outPath := fs.String("o", "", "Output .dat file")
+	check := fs.Bool("check-reproducible", false, "Build twice and fail unless the bytes are identical; prints the SHA-256")
+	profile.AddFlags(fs)
+	_ = parseArgs(fs, args)
+
+	if *outPath == "" {
+		fatal(errors.New("usage: geosite build -data data/ -o private.dat"))
+	}
+	list, err := geosite.BuildDir(*dataDir)
+	if err != nil {
+		fatal(err)
+	}
+	b, err := geosite.Marshal(list)
+	if err != nil {
+		fatal(err)
+	}
+	if *check {
+		again, err := geosite.BuildDir(*dataDir)
+		if err != nil {
+			fatal(err)
+		}
+		b2, err := geosite.Marshal(again)
+		if err != nil {
+			fatal(err)
+		}
+		if !bytes.Equal(b, b2) {
+			fatal(errors.New("build is not reproducible: two builds differ"))
+		}
+		fmt.Printf("sha256:%x\n", sha256.Sum256(b))
+	}
+	if err := atomicfile.WriteFile(*outPath, b); err != nil {
+		fatal(err)
+	}
+
+	rules := 0
+	for _, site := range list.Entry {
+		rules += len(site.Domain)
+	}
+	fmt.Fprintf(os.Stderr, "%d tags, %d rules\n", len(list.Entry), rules)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
+)
+
+// exitUncovered is returned by contains when some domain is not covered,
+// so scripts can use it as the yes/no answer.
+const exitUncovered = 2
+
+// contains tells whether a selector covers every domain of a list, the
+// question to answer before replacing the list with the selector.
+func contains(args []string) {
+	fs := flag.NewFlagSet("contains", flag.ExitOnError)
+	geositePath := fs.String("geosite", "dlc.dat", "Path or URL to geosite.dat")
+	domainsPath := fs.String("domains", "", "Path or URL to file with domains (one per line), - for stdin")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	pos := parseArgs(fs, args)
+
+	if len(pos) < 1 || (*domainsPath == "" && len(pos) < 2) {
+		fatal(errors.New("usage: geosite contains geosite:TAG[@attr] -domains my.txt | host..."))
+	}
+	selector := "geosite:" + trimSelector(pos[0])
+
+	m, err := loadMatcher(*geositePath)
+	if err != nil {
+		fatal(err)
+	}
+	list := m.List()
+	tag, _ := geosite.ParseSelector(selector)
+	if geosite.Find(list, tag) == nil {
+		fatal(fmt.Errorf("%s: no tag %q", *geositePath, tag))
+	}
+
+	hosts := pos[1:]
+	if *domainsPath != "" {
+		d, err := readDomains(*domainsPath)
+		if err != nil {
+			fatal(err)
+		}
+		hosts = append(hosts, d...)
+	}
+
+	covered, total, invalid := 0, 0, 0
+	seen := make(map[string]bool)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, raw := range hosts {
+		host, err := domain.Normalize(raw)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\tinvalid: %v\n", raw, err)
+			invalid++
+			continue
+		}
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+		total++
+		answer := "no"
+		if m.Covers(selector, host) {
+			answer = "yes"
+			covered++
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", host, answer)
+	}
+	_ = tw.Flush()
+
+	pct := 0.0
+	if total > 0 {
+		pct = 100 * float64(covered) / float64(total)
+	}
+	fmt.Printf("\n%s covers %d of %d domains (%.1f%%)\n", selector, covered, total, pct)
+	if covered < total || invalid > 0 {
+		profile.Stop()
+		os.Exit(exitUncovered)
+	}
+}
+
+// readDomains reads the lines of a list, or of all lists a glob or
+// directory stands for.
+func readDomains(path string) ([]string, error) {
+	files, err := fetch.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, f := range files {
+		b, err := fetch.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = strings.TrimSpace(line[:i])
+			}
+			if line != "" {
+				out = append(out, line)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
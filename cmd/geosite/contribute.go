@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"golang.org/x/net/publicsuffix"
+)
+
+// contribute turns domains no tag covers into domain-list-community
+// entries, grouped by the data file they probably belong to, ready to
+// paste into an upstream pull request.
+func contribute(args []string) {
+	fs := flag.NewFlagSet("contribute", flag.ExitOnError)
+	geositePath := fs.String("geosite", "dlc.dat", "Path or URL to geosite.dat")
+	domainsPath := fs.String("domains", "", "Path or URL to file with domains (one per line), - for stdin")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	hosts := parseArgs(fs, args)
+
+	if *domainsPath != "" {
+		d, err := readDomains(*domainsPath)
+		if err != nil {
+			fatal(err)
+		}
+		hosts = append(hosts, d...)
+	}
+	if len(hosts) == 0 {
+		fatal(errors.New("usage: geosite contribute [-geosite dlc.dat] -domains my.txt | host..."))
+	}
+
+	m, err := loadMatcher(*geositePath)
+	if err != nil {
+		fatal(err)
+	}
+	list := m.List()
+
+	var order []string
+	files := make(map[string]*suggestion)
+	seen := make(map[string]bool)
+	for _, raw := range hosts {
+		host, err := domain.Normalize(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: skipping %q: %v\n", raw, err)
+			continue
+		}
+		if len(m.Match(host)) > 0 {
+			continue
+		}
+		entry := registrable(host)
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+
+		file, why := suggestFile(list, entry)
+		s := files[file]
+		if s == nil {
+			s = &suggestion{why: why}
+			files[file] = s
+			order = append(order, file)
+		}
+		s.entries = append(s.entries, entry)
+	}
+
+	if len(order) == 0 {
+		fmt.Fprintln(os.Stderr, "every domain is covered by some tag")
+		return
+	}
+	writeSuggestions(os.Stdout, order, files)
+}
+
+type suggestion struct {
+	why     string
+	entries []string
+}
+
+func writeSuggestions(w io.Writer, order []string, files map[string]*suggestion) {
+	for i, file := range order {
+		s := files[file]
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "# data/%s (%s)\n", file, s.why)
+		slices.Sort(s.entries)
+		for _, e := range s.entries {
+			fmt.Fprintln(w, e)
+		}
+	}
+}
+
+// registrable is what upstream lists: the domain one level below the
+// public suffix, which covers the subdomains.
+func registrable(host string) string {
+	if d, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return d
+	}
+	return host
+}
+
+// suggestFile guesses the data file, named like the tag in lower case:
+// a tag already listing a sibling domain with the same name, then a
+// tag named like the domain, then a new file named after it.
+func suggestFile(list *router.GeoSiteList, entry string) (string, string) {
+	name, _, _ := strings.Cut(entry, ".")
+
+	for _, site := range list.GetEntry() {
+		if strings.HasPrefix(strings.ToLower(site.GetCountryCode()), "category-") {
+			continue
+		}
+		for _, d := range site.GetDomain() {
+			if int32(d.GetType()) != 2 {
+				continue
+			}
+			v := strings.ToLower(d.GetValue())
+			if sib, _, _ := strings.Cut(registrable(v), "."); sib == name {
+				return strings.ToLower(site.GetCountryCode()), v + " is already there"
+			}
+		}
+	}
+	if site := geosite.Find(list, name); site != nil {
+		return strings.ToLower(site.GetCountryCode()), "tag named like the domain"
+	}
+	return name, "new file"
+}
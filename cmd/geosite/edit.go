@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/geosite"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// edit implements add, remove and retag: small fixes to a .dat without
+// the full source tree. Rules use domain-list-community syntax and keep
+// their attributes; the file is rewritten in place unless -o is given.
+func edit(cmd string, args []string) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	tag := fs.String("tag", "", "Tag to edit")
+	to := fs.String("to", "", "retag: tag that receives the rules, created if missing")
+	outPath := fs.String("o", "", "Output .dat file (default: rewrite the input)")
+	pos := parseArgs(fs, args)
+
+	if len(pos) < 1 || *tag == "" || (cmd == "retag" && *to == "") || (cmd != "retag" && len(pos) < 2) {
+		fatal(fmt.Errorf("usage: geosite %s dlc.dat -tag TAG %s", cmd, map[string]string{
+			"add":    "rule...",
+			"remove": "rule...",
+			"retag":  "-to NEW [rule...]  (all rules if none given)",
+		}[cmd]))
+	}
+	path := pos[0]
+	if *outPath == "" {
+		*outPath = path
+	}
+
+	list, err := geosite.Load(path)
+	if err != nil {
+		fatal(err)
+	}
+	var rules []*router.Domain
+	for _, s := range pos[1:] {
+		d, err := geosite.ParseRule(s)
+		if err != nil {
+			fatal(err)
+		}
+		rules = append(rules, d)
+	}
+
+	site := geosite.Find(list, trimSelector(*tag))
+	if site == nil && cmd != "add" {
+		fatal(fmt.Errorf("%s: no tag %q", path, *tag))
+	}
+
+	var n int
+	switch cmd {
+	case "add":
+		if site == nil {
+			site = &router.GeoSite{CountryCode: strings.ToUpper(trimSelector(*tag))}
+			list.Entry = append(list.Entry, site)
+		}
+		n = addRules(site, rules)
+	case "remove":
+		_, n = takeRules(site, rules)
+	case "retag":
+		dst := geosite.Find(list, trimSelector(*to))
+		if dst == nil {
+			dst = &router.GeoSite{CountryCode: strings.ToUpper(trimSelector(*to))}
+			list.Entry = append(list.Entry, dst)
+		}
+		if dst == site {
+			fatal(errors.New("-to is the same tag"))
+		}
+		moved, _ := takeRules(site, rules)
+		n = addRules(dst, moved)
+	}
+
+	if err := geosite.Save(*outPath, list); err != nil {
+		fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d rules\n", cmd, n)
+}
+
+// addRules appends rules the site lacks; a rule already present gets the
+// attributes it is missing.
+func addRules(site *router.GeoSite, rules []*router.Domain) int {
+	n := 0
+	for _, r := range rules {
+		i := indexRule(site, r)
+		if i < 0 {
+			site.Domain = append(site.Domain, r)
+			n++
+			continue
+		}
+		have := site.Domain[i]
+		for _, a := range r.GetAttribute() {
+			if !hasAttr(have, a.GetKey()) {
+				have.Attribute = append(have.Attribute, a)
+			}
+		}
+	}
+	return n
+}
+
+// takeRules removes rules from site, or all of them when rules is empty,
+// and returns the removed ones with their attributes.
+func takeRules(site *router.GeoSite, rules []*router.Domain) ([]*router.Domain, int) {
+	var taken, kept []*router.Domain
+	for _, d := range site.GetDomain() {
+		match := len(rules) == 0
+		for _, r := range rules {
+			if geosite.SameRule(d, r) {
+				match = true
+				break
+			}
+		}
+		if match {
+			taken = append(taken, d)
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	for _, r := range rules {
+		if !containsRule(taken, r) {
+			fmt.Fprintf(os.Stderr, "warning: %s not in %s\n", geosite.FormatRule(r), site.GetCountryCode())
+		}
+	}
+	site.Domain = kept
+	return taken, len(taken)
+}
+
+func indexRule(site *router.GeoSite, r *router.Domain) int {
+	for i, d := range site.GetDomain() {
+		if geosite.SameRule(d, r) {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsRule(rules []*router.Domain, r *router.Domain) bool {
+	for _, d := range rules {
+		if geosite.SameRule(d, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttr(d *router.Domain, key string) bool {
+	for _, a := range d.GetAttribute() {
+		if strings.EqualFold(a.GetKey(), key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/profile"
+)
+
+// releaseURL is where domain-list-community publishes its builds.
+const releaseURL = "https://github.com/v2fly/domain-list-community/releases/download/%s/dlc.dat"
+
+// history shows when a domain entered or left tags over a range of
+// releases, given oldest first. Downloads go through the fetch cache, so
+// repeated runs only fetch new releases.
+func history(args []string) {
+	var releases listFlag
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	host := fs.String("domain", "", "Domain to track")
+	tag := fs.String("tag", "", "Only show this tag, e.g. category-ru")
+	fs.Var(&releases, "releases", "Release names to download, oldest first, e.g. 20240101000000 (comma-separated, repeatable)")
+	urlTmpl := fs.String("url", releaseURL, "URL template for -releases, %s is the release name")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	paths := parseArgs(fs, args)
+
+	for _, r := range releases {
+		paths = append(paths, fmt.Sprintf(*urlTmpl, r))
+	}
+	if *host == "" || len(paths) == 0 {
+		fatal(errors.New("usage: geosite history -domain example.com [-tag TAG] old.dat new.dat... | -releases R1,R2,..."))
+	}
+	h, err := domain.Normalize(*host)
+	if err != nil {
+		fatal(err)
+	}
+	want := strings.ToUpper(trimSelector(*tag))
+
+	var prev selectorSet
+	for i, path := range paths {
+		m, err := loadMatcher(path)
+		if err != nil {
+			fatal(err)
+		}
+		cur := selectors(m, h)
+		if want != "" {
+			cur = filterTag(cur, want)
+		}
+
+		name := path
+		if j := i - (len(paths) - len(releases)); j >= 0 {
+			name = releases[j]
+		}
+
+		var changes []string
+		for _, s := range cur.order {
+			if !prev.set[s] {
+				changes = append(changes, "+"+s)
+			}
+		}
+		for _, s := range prev.order {
+			if !cur.set[s] {
+				changes = append(changes, "-"+s)
+			}
+		}
+		switch {
+		case i == 0 && len(cur.order) == 0:
+			fmt.Printf("%s: in no tag\n", name)
+		case i == 0:
+			fmt.Printf("%s: %s\n", name, strings.Join(cur.order, " "))
+		case len(changes) > 0:
+			fmt.Printf("%s: %s\n", name, strings.Join(changes, " "))
+		}
+		prev = cur
+	}
+}
+
+// filterTag keeps the selectors of one tag, with or without attributes.
+func filterTag(s selectorSet, tag string) selectorSet {
+	out := selectorSet{set: make(map[string]bool)}
+	for _, sel := range s.order {
+		t, _, _ := strings.Cut(strings.TrimPrefix(sel, "geosite:"), "@")
+		if t == tag {
+			out.order = append(out.order, sel)
+			out.set[sel] = true
+		}
+	}
+	return out
+}
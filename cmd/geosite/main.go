@@ -0,0 +1,102 @@
+// Command geosite inspects and rewrites geosite.dat files.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/profile"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+const usage = `usage: geosite <command> [flags] [args]
+
+commands:
+  build       compile a data directory into a .dat file
+  slim        keep only some tags of a .dat file
+  merge       combine several .dat files into one
+  add         add rules to a tag
+  remove      remove rules from a tag
+  retag       move rules to another tag
+  contains    check that a selector covers a domain list
+  attrs       list the attributes of a tag, or their usage in the file
+  top         rank tags by rule or domain count
+  regex       audit regexp rules against a corpus of hosts
+  keyword     audit keyword rules against a corpus of hosts
+  contribute  format uncovered domains for domain-list-community
+  regress     show selector changes per domain between two builds
+  history     show when a domain entered or left tags over releases`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+	args := os.Args[2:]
+	defer profile.Stop()
+	switch os.Args[1] {
+	case "build":
+		build(args)
+	case "slim":
+		slim(args)
+	case "merge":
+		merge(args)
+	case "contains":
+		contains(args)
+	case "attrs":
+		attrs(args)
+	case "top":
+		top(args)
+	case "regex":
+		ruleAudit("regex", router.Domain_Regex, args)
+	case "keyword":
+		ruleAudit("keyword", router.Domain_Plain, args)
+	case "contribute":
+		contribute(args)
+	case "regress":
+		regress(args)
+	case "history":
+		history(args)
+	case "add", "remove", "retag":
+		edit(os.Args[1], args)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+func fatal(err error) {
+	profile.Stop()
+	fmt.Fprintln(os.Stderr, "ERROR:", err)
+	os.Exit(1)
+}
+
+// parseArgs lets flags follow positional arguments, as in
+// "geosite slim dlc.dat -tags ru -o slim.dat", and starts the profiles of
+// commands that have profile flags.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var pos []string
+	for {
+		_ = fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			if err := profile.Start(); err != nil {
+				fatal(err)
+			}
+			return pos
+		}
+		if args[0] == "--" {
+			args, pos = nil, append(pos, args[1:]...)
+			continue
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+// trimSelector accepts "geosite:google" as well as "google".
+func trimSelector(s string) string {
+	return strings.TrimPrefix(strings.TrimSpace(s), "geosite:")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// merge combines the tags of several .dat files, e.g. the official build
+// and a private one. Tags keep the order in which they first appear.
+func merge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	outPath := fs.String("o", "", "Output .dat file")
+	policy := fs.String("on-conflict", "union", "When a tag is in several files: union (all rules), first or last (file wins), or error")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	pos := parseArgs(fs, args)
+
+	if len(pos) < 2 || *outPath == "" {
+		fatal(errors.New("usage: geosite merge [-on-conflict union|first|last|error] -o out.dat a.dat b.dat..."))
+	}
+	switch *policy {
+	case "union", "first", "last", "error":
+	default:
+		fatal(fmt.Errorf("unknown -on-conflict %q (want union, first, last or error)", *policy))
+	}
+
+	out := new(router.GeoSiteList)
+	index := make(map[string]int) // upper-case tag -> out.Entry index
+	from := make(map[string]string)
+	conflicts := 0
+	for _, path := range pos {
+		list, err := decodeOpts.Load(context.Background(), path)
+		if err != nil {
+			fatal(err)
+		}
+		for _, site := range list.GetEntry() {
+			tag := strings.ToUpper(site.GetCountryCode())
+			i, ok := index[tag]
+			if !ok {
+				index[tag] = len(out.Entry)
+				from[tag] = path
+				out.Entry = append(out.Entry, site)
+				continue
+			}
+
+			conflicts++
+			switch *policy {
+			case "error":
+				fatal(fmt.Errorf("tag %s is in both %s and %s", tag, from[tag], path))
+			case "last":
+				out.Entry[i] = site
+				from[tag] = path
+			case "union":
+				out.Entry[i] = unionSite(out.Entry[i], site)
+			}
+		}
+	}
+
+	if err := geosite.Save(*outPath, out); err != nil {
+		fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "%d tags from %d files, %d conflicts (%s)\n", len(out.Entry), len(pos), conflicts, *policy)
+}
+
+// unionSite has the rules of a followed by those of b it lacks.
+func unionSite(a, b *router.GeoSite) *router.GeoSite {
+	out := &router.GeoSite{CountryCode: a.GetCountryCode()}
+	seen := make(map[string]bool)
+	for _, d := range append(append([]*router.Domain(nil), a.GetDomain()...), b.GetDomain()...) {
+		k := ruleKey(d)
+		if !seen[k] {
+			seen[k] = true
+			out.Domain = append(out.Domain, d)
+		}
+	}
+	return out
+}
+
+// ruleKey identifies a rule by type, value and attributes.
+func ruleKey(d *router.Domain) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d:%s", int32(d.GetType()), strings.ToLower(d.GetValue()))
+	for _, a := range d.GetAttribute() {
+		b.WriteString("@" + strings.ToLower(a.GetKey()))
+	}
+	return b.String()
+}
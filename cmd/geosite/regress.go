@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
+)
+
+// exitRegressed is returned by regress when some domain changed.
+const exitRegressed = 2
+
+// regress compares which selectors cover each domain in two builds, so
+// upgrading the data file never silently changes routing.
+func regress(args []string) {
+	fs := flag.NewFlagSet("regress", flag.ExitOnError)
+	oldPath := fs.String("old", "", "Path or URL to the current geosite.dat")
+	newPath := fs.String("new", "", "Path or URL to the candidate geosite.dat")
+	domainsPath := fs.String("domains", "", "Path or URL to file with domains (one per line), - for stdin")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	hosts := parseArgs(fs, args)
+
+	if *domainsPath != "" {
+		d, err := readDomains(*domainsPath)
+		if err != nil {
+			fatal(err)
+		}
+		hosts = append(hosts, d...)
+	}
+	if *oldPath == "" || *newPath == "" || len(hosts) == 0 {
+		fatal(errors.New("usage: geosite regress -old v1.dat -new v2.dat -domains mine.txt | host..."))
+	}
+
+	oldM, err := loadMatcher(*oldPath)
+	if err != nil {
+		fatal(err)
+	}
+	newM, err := loadMatcher(*newPath)
+	if err != nil {
+		fatal(err)
+	}
+
+	changed, total := 0, 0
+	seen := make(map[string]bool)
+	for _, raw := range hosts {
+		host, err := domain.Normalize(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: skipping %q: %v\n", raw, err)
+			continue
+		}
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+		total++
+
+		before, after := selectors(oldM, host), selectors(newM, host)
+		var lines []string
+		for _, s := range before.order {
+			if !after.set[s] {
+				lines = append(lines, "  - "+s)
+			}
+		}
+		for _, s := range after.order {
+			if !before.set[s] {
+				lines = append(lines, "  + "+s)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		changed++
+		fmt.Println(host)
+		fmt.Println(strings.Join(lines, "\n"))
+	}
+
+	fmt.Printf("\n%d of %d domains changed\n", changed, total)
+	if changed > 0 {
+		profile.Stop()
+		os.Exit(exitRegressed)
+	}
+}
+
+func loadMatcher(path string) (*geosite.Matcher, error) {
+	list, err := decodeOpts.Load(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	m := geosite.NewMatcher(list)
+	for _, e := range m.RegexErrors() {
+		fmt.Fprintln(os.Stderr, "warning:", e)
+	}
+	return m, nil
+}
+
+type selectorSet struct {
+	order []string
+	set   map[string]bool
+}
+
+// selectors lists the selectors covering host, with tags upper-cased
+// since their case differs between builds.
+func selectors(m *geosite.Matcher, host string) selectorSet {
+	out := selectorSet{set: make(map[string]bool)}
+	for _, match := range m.Match(host) {
+		s := "geosite:" + strings.ToUpper(match.Tag)
+		if match.Attr != "" {
+			s += "@" + strings.ToLower(match.Attr)
+		}
+		if !out.set[s] {
+			out.set[s] = true
+			out.order = append(out.order, s)
+		}
+	}
+	return out
+}
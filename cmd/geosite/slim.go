@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+// slim writes a .dat with only the requested tags, which loads much
+// faster on mobile clients that accept custom files. tag@attr keeps only
+// the rules with the attribute.
+func slim(args []string) {
+	var tags listFlag
+	fs := flag.NewFlagSet("slim", flag.ExitOnError)
+	fs.Var(&tags, "tags", "Tags to keep, e.g. category-ru,google@cn (comma-separated, repeatable)")
+	outPath := fs.String("o", "", "Output .dat file")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	pos := parseArgs(fs, args)
+
+	if len(pos) != 1 || len(tags) == 0 || *outPath == "" {
+		fatal(errors.New("usage: geosite slim dlc.dat -tags ru,google -o slim.dat"))
+	}
+
+	list, err := decodeOpts.Load(context.Background(), pos[0])
+	if err != nil {
+		fatal(err)
+	}
+
+	// A tag listed both whole and with attributes is kept whole.
+	var order []*router.GeoSite
+	attrs := make(map[*router.GeoSite][][]string)
+	for _, t := range tags {
+		tag, attr := geosite.SplitSelector(trimSelector(t))
+		site := geosite.Find(list, tag)
+		if site == nil {
+			fatal(fmt.Errorf("%s: no tag %q", pos[0], tag))
+		}
+		prev, seen := attrs[site]
+		if !seen {
+			order = append(order, site)
+		}
+		switch {
+		case len(attr) == 0 || (seen && prev == nil):
+			attrs[site] = nil
+		default:
+			attrs[site] = append(prev, attr)
+		}
+	}
+
+	out := new(router.GeoSiteList)
+	for _, site := range order {
+		if a := attrs[site]; a != nil {
+			site = withAttrs(site, a)
+		}
+		out.Entry = append(out.Entry, site)
+	}
+
+	if err := geosite.Save(*outPath, out); err != nil {
+		fatal(err)
+	}
+	before, after := proto.Size(list), proto.Size(out)
+	fmt.Fprintf(os.Stderr, "%d of %d tags, %d -> %d bytes\n", len(out.Entry), len(list.Entry), before, after)
+}
+
+// withAttrs copies site with only the rules one of the attribute
+// selectors takes, each needing all of its attributes.
+func withAttrs(site *router.GeoSite, attrs [][]string) *router.GeoSite {
+	out := &router.GeoSite{CountryCode: site.GetCountryCode()}
+	for _, d := range site.GetDomain() {
+		if slices.ContainsFunc(attrs, func(want []string) bool { return geosite.HasAttrs(d, want) }) {
+			out.Domain = append(out.Domain, d)
+		}
+	}
+	return out
+}
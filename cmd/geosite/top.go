@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/devemio/v2raytun-routing/profile"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// top ranks tags by size, to judge what a selector costs a mobile
+// client: every rule is loaded, keyword and regexp rules are checked
+// one by one.
+func top(args []string) {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	geositePath := fs.String("geosite", "dlc.dat", "Path or URL to geosite.dat")
+	n := fs.Int("n", 20, "Number of tags to show (0 = all)")
+	by := fs.String("by", "rules", "Rank by rules or domains (effective domain count)")
+	reverse := fs.Bool("reverse", false, "Show the smallest tags first")
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	pos := parseArgs(fs, args)
+
+	if len(pos) > 0 {
+		fatal(errors.New("usage: geosite top [-geosite dlc.dat] [-n 20] [-by rules|domains] [-reverse]"))
+	}
+	if *by != "rules" && *by != "domains" {
+		fatal(fmt.Errorf("unknown -by %q (want rules or domains)", *by))
+	}
+	list, err := decodeOpts.Load(context.Background(), *geositePath)
+	if err != nil {
+		fatal(err)
+	}
+
+	sizes := make([]tagSize, 0, len(list.Entry))
+	for _, site := range list.Entry {
+		sizes = append(sizes, measureTag(site))
+	}
+	key := func(s tagSize) int {
+		if *by == "domains" {
+			return s.domains
+		}
+		return s.rules
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		if ki, kj := key(sizes[i]), key(sizes[j]); ki != kj {
+			return (ki > kj) != *reverse
+		}
+		return sizes[i].tag < sizes[j].tag
+	})
+	if *n > 0 && len(sizes) > *n {
+		sizes = sizes[:*n]
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TAG\tRULES\tDOMAINS\tKEYWORD\tREGEXP")
+	for _, s := range sizes {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", s.tag, s.rules, s.domains, s.keyword, s.regexp)
+	}
+	_ = tw.Flush()
+}
+
+// tagSize counts the rules of a tag. domains is the number of domain
+// and full rules not already covered by a domain rule of the same tag,
+// the names the tag really adds.
+type tagSize struct {
+	tag                             string
+	rules, domains, keyword, regexp int
+}
+
+func measureTag(site *router.GeoSite) tagSize {
+	s := tagSize{tag: strings.ToLower(site.CountryCode), rules: len(site.Domain)}
+	roots := make(map[string]bool)
+	for _, d := range site.Domain {
+		if d.Type == router.Domain_RootDomain {
+			roots[strings.ToLower(d.Value)] = true
+		}
+	}
+	seen := make(map[string]bool)
+	for _, d := range site.Domain {
+		v := strings.ToLower(d.Value)
+		switch d.Type {
+		case router.Domain_Plain:
+			s.keyword++
+		case router.Domain_Regex:
+			s.regexp++
+		case router.Domain_RootDomain, router.Domain_Full:
+			if seen[v] || coveredByRoot(v, d.Type == router.Domain_Full, roots) {
+				continue
+			}
+			seen[v] = true
+			s.domains++
+		}
+	}
+	return s
+}
+
+// coveredByRoot reports whether a domain rule of a parent of host, or
+// of host itself for a full rule, is in roots.
+func coveredByRoot(host string, full bool, roots map[string]bool) bool {
+	if full && roots[host] {
+		return true
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if roots[host] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/profile"
+)
+
+// capture previews a set of selectors over the input list: the domains
+// each one would take, those taken by more than one, which then go to
+// whichever rule comes first, and those none of them takes.
+func capture(args []string) {
+	var geositePaths, selectors listFlag
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	fs.Var(&geositePaths, "geosite", "Path or URL to geosite.dat, default dlc.dat; repeat to use several files (private:banking)")
+	fs.Var(&selectors, "select", "Selectors to preview, e.g. geosite:ru,geosite:google@cn (comma-separated, repeatable)")
+	domainsPath := fs.String("domains", "domains.txt", "Path, glob, directory or URL of files with domains/urls (one per line), - for stdin; ignored if hosts are given as arguments")
+	outPath := fs.String("o", "", "Write output to this file (atomically) instead of stdout")
+	format := fs.String("format", "text", "Output format: text or jsonl (one JSON object per domain)")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	_ = fs.Parse(args)
+	if err := profile.Start(); err != nil {
+		fatal(err)
+	}
+	defer profile.Stop()
+	if len(selectors) == 0 {
+		fatal(errors.New("usage: v2fly capture -select geosite:TAG[,geosite:TAG...] [-domains domains.txt] [host...]"))
+	}
+	if *format != "text" && *format != "jsonl" {
+		fatal(fmt.Errorf("unknown -format %q (want text or jsonl)", *format))
+	}
+	if len(geositePaths) == 0 {
+		geositePaths = listFlag{"dlc.dat"}
+	}
+	files, err := loadFiles(geositePaths)
+	if err != nil {
+		fatal(err)
+	}
+
+	type target struct {
+		name, sel string
+		file      geositeFile
+	}
+	targets := make([]target, len(selectors))
+	for i, s := range selectors {
+		f, sel, err := selectorFile(files, s)
+		if err != nil {
+			fatal(err)
+		}
+		name := strings.ToLower(s)
+		if !strings.Contains(name, ":") {
+			name = "geosite:" + name
+		}
+		targets[i] = target{name: name, sel: sel, file: f}
+	}
+
+	var res captureResult
+	res.captured = make(map[string][]string)
+	seen := make(map[string]bool)
+	err = eachDomain(fs.Args(), *domainsPath, func() {}, func(raw string) {
+		host, err := domain.Normalize(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: skipping %q: %v\n", raw, err)
+			return
+		}
+		if seen[host] {
+			return
+		}
+		seen[host] = true
+		row := captureRow{Domain: host, Selectors: []string{}}
+		for _, t := range targets {
+			if t.file.matcher.Covers(t.sel, host) {
+				row.Selectors = append(row.Selectors, t.name)
+				res.captured[t.name] = append(res.captured[t.name], host)
+			}
+		}
+		res.rows = append(res.rows, row)
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	w, commit := openOutput(*outPath)
+	if *format == "jsonl" {
+		enc := json.NewEncoder(w)
+		for _, r := range res.rows {
+			_ = enc.Encode(r)
+		}
+	} else {
+		names := make([]string, len(targets))
+		for i, t := range targets {
+			names[i] = t.name
+		}
+		res.write(w, names)
+	}
+	commit()
+}
+
+type captureRow struct {
+	Domain    string   `json:"domain"`
+	Selectors []string `json:"selectors"`
+}
+
+type captureResult struct {
+	rows     []captureRow
+	captured map[string][]string // selector -> domains, in input order
+}
+
+func (r *captureResult) write(w io.Writer, selectors []string) {
+	for _, s := range selectors {
+		fmt.Fprintf(w, "%s  captures %d/%d\n", s, len(r.captured[s]), len(r.rows))
+		for _, d := range r.captured[s] {
+			fmt.Fprintln(w, "  "+d)
+		}
+		fmt.Fprintln(w)
+	}
+
+	var multi, none []captureRow
+	for _, row := range r.rows {
+		switch {
+		case len(row.Selectors) > 1:
+			multi = append(multi, row)
+		case len(row.Selectors) == 0:
+			none = append(none, row)
+		}
+	}
+	if len(multi) > 0 {
+		fmt.Fprintf(w, "captured by more than one selector (%d), the first rule using one of them wins:\n", len(multi))
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, row := range multi {
+			fmt.Fprintf(tw, "  %s\t%s\n", row.Domain, strings.Join(row.Selectors, ", "))
+		}
+		_ = tw.Flush()
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "not captured (%d):\n", len(none))
+	for _, row := range none {
+		fmt.Fprintln(w, "  "+row.Domain)
+	}
+}
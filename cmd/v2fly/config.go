@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"gopkg.in/yaml.v3"
+)
+
+// config holds the ranking tuned once for every run, read from -config
+// or $XDG_CONFIG_HOME/v2raytun-routing/v2fly.yaml:
+//
+//	demote: [category-ads-all, geolocation-!cn]
+//	hide: [tld-ru, private:legacy]
+//
+// An entry is a tag of any file, or a qualified one of a single file.
+type config struct {
+	Demote []string `yaml:"demote"` // sorted after every other selector, whatever its size
+	Hide   []string `yaml:"hide"`   // left out of the output
+}
+
+// configFile is the config looked for when -config is not given.
+const configFile = "v2raytun-routing/v2fly.yaml"
+
+// loadConfig reads path; with an empty path the default config is read
+// if there is one.
+func loadConfig(path string) (config, error) {
+	var cfg config
+	if path == "" {
+		p, err := xdg.SearchConfigFile(configFile)
+		if err != nil {
+			return cfg, nil // none
+		}
+		path = p
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// tagListed reports whether the tag of m is in tags, where a qualified
+// entry (private:banking) only counts for the selectors of that file.
+func tagListed(tags []string, m geosite.Match) bool {
+	prefix, _, _ := strings.Cut(m.Selector, ":")
+	for _, t := range tags {
+		if q, tag, ok := strings.Cut(t, ":"); ok {
+			if strings.EqualFold(q, prefix) && strings.EqualFold(tag, m.Tag) {
+				return true
+			}
+		} else if strings.EqualFold(t, m.Tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/geosite"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// geositeFile is one of the -geosite files. The first one keeps the
+// geosite: prefix; the others qualify their selectors with the file name,
+// private.dat giving private:banking, so a private list can be told apart
+// from the official one it is matched with.
+type geositeFile struct {
+	prefix  string
+	list    *router.GeoSiteList
+	matcher *geosite.Matcher
+}
+
+// loadFiles loads every path, naming selectors as described above; two
+// files with the same name are told apart by a number.
+func loadFiles(paths []string) ([]geositeFile, error) {
+	files := make([]geositeFile, 0, len(paths))
+	used := make(map[string]bool)
+	for i, p := range paths {
+		list, err := decodeOpts.Load(context.Background(), p)
+		if err != nil {
+			return nil, err
+		}
+		prefix := "geosite"
+		if i > 0 {
+			prefix = fileQualifier(p)
+		}
+		for name, n := prefix, 2; used[prefix]; n++ {
+			prefix = fmt.Sprint(name, n)
+		}
+		used[prefix] = true
+		files = append(files, geositeFile{prefix: prefix, list: list, matcher: newMatcher(list)})
+	}
+	return files, nil
+}
+
+// fileQualifier is the lower-cased base name of a path or URL without its
+// extension.
+func fileQualifier(p string) string {
+	if u, err := url.Parse(p); err == nil && u.Scheme != "" {
+		p = u.Path
+	}
+	base := path.Base(strings.ReplaceAll(p, "\\", "/"))
+	if name := strings.TrimSuffix(base, path.Ext(base)); name != "" {
+		base = name
+	}
+	return strings.ToLower(base)
+}
+
+// appendMatch appends the matches of every file, qualifying the selectors
+// of all but the first.
+func appendMatch(dst []geosite.Match, files []geositeFile, host string) []geosite.Match {
+	for _, f := range files {
+		start := len(dst)
+		dst = f.matcher.AppendMatch(dst, host)
+		if f.prefix == "geosite" {
+			continue
+		}
+		for i := start; i < len(dst); i++ {
+			dst[i].Selector = f.prefix + ":" + strings.TrimPrefix(dst[i].Selector, "geosite:")
+		}
+	}
+	return dst
+}
+
+// selectorFile finds the file a qualified selector belongs to and returns
+// the selector as that file's matcher understands it.
+func selectorFile(files []geositeFile, sel string) (geositeFile, string, error) {
+	prefix, rest, ok := strings.Cut(strings.ToLower(sel), ":")
+	if !ok {
+		prefix, rest = "geosite", prefix
+	}
+	for _, f := range files {
+		if f.prefix != prefix {
+			continue
+		}
+		tag, _ := geosite.ParseSelector(rest)
+		if geosite.Find(f.list, tag) == nil {
+			return f, "", fmt.Errorf("%s: no tag %q", sel, tag)
+		}
+		return f, "geosite:" + rest, nil
+	}
+	return geositeFile{}, "", fmt.Errorf("%s: no -geosite file named %s", sel, prefix)
+}
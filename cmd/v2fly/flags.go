@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/geosite"
+)
+
+// listFlag collects comma-separated values from one or more flag uses.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// decodeOpts is how every command decodes geosite.dat; -lenient sets it.
+var decodeOpts = geosite.DecodeOptions{Warn: func(err error) {
+	fmt.Fprintln(os.Stderr, "warning:", err)
+}}
+
+func addDecodeFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&decodeOpts.Lenient, "lenient", false, "Skip corrupt geosite.dat entries and keep the tags before a truncated end, with warnings, instead of failing")
+}
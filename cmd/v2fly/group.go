@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/devemio/v2raytun-routing/geosite"
+)
+
+// selectorGroup is the inverted view: one selector and the input domains
+// it covers.
+type selectorGroup struct {
+	Selector string   `json:"selector"`
+	Size     int      `json:"size"`
+	Coverage float64  `json:"coverage"` // percent of input domains
+	Domains  []string `json:"domains"`
+}
+
+type groupCollector struct {
+	groups map[string]*selectorGroup
+	total  int
+}
+
+func newGroupCollector() *groupCollector {
+	return &groupCollector{groups: make(map[string]*selectorGroup)}
+}
+
+func (c *groupCollector) add(host string, matches []geosite.Match) {
+	c.total++
+	for _, m := range matches {
+		g, ok := c.groups[m.Selector]
+		if !ok {
+			g = &selectorGroup{Selector: m.Selector, Size: m.GroupSize}
+			c.groups[m.Selector] = g
+		}
+		g.Domains = append(g.Domains, host)
+	}
+}
+
+// sorted orders by coverage, then the narrower selector first.
+func (c *groupCollector) sorted() []*selectorGroup {
+	out := make([]*selectorGroup, 0, len(c.groups))
+	for _, g := range c.groups {
+		if c.total > 0 {
+			g.Coverage = 100 * float64(len(g.Domains)) / float64(c.total)
+		}
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if len(out[i].Domains) != len(out[j].Domains) {
+			return len(out[i].Domains) > len(out[j].Domains)
+		}
+		if out[i].Size != out[j].Size {
+			return out[i].Size < out[j].Size
+		}
+		return out[i].Selector < out[j].Selector
+	})
+	return out
+}
+
+func (c *groupCollector) write(w io.Writer, format string) {
+	groups := c.sorted()
+	if format == "jsonl" {
+		enc := json.NewEncoder(w)
+		for _, g := range groups {
+			_ = enc.Encode(g)
+		}
+		return
+	}
+
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s  size=%d  covers %d/%d (%.1f%%)\n", g.Selector, g.Size, len(g.Domains), c.total, g.Coverage)
+		for _, d := range g.Domains {
+			fmt.Fprintln(w, "  "+d)
+		}
+		fmt.Fprintln(w)
+	}
+}
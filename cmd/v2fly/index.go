@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devemio/v2raytun-routing/geosite"
+)
+
+// liveIndex keeps the matcher of one geosite.dat warm for serve and repl.
+// The matcher swaps lists atomically, so in-flight lookups finish on the
+// one they started with and never wait for a rebuild.
+type liveIndex struct {
+	path    string
+	matcher *geosite.Matcher
+	mu      sync.Mutex // serializes reloads
+	sum     [sha256.Size]byte
+	stamp   os.FileInfo
+}
+
+// reload re-reads the file and rebuilds the index only if its content
+// changed; remote files are re-downloaded when the cache is older than
+// -max-age. It reports whether a new index was swapped in.
+func (l *liveIndex) reload(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var prev [sha256.Size]byte
+	if l.matcher != nil {
+		prev = l.sum
+	}
+	geo, sum, err := decodeOpts.LoadIfChanged(ctx, l.path, prev)
+	if err != nil || geo == nil {
+		return false, err
+	}
+	if l.matcher == nil {
+		l.matcher = newMatcher(geo)
+	} else {
+		l.matcher.Set(geo)
+		warnRegexErrors(l.matcher)
+	}
+	l.sum = sum
+	return true, nil
+}
+
+// changed tells whether a local file was touched since the last check;
+// URLs always report true and leave it to the fetch cache.
+func (l *liveIndex) changed() bool {
+	if strings.Contains(l.path, "://") {
+		return true
+	}
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		return false
+	}
+	same := l.stamp != nil && fi.ModTime().Equal(l.stamp.ModTime()) && fi.Size() == l.stamp.Size()
+	l.stamp = fi
+	return !same
+}
+
+// watch reloads in the background every interval when the file changed,
+// calling done after each swap or failure.
+func (l *liveIndex) watch(every time.Duration, done func(swapped bool, err error)) {
+	if every <= 0 {
+		return
+	}
+	l.changed()
+	go func() {
+		for range time.Tick(every) {
+			if !l.changed() {
+				continue
+			}
+			if ok, err := l.reload(context.Background()); ok || err != nil {
+				done(ok, err)
+			}
+		}
+	}()
+}
@@ -2,347 +2,369 @@ package main
 
 import (
 	"bufio"
-	"errors"
 	"flag"
 	"fmt"
-	"net"
-	"net/url"
+	"io"
 	"os"
-	"regexp"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
 	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
-	"google.golang.org/protobuf/proto"
 )
 
-type Match struct {
-	Selector   string // geosite:<tag> or geosite:<tag>@<attr>
-	Tag        string
-	Attr       string // "" for base
-	GroupSize  int    // number of domain rules in that selector
-	Why        string // matched rule type: domain/full/plain/regex
-	WhyRuleVal string // matched rule value
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "serve":
+			serve(args[1:])
+			return
+		case "repl":
+			repl(args[1:])
+			return
+		case "tags":
+			tags(args[1:])
+			return
+		case "capture":
+			capture(args[1:])
+			return
+		case "whynot":
+			whynot(args[1:])
+			return
+		case "match":
+			args = args[1:]
+		}
+	}
+	match(args)
 }
 
-func main() {
-	var geositePath string
+// match is the default command: v2fly [match] [flags] [host... | -].
+func match(args []string) {
+	var geositePaths listFlag
 	var domainsPath string
 	var showWhy bool
+	var noColor bool
+	var outPath string
+	var format string
+	var requireMatch bool
+	var filter matchFilter
+	var groupBy string
+	var rank ranking
+	var unwrap bool
+	var suggest int
+	var configPath string
+
+	fs := flag.NewFlagSet("match", flag.ExitOnError)
+	fs.Var(&geositePaths, "geosite", "Path or URL to geosite.dat (v2fly/domain-list-community build), default dlc.dat; repeat to match several files, selectors of the others are named after the file (private:banking)")
+	fs.StringVar(&domainsPath, "domains", "domains.txt", "Path, glob, directory or URL of files with domains/urls (one per line), - for stdin; ignored if hosts are given as arguments")
+	fs.BoolVar(&showWhy, "why", true, "Show a brief reason (matched rule type/value)")
+	fs.BoolVar(&noColor, "no-color", false, "Disable colored output (also honors NO_COLOR)")
+	fs.StringVar(&outPath, "o", "", "Write output to this file (atomically) instead of stdout")
+	fs.StringVar(&format, "format", "text", "Output format: text or jsonl (one JSON object per domain)")
+	fs.BoolVar(&requireMatch, "require-match", false, "Exit with code 2 and a summary on stderr if any domain has no geosite match")
+	fs.StringVar(&groupBy, "group-by", "domain", "Group results by domain, or by selector with the domains it covers")
+	fs.Func("sort", "Order selectors by match score (rule type, value length, group size) or by group size alone: score or size (default score)", rank.setOrder)
+	fs.Var(&rank.prefer, "prefer-attr", "Rank selectors with these attributes first, e.g. cn (comma-separated, repeatable)")
+	fs.Var(&rank.demote, "demote-attr", "Rank selectors with these attributes last, e.g. ads (comma-separated, repeatable)")
+	fs.IntVar(&filter.top, "top", 0, "Show only the N best ranked selectors per domain (0 = all)")
+	fs.IntVar(&filter.minSize, "min-size", 0, "Hide selectors with fewer rules than this")
+	fs.IntVar(&filter.maxSize, "max-size", 0, "Hide selectors with more rules than this (0 = no limit)")
+	fs.IntVar(&filter.ignoreLarger, "ignore-larger-than", 0, "Leave out umbrella selectors with more rules than this, like category-ads-all, listing them after the rest (0 = keep)")
+	fs.StringVar(&configPath, "config", "", "Config with tags to always demote or hide (default $XDG_CONFIG_HOME/"+configFile+" if it exists)")
+	fs.IntVar(&suggest, "suggest", 3, "For domains with no match, suggest up to N close rule values from the .dat (0 = off)")
+	fs.BoolVar(&unwrap, "unwrap", false, "Match the destination host of redirector URLs (google.com/url?q=..., t.co/...)")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	_ = fs.Parse(args)
+	if err := profile.Start(); err != nil {
+		fatal(err)
+	}
+	defer profile.Stop()
 
-	flag.StringVar(&geositePath, "geosite", "dlc.dat", "Path to geosite.dat (v2fly/domain-list-community build)")
-	flag.StringVar(&domainsPath, "domains", "domains.txt", "Path to file with domains/urls (one per line)")
-	flag.BoolVar(&showWhy, "why", true, "Show a brief reason (matched rule type/value)")
-	flag.Parse()
-
-	geo, err := loadGeoSiteList(geositePath)
+	cfg, err := loadConfig(configPath)
 	if err != nil {
 		fatal(err)
 	}
-
-	domains, err := readDomains(domainsPath)
+	rank.demoteTags, filter.hideTags = cfg.Demote, cfg.Hide
+	if len(geositePaths) == 0 {
+		geositePaths = listFlag{"dlc.dat"}
+	}
+	files, err := loadFiles(geositePaths)
 	if err != nil {
 		fatal(err)
 	}
 
-	// Precompute group sizes:
-	// - base size: total rules in tag
-	// - attr size: count of rules within tag that have attr
-	baseSize, attrSize := computeSizes(geo)
+	near := newSuggester(suggest)
+	w, commit := openOutput(outPath)
+	color := outPath == "" && useColor(os.Stdout, noColor)
+	out, err := newPrinter(format, w, showWhy, color)
+	if err != nil {
+		fatal(err)
+	}
 
-	// Regex cache across all matching
-	regexCache := make(map[string]*regexp.Regexp)
+	var groups *groupCollector
+	switch groupBy {
+	case "domain":
+	case "selector":
+		groups = newGroupCollector()
+	default:
+		fatal(fmt.Errorf("unknown -group-by %q (want domain or selector)", groupBy))
+	}
 
-	for _, raw := range domains {
-		host, err := normalizeDomain(raw)
+	// Results are written as they are computed and flushed whenever the
+	// input would block or flushEvery passed, so the output works in
+	// pipelines and survives an interrupt.
+	var unmatched []string
+	var matches []geosite.Match // reused across domains
+	total := 0
+	flushed := time.Now()
+	err = eachDomain(fs.Args(), domainsPath, func() { _ = w.Flush() }, func(raw string) {
+		total++
+		if unwrap {
+			raw = resolve(raw)
+		}
+		if d, ok := domain.Extract(raw); ok {
+			fmt.Fprintf(os.Stderr, "warning: %q is not a host, using %s\n", raw, d)
+			raw = d
+		}
+		host, err := domain.Normalize(raw)
 		if err != nil {
-			fmt.Printf("%s\tERROR\t%v\n", raw, err)
-			continue
+			out.printError(raw, err)
+			unmatched = append(unmatched, raw)
+			return
 		}
 
-		matches := findMatchesForDomain(host, geo, baseSize, attrSize, regexCache)
-
-		fmt.Printf("== %s ==\n", host)
-		if len(matches) == 0 {
-			fmt.Println("(no geosite match found)")
-			fmt.Println()
-			continue
+		matches = appendMatch(matches[:0], files, host)
+		found := len(matches)
+		if found == 0 {
+			unmatched = append(unmatched, host)
 		}
-
-		// Sort: smallest group first, then selector for stability
-		sort.Slice(matches, func(i, j int) bool {
-			if matches[i].GroupSize != matches[j].GroupSize {
-				return matches[i].GroupSize < matches[j].GroupSize
-			}
-			return matches[i].Selector < matches[j].Selector
-		})
-
-		for _, m := range matches {
-			if showWhy {
-				fmt.Printf("%-42s size=%-6d via=%s:%s\n", m.Selector, m.GroupSize, m.Why, m.WhyRuleVal)
-			} else {
-				fmt.Printf("%-42s size=%d\n", m.Selector, m.GroupSize)
-			}
+		var r result
+		var dropped int
+		matches, r.ignored, dropped = filter.dropUmbrellas(matches)
+		rank.sort(matches)
+		if groups != nil {
+			groups.add(host, filter.apply(matches))
+			return
 		}
-		fmt.Println()
+		if found == 0 {
+			r.near = near.suggest(files, host)
+		}
+		r.matches = filter.apply(matches)
+		r.hidden = found - dropped - len(r.matches)
+		out.print(host, r)
+		if time.Since(flushed) > flushEvery {
+			_ = w.Flush()
+			flushed = time.Now()
+		}
+	})
+	if err != nil {
+		fatal(err)
 	}
-}
+	if groups != nil {
+		groups.write(w, format)
+	}
+	commit()
 
-func fatal(err error) {
-	fmt.Fprintln(os.Stderr, "ERROR:", err)
-	os.Exit(1)
+	if requireMatch && len(unmatched) > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d domains have no geosite match:\n", len(unmatched), total)
+		for _, d := range unmatched {
+			fmt.Fprintln(os.Stderr, "  "+d)
+		}
+		profile.Stop()
+		os.Exit(exitUnmatched)
+	}
 }
 
-func loadGeoSiteList(path string) (*router.GeoSiteList, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+// resolve unwraps redirector and shortener URLs, keeping the input as is
+// if a shortener cannot be asked.
+func resolve(s string) string {
+	c, err := fetch.Default.Client()
+	if err == nil {
+		s, err = domain.Resolve(c, s)
 	}
-	list := new(router.GeoSiteList)
-	if err := proto.Unmarshal(b, list); err != nil {
-		return nil, fmt.Errorf("proto unmarshal geosite.dat: %w", err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cannot unwrap %s: %v\n", s, err)
 	}
-	return list, nil
+	return s
 }
 
-func readDomains(path string) ([]string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
+// ranking moves attribute selectors up or down before score and size are
+// compared, since a small attribute subset is often the wanted one. Tags
+// demoted in the config go after all of them.
+type ranking struct {
+	prefer     listFlag
+	demote     listFlag
+	demoteTags []string
+	bySize     bool // ignore the score, as before it existed
+}
 
-	var out []string
-	sc := bufio.NewScanner(f)
-	for sc.Scan() {
-		line := strings.TrimSpace(sc.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		out = append(out, line)
-	}
-	if err := sc.Err(); err != nil {
-		return nil, err
+func (r *ranking) setOrder(s string) error {
+	switch s {
+	case "score":
+		r.bySize = false
+	case "size":
+		r.bySize = true
+	default:
+		return fmt.Errorf("want score or size, got %q", s)
 	}
-	return out, nil
+	return nil
 }
 
-// normalizeDomain accepts:
-// - pure host: sub.example.com
-// - host:port
-// - URL (http/https/etc)
-// Returns lowercase host without trailing dot.
-func normalizeDomain(s string) (string, error) {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return "", errors.New("empty")
+func (r ranking) rank(m geosite.Match) int {
+	if tagListed(r.demoteTags, m) {
+		return 3
 	}
-
-	// Try URL parse if it looks like one.
-	if strings.Contains(s, "://") {
-		u, err := url.Parse(s)
-		if err == nil && u.Host != "" {
-			host := u.Host
-			// strip port if present
-			if h, _, err2 := net.SplitHostPort(host); err2 == nil {
-				host = h
-			}
-			return cleanHost(host)
+	for _, a := range r.prefer {
+		if strings.EqualFold(m.Attr, a) {
+			return 0
 		}
 	}
-
-	// If contains path but no scheme, try adding scheme
-	if strings.ContainsAny(s, "/?") && !strings.Contains(s, "://") {
-		u, err := url.Parse("http://" + s)
-		if err == nil && u.Host != "" {
-			host := u.Host
-			if h, _, err2 := net.SplitHostPort(host); err2 == nil {
-				host = h
-			}
-			return cleanHost(host)
+	for _, a := range r.demote {
+		if strings.EqualFold(m.Attr, a) {
+			return 2
 		}
 	}
+	return 1
+}
 
-	// host:port ?
-	if h, _, err := net.SplitHostPort(s); err == nil {
-		return cleanHost(h)
-	}
+func (r ranking) sort(matches []geosite.Match) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		if ri, rj := r.rank(matches[i]), r.rank(matches[j]); ri != rj {
+			return ri < rj
+		}
+		if !r.bySize && matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if matches[i].GroupSize != matches[j].GroupSize {
+			return matches[i].GroupSize < matches[j].GroupSize
+		}
+		return matches[i].Selector < matches[j].Selector
+	})
+}
 
-	// Otherwise assume it's already host
-	return cleanHost(s)
+// matchFilter trims sorted matches for display.
+type matchFilter struct {
+	top          int
+	minSize      int
+	maxSize      int
+	ignoreLarger int
+	hideTags     []string
 }
 
-func cleanHost(host string) (string, error) {
-	host = strings.ToLower(strings.TrimSpace(host))
-	host = strings.TrimSuffix(host, ".")
-	if host == "" {
-		return "", errors.New("empty host after normalization")
+// dropUmbrellas removes the selectors above -ignore-larger-than in place.
+// Unlike -max-size they are still named, once, so a domain only umbrella
+// tags cover is not mistaken for one nothing covers. It also returns how
+// many it removed, attribute selectors included.
+func (f matchFilter) dropUmbrellas(matches []geosite.Match) ([]geosite.Match, []string, int) {
+	if f.ignoreLarger <= 0 {
+		return matches, nil, 0
 	}
-	if strings.Contains(host, " ") {
-		return "", fmt.Errorf("invalid host: %q", host)
+	var ignored []string
+	out := matches[:0]
+	for _, m := range matches {
+		if m.GroupSize <= f.ignoreLarger {
+			out = append(out, m)
+		} else if m.Attr == "" {
+			ignored = append(ignored, m.Selector)
+		}
 	}
-	return host, nil
+	return out, ignored, len(matches) - len(out)
 }
 
-func computeSizes(geo *router.GeoSiteList) (map[string]int, map[string]map[string]int) {
-	base := make(map[string]int)            // tag -> count
-	attr := make(map[string]map[string]int) // tag -> attr -> count
-
-	for _, site := range geo.GetEntry() {
-		tag := site.GetCountryCode()
-		domains := site.GetDomain()
-
-		base[tag] = len(domains)
-		if _, ok := attr[tag]; !ok {
-			attr[tag] = make(map[string]int)
+func (f matchFilter) apply(matches []geosite.Match) []geosite.Match {
+	out := matches[:0]
+	for _, m := range matches {
+		if m.GroupSize < f.minSize || (f.maxSize > 0 && m.GroupSize > f.maxSize) || tagListed(f.hideTags, m) {
+			continue
 		}
-
-		for _, d := range domains {
-			for _, a := range d.GetAttribute() {
-				k := a.GetKey()
-				if k != "" {
-					attr[tag][k]++
-				}
-			}
+		out = append(out, m)
+		if f.top > 0 && len(out) == f.top {
+			break
 		}
 	}
+	return out
+}
 
-	return base, attr
+// newMatcher indexes geo and warns about regex rules that never match.
+func newMatcher(geo *router.GeoSiteList) *geosite.Matcher {
+	m := geosite.NewMatcher(geo)
+	warnRegexErrors(m)
+	return m
 }
 
-func findMatchesForDomain(
-	host string,
-	geo *router.GeoSiteList,
-	baseSize map[string]int,
-	attrSize map[string]map[string]int,
-	regexCache map[string]*regexp.Regexp,
-) []Match {
-	type why struct {
-		ruleType string
-		ruleVal  string
+func warnRegexErrors(m *geosite.Matcher) {
+	for _, e := range m.RegexErrors() {
+		fmt.Fprintln(os.Stderr, "warning:", e)
 	}
+}
 
-	// selector -> best why (first hit)
-	selectorWhy := make(map[string]why)
-
-	for _, site := range geo.GetEntry() {
-		tag := site.GetCountryCode()
+// exitUnmatched is returned by -require-match; errors use 1.
+const exitUnmatched = 2
 
-		for _, rule := range site.GetDomain() {
-			ok, whyType := matchRule(host, rule, regexCache)
-			if !ok {
-				continue
-			}
+func fatal(err error) {
+	profile.Stop()
+	fmt.Fprintln(os.Stderr, "ERROR:", err)
+	os.Exit(1)
+}
 
-			// Base selector always matches if rule matches
-			baseSel := "geosite:" + tag
-			if _, exists := selectorWhy[baseSel]; !exists {
-				selectorWhy[baseSel] = why{ruleType: whyType, ruleVal: rule.GetValue()}
-			}
+// flushEvery bounds how long a result may sit in the output buffer.
+const flushEvery = time.Second
 
-			// Attribute selectors: geosite:<tag>@<attr>
-			for _, a := range rule.GetAttribute() {
-				k := a.GetKey()
-				if k == "" {
-					continue
-				}
-				sel := "geosite:" + tag + "@" + k
-				if _, exists := selectorWhy[sel]; !exists {
-					selectorWhy[sel] = why{ruleType: whyType, ruleVal: rule.GetValue()}
-				}
+// eachDomain calls fn for the hosts from positional args, where "-" reads
+// stdin, falling back to the domains file, glob or directory. Lists are
+// streamed line by line; idle is called before a read that may block.
+func eachDomain(args []string, path string, idle func(), fn func(string)) error {
+	if len(args) == 0 {
+		files, err := fetch.Expand(path)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := readLines(f, idle, fn); err != nil {
+				return err
 			}
 		}
+		return nil
 	}
-
-	// Build matches with sizes
-	var out []Match
-	for sel, w := range selectorWhy {
-		tag, attr := parseSelector(sel)
-		size := 0
-		if attr == "" {
-			size = baseSize[tag]
-		} else {
-			size = attrSize[tag][attr]
+	for _, a := range args {
+		if a != "-" {
+			fn(a)
+			continue
+		}
+		if err := readLines(a, idle, fn); err != nil {
+			return err
 		}
-		out = append(out, Match{
-			Selector:   sel,
-			Tag:        tag,
-			Attr:       attr,
-			GroupSize:  size,
-			Why:        w.ruleType,
-			WhyRuleVal: w.ruleVal,
-		})
-	}
-
-	return out
-}
-
-func parseSelector(sel string) (tag string, attr string) {
-	sel = strings.TrimPrefix(sel, "geosite:")
-	parts := strings.SplitN(sel, "@", 2)
-	tag = parts[0]
-	if len(parts) == 2 {
-		attr = parts[1]
 	}
-	return tag, attr
+	return nil
 }
 
-// IMPORTANT COMPAT FIX:
-// Different v2fly/v2ray-core versions generate different enum constant names.
-// To avoid "undefined: router.Domain_Domain", we match by the numeric enum values.
-// According to the proto, the mapping is typically:
-//
-//	Plain=0, Regex=1, Domain=2, Full=3
-//
-// If your version differs, you can adjust the numbers below.
-func matchRule(host string, d *router.Domain, cache map[string]*regexp.Regexp) (bool, string) {
-	val := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d.GetValue()), "."))
-	if val == "" {
-		return false, ""
+func readLines(path string, idle func(), fn func(string)) error {
+	f, err := fetch.Open(path)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	t := int32(d.GetType())
-
-	switch t {
-	case 0: // Plain
-		if strings.Contains(host, val) {
-			return true, "plain"
-		}
-		return false, "plain"
-
-	case 2: // Domain (suffix)
-		if host == val || strings.HasSuffix(host, "."+val) {
-			return true, "domain"
-		}
-		return false, "domain"
-
-	case 3: // Full
-		if host == val {
-			return true, "full"
-		}
-		return false, "full"
-
-	case 1: // Regex
-		re, ok := cache[val]
-		if !ok {
-			r, err := regexp.Compile(val)
-			if err != nil {
-				cache[val] = nil
-				return false, "regex"
-			}
-			cache[val] = r
-			re = r
+	r := bufio.NewReaderSize(f, 64<<10)
+	for {
+		if r.Buffered() == 0 {
+			idle()
 		}
-		if re != nil && re.MatchString(host) {
-			return true, "regex"
+		line, err := r.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			fn(line)
 		}
-		return false, "regex"
-
-	default:
-		// Conservative fallback: exact match only
-		if host == val {
-			return true, "unknown"
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
 		}
-		return false, "unknown"
 	}
 }
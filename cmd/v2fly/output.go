@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/atomicfile"
+	"github.com/devemio/v2raytun-routing/geosite"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// openOutput returns buffered stdout, or with -o an atomically written
+// file that appears only when commit is called.
+func openOutput(path string) (*bufio.Writer, func()) {
+	if path == "" || path == "-" {
+		w := bufio.NewWriter(os.Stdout)
+		return w, func() { _ = w.Flush() }
+	}
+	f, err := atomicfile.Create(path)
+	if err != nil {
+		fatal(err)
+	}
+	return f.Writer, func() {
+		if err := f.Commit(); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// useColor honors -no-color, NO_COLOR (https://no-color.org) and only
+// colors terminals.
+func useColor(f *os.File, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// printer renders the result for one input domain at a time.
+type printer interface {
+	print(host string, r result)
+	printError(raw string, err error)
+}
+
+// result is what is printed for one domain.
+type result struct {
+	matches []geosite.Match
+	near    []nearMiss // close rule values, only if nothing matched
+	ignored []string   // umbrella selectors left out, see -ignore-larger-than
+	hidden  int        // other matches the display filters left out
+}
+
+func newPrinter(format string, w io.Writer, showWhy, color bool) (printer, error) {
+	switch format {
+	case "text", "":
+		return &textPrinter{w: w, showWhy: showWhy, color: color}, nil
+	case "jsonl":
+		return &jsonlPrinter{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (want text or jsonl)", format)
+	}
+}
+
+type textPrinter struct {
+	w       io.Writer
+	showWhy bool
+	color   bool
+}
+
+func (p *textPrinter) paint(code, s string) string {
+	if !p.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// print writes one domain block; matches must already be sorted, the
+// first one is highlighted as the best selector.
+func (p *textPrinter) print(host string, r result) {
+	fmt.Fprintln(p.w, p.paint(ansiBold, "== "+host+" =="))
+	matches := r.matches
+	if len(matches) == 0 && (len(r.ignored) > 0 || r.hidden > 0) {
+		if len(r.ignored) > 0 {
+			fmt.Fprintln(p.w, p.paint(ansiDim, "(only umbrella selectors: "+formatSelectors(r.ignored)+")"))
+		}
+		if r.hidden > 0 {
+			fmt.Fprintln(p.w, p.paint(ansiDim, fmt.Sprintf("(%d matches hidden by filters)", r.hidden)))
+		}
+		fmt.Fprintln(p.w)
+		return
+	}
+	if len(matches) == 0 {
+		fmt.Fprintln(p.w, p.paint(ansiRed, "(no geosite match found)"))
+		for _, n := range r.near {
+			fmt.Fprintf(p.w, "did you mean %s (%s)? %s\n", p.paint(ansiYellow, n.Rule), formatSelectors(n.Selectors), n.Why)
+		}
+		fmt.Fprintln(p.w)
+		return
+	}
+
+	selWidth, sizeWidth := 0, 0
+	for _, m := range matches {
+		selWidth = max(selWidth, len(m.Selector))
+		sizeWidth = max(sizeWidth, len(fmt.Sprint(m.GroupSize)))
+	}
+
+	for i, m := range matches {
+		sel := m.Selector + strings.Repeat(" ", selWidth-len(m.Selector))
+		if i == 0 {
+			sel = p.paint(ansiBold+ansiCyan, sel)
+		}
+		size := fmt.Sprintf("size=%-*d  score=%-3d", sizeWidth, m.GroupSize, m.Score)
+		if !p.showWhy {
+			fmt.Fprintf(p.w, "%s  %s\n", sel, strings.TrimRight(size, " "))
+			continue
+		}
+		fmt.Fprintf(p.w, "%s  %s  via=%s\n", sel, size, p.paint(whyColor(m.Why), m.Why+":"+m.WhyRuleVal))
+	}
+	if len(r.ignored) > 0 {
+		fmt.Fprintln(p.w, p.paint(ansiDim, fmt.Sprintf("(+%d umbrella: %s)", len(r.ignored), formatSelectors(r.ignored))))
+	}
+	fmt.Fprintln(p.w)
+}
+
+func (p *textPrinter) printError(raw string, err error) {
+	fmt.Fprintf(p.w, "%s\tERROR\t%v\n", raw, err)
+}
+
+// jsonlPrinter writes one self-contained JSON object per line.
+type jsonlPrinter struct {
+	enc *json.Encoder
+}
+
+type jsonlResult struct {
+	Domain      string          `json:"domain"`
+	Matches     []geosite.Match `json:"matches"`
+	Suggestions []nearMiss      `json:"suggestions,omitempty"`
+	Ignored     []string        `json:"ignored,omitempty"`
+	Hidden      int             `json:"hidden,omitempty"`
+}
+
+type jsonlError struct {
+	Input string `json:"input"`
+	Error string `json:"error"`
+}
+
+func (p *jsonlPrinter) print(host string, r result) {
+	if r.matches == nil {
+		r.matches = []geosite.Match{}
+	}
+	_ = p.enc.Encode(jsonlResult{Domain: host, Matches: r.matches, Suggestions: r.near, Ignored: r.ignored, Hidden: r.hidden})
+}
+
+func (p *jsonlPrinter) printError(raw string, err error) {
+	_ = p.enc.Encode(jsonlError{Input: raw, Error: err.Error()})
+}
+
+// whyColor separates exact matches from fuzzy keyword/regex ones.
+func whyColor(why string) string {
+	switch why {
+	case "full", "domain":
+		return ansiGreen
+	case "plain", "regex":
+		return ansiYellow
+	default:
+		return ansiDim
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+)
+
+const replHelp = `hostname      show matching selectors
+:tags         list tags with rule counts
+:dump SEL     print rules of geosite:<tag>[@attr]
+:why          toggle matched rule display
+:help         show this help
+:quit         exit`
+
+// repl keeps geosite.dat loaded and matches hostnames typed one by one.
+func repl(args []string) {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	geositePath := fs.String("geosite", "dlc.dat", "Path or URL to geosite.dat (v2fly/domain-list-community build)")
+	noColor := fs.Bool("no-color", false, "Disable colored output (also honors NO_COLOR)")
+	watch := fs.Duration("watch", 5*time.Second, "Check geosite.dat for changes this often and reload it in the background (0 = never)")
+	configPath := fs.String("config", "", "Config with tags to always demote or hide (default $XDG_CONFIG_HOME/"+configFile+" if it exists)")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	_ = fs.Parse(args)
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	rank, filter := ranking{demoteTags: cfg.Demote}, matchFilter{hideTags: cfg.Hide}
+
+	ix := &liveIndex{path: *geositePath}
+	if _, err := ix.reload(context.Background()); err != nil {
+		fatal(err)
+	}
+	ix.watch(*watch, func(_ bool, err error) {
+		if err != nil {
+			fmt.Printf("\nreload: %v\n> ", err)
+		} else {
+			fmt.Printf("\nreloaded %s: %d tags\n> ", *geositePath, len(ix.matcher.List().GetEntry()))
+		}
+	})
+	out := &textPrinter{w: os.Stdout, showWhy: true, color: useColor(os.Stdout, *noColor)}
+	near := newSuggester(3)
+
+	fmt.Printf("loaded %d tags from %s, :help for commands\n", len(ix.matcher.List().GetEntry()), *geositePath)
+
+	sc := bufio.NewScanner(os.Stdin)
+	for fmt.Print("> "); sc.Scan(); fmt.Print("> ") {
+		line := strings.TrimSpace(sc.Text())
+		cmd, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		geo := ix.matcher.List()
+
+		switch cmd {
+		case "":
+		case ":q", ":quit", ":exit":
+			return
+		case ":help", ":h":
+			fmt.Println(replHelp)
+		case ":tags":
+			printTags(geo)
+		case ":dump":
+			if arg == "" {
+				fmt.Println("usage: :dump geosite:<tag>[@attr]")
+				continue
+			}
+			dumpSelector(geo, arg)
+		case ":why":
+			out.showWhy = !out.showWhy
+			fmt.Printf("why: %v\n", out.showWhy)
+		default:
+			if strings.HasPrefix(cmd, ":") {
+				fmt.Printf("unknown command %s, :help for commands\n", cmd)
+				continue
+			}
+			host, err := domain.Normalize(line)
+			if err != nil {
+				fmt.Println("ERROR:", err)
+				continue
+			}
+			matches := ix.matcher.Match(host)
+			found := len(matches)
+			matches = filter.apply(matches)
+			rank.sort(matches)
+			r := result{matches: matches, hidden: found - len(matches)}
+			if found == 0 {
+				r.near = near.suggest([]geositeFile{{prefix: "geosite", list: geo}}, host)
+			}
+			out.print(host, r)
+		}
+	}
+	fmt.Println()
+}
+
+func printTags(geo *router.GeoSiteList) {
+	entries := geo.GetEntry()
+	tags := make([]string, 0, len(entries))
+	sizes := make(map[string]int, len(entries))
+	for _, site := range entries {
+		tags = append(tags, site.GetCountryCode())
+		sizes[site.GetCountryCode()] = len(site.GetDomain())
+	}
+	sort.Strings(tags)
+	for _, t := range tags {
+		fmt.Printf("%-40s %d\n", "geosite:"+strings.ToLower(t), sizes[t])
+	}
+}
+
+func dumpSelector(geo *router.GeoSiteList, sel string) {
+	tag, attrs := geosite.SplitSelector(sel)
+	for _, site := range geo.GetEntry() {
+		if !strings.EqualFold(site.GetCountryCode(), tag) {
+			continue
+		}
+		n := 0
+		for _, d := range site.GetDomain() {
+			if !geosite.HasAttrs(d, attrs) {
+				continue
+			}
+			fmt.Println(geosite.FormatRule(d))
+			n++
+		}
+		fmt.Printf("(%d rules)\n", n)
+		return
+	}
+	fmt.Printf("no such tag: %s\n", tag)
+}
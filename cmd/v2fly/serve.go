@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+)
+
+type server struct {
+	ix         liveIndex
+	configPath string
+	opts       atomic.Pointer[serveOptions]
+}
+
+// serveOptions is what -config sets, swapped whole on reload.
+type serveOptions struct {
+	rank   ranking
+	filter matchFilter
+}
+
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "Address to listen on")
+	geositePath := fs.String("geosite", "dlc.dat", "Path or URL to geosite.dat (v2fly/domain-list-community build)")
+	watch := fs.Duration("watch", 30*time.Second, "Check geosite.dat for changes this often and rebuild the index in the background (0 = only on SIGHUP or /-/reload)")
+	configPath := fs.String("config", "", "Config with tags to always demote or hide (default $XDG_CONFIG_HOME/"+configFile+" if it exists)")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	_ = fs.Parse(args)
+
+	s := &server{ix: liveIndex{path: *geositePath}, configPath: *configPath}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := s.reload(ctx); err != nil {
+		fatal(err)
+	}
+	s.ix.watch(*watch, func(swapped bool, err error) {
+		if err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			s.logLoaded()
+		}
+	})
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := s.reload(ctx); err != nil {
+				log.Printf("reload: %v", err)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /match", s.handleMatch)
+	mux.HandleFunc("POST /-/reload", s.handleReload)
+
+	// On SIGINT or SIGTERM requests in flight get shutdownGrace to finish.
+	srv := &http.Server{Addr: *listen, Handler: mux}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	log.Printf("listening on %s", *listen)
+	select {
+	case err := <-errc:
+		fatal(err)
+	case <-ctx.Done():
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+}
+
+const shutdownGrace = 5 * time.Second
+
+// reload re-reads the config and geosite.dat, keeping the current index
+// if it did not change. A config that does not load leaves the old
+// settings in place.
+func (s *server) reload(ctx context.Context) error {
+	cfg, cerr := loadConfig(s.configPath)
+	if cerr == nil {
+		s.opts.Store(&serveOptions{rank: ranking{demoteTags: cfg.Demote}, filter: matchFilter{hideTags: cfg.Hide}})
+	}
+	swapped, err := s.ix.reload(ctx)
+	if swapped {
+		s.logLoaded()
+	}
+	return errors.Join(cerr, err)
+}
+
+func (s *server) logLoaded() {
+	log.Printf("loaded %s: %d tags", s.ix.path, len(s.ix.matcher.List().GetEntry()))
+}
+
+func (s *server) handleMatch(w http.ResponseWriter, r *http.Request) {
+	host, err := domain.Normalize(r.URL.Query().Get("domain"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	o := s.opts.Load()
+	matches := o.filter.apply(s.ix.matcher.Match(host))
+	o.rank.sort(matches)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"domain":  host,
+		"matches": matches,
+	})
+}
+
+func (s *server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := s.reload(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
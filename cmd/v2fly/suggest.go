@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"golang.org/x/net/publicsuffix"
+)
+
+// nearMiss is a rule value close to a host no selector covers, most
+// often a typo in the list (yotube.com) or a rule one level off.
+type nearMiss struct {
+	Rule      string   `json:"rule"`
+	Selectors []string `json:"selectors"`
+	Why       string   `json:"why"`
+	dist      int
+}
+
+// suggester indexes the domain and full rules of a list by label count
+// and length, so only values that could be a few edits away are compared.
+// The index is built on the first miss and again when a list changes.
+type suggester struct {
+	n     int
+	mu    sync.Mutex
+	lists []*router.GeoSiteList
+	byLen map[[2]int][]*ruleValue
+	byReg map[string][]*ruleValue
+}
+
+// ruleValue is one domain or full value with every tag that has it; a
+// value that is a domain rule anywhere is suggested as one.
+type ruleValue struct {
+	value  string
+	domain bool
+	tags   []string
+}
+
+func (v *ruleValue) rule() string {
+	if v.domain {
+		return "domain:" + v.value
+	}
+	return "full:" + v.value
+}
+
+func newSuggester(n int) *suggester {
+	return &suggester{n: n}
+}
+
+func (s *suggester) index(files []geositeFile) {
+	values := make(map[string]*ruleValue)
+	s.byLen = make(map[[2]int][]*ruleValue)
+	s.byReg = make(map[string][]*ruleValue)
+	s.lists = s.lists[:0]
+	for _, f := range files {
+		s.lists = append(s.lists, f.list)
+		s.indexList(values, f)
+	}
+}
+
+func (s *suggester) indexList(values map[string]*ruleValue, f geositeFile) {
+	for _, site := range f.list.GetEntry() {
+		tag := f.prefix + ":" + strings.ToLower(site.GetCountryCode())
+		for _, d := range site.GetDomain() {
+			t := int32(d.GetType())
+			if t != 2 && t != 3 {
+				continue
+			}
+			host := strings.ToLower(d.GetValue())
+			if v := values[host]; v != nil {
+				v.domain = v.domain || t == 2
+				if v.tags[len(v.tags)-1] != tag {
+					v.tags = append(v.tags, tag)
+				}
+				continue
+			}
+			v := &ruleValue{value: host, domain: t == 2, tags: []string{tag}}
+			values[host] = v
+			k := [2]int{strings.Count(host, ".") + 1, len(host)}
+			s.byLen[k] = append(s.byLen[k], v)
+			if reg, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+				s.byReg[reg] = append(s.byReg[reg], v)
+			}
+		}
+	}
+}
+
+// stale reports whether files are not the lists the index was built from.
+func (s *suggester) stale(files []geositeFile) bool {
+	if len(files) != len(s.lists) {
+		return true
+	}
+	for i, f := range files {
+		if f.list != s.lists[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns up to n rule values near host: rules under the same
+// registrable domain, then values a typo away from host or one of its
+// parents down to the registrable domain.
+func (s *suggester) suggest(files []geositeFile, host string) []nearMiss {
+	if s == nil || s.n <= 0 {
+		return nil
+	}
+	reg, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stale(files) {
+		s.index(files)
+	}
+
+	var out []nearMiss
+	seen := make(map[*ruleValue]bool)
+	add := func(v *ruleValue, dist int, why string) {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, nearMiss{Rule: v.rule(), Selectors: v.tags, Why: why, dist: dist})
+		}
+	}
+	for _, v := range s.byReg[reg] {
+		add(v, 0, "same registrable domain "+reg)
+	}
+	labels := strings.Count(host, ".") + 1
+	for k := strings.Count(reg, ".") + 1; k <= labels; k++ {
+		target := lastLabels(host, k)
+		// One letter off a two-letter name is another site, not a typo.
+		limit := 1
+		if first, _, _ := strings.Cut(target, "."); len(first) < 3 {
+			continue
+		} else if len(target) > 8 {
+			limit = 2
+		}
+		for l := len(target) - limit; l <= len(target)+limit; l++ {
+			for _, v := range s.byLen[[2]int{k, l}] {
+				if d := editDistance(target, v.value); d > 0 && d <= limit {
+					add(v, d, fmt.Sprintf("%d edit(s) from %s", d, target))
+				}
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].dist != out[j].dist {
+			return out[i].dist < out[j].dist
+		}
+		return out[i].Rule < out[j].Rule
+	})
+	if len(out) > s.n {
+		out = out[:s.n]
+	}
+	return out
+}
+
+// formatSelectors lists the first few tags of a near miss.
+func formatSelectors(tags []string) string {
+	const show = 3
+	if len(tags) <= show {
+		return strings.Join(tags, ", ")
+	}
+	return fmt.Sprintf("%s +%d", strings.Join(tags[:show], ", "), len(tags)-show)
+}
+
+// lastLabels returns the last k labels of host.
+func lastLabels(host string, k int) string {
+	labels := strings.Split(host, ".")
+	if k >= len(labels) {
+		return host
+	}
+	return strings.Join(labels[len(labels)-k:], ".")
+}
+
+// editDistance is the Levenshtein distance between a and b, in bytes.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
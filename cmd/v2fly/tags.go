@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
+)
+
+// tags lists every tag containing each input domain. A domain in many
+// tags is routed by whichever of their rules comes first, so a route
+// change elsewhere can silently move it; those are flagged.
+func tags(args []string) {
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	geositePath := fs.String("geosite", "dlc.dat", "Path or URL to geosite.dat (v2fly/domain-list-community build)")
+	domainsPath := fs.String("domains", "domains.txt", "Path, glob, directory or URL of files with domains/urls (one per line), - for stdin; ignored if hosts are given as arguments")
+	overlap := fs.Int("overlap", 3, "Flag domains contained in at least this many tags")
+	outPath := fs.String("o", "", "Write output to this file (atomically) instead of stdout")
+	format := fs.String("format", "text", "Output format: text or jsonl (one JSON object per domain)")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	_ = fs.Parse(args)
+	if err := profile.Start(); err != nil {
+		fatal(err)
+	}
+	defer profile.Stop()
+	if *format != "text" && *format != "jsonl" {
+		fatal(fmt.Errorf("unknown -format %q (want text or jsonl)", *format))
+	}
+
+	geo, err := decodeOpts.Load(context.Background(), *geositePath)
+	if err != nil {
+		fatal(err)
+	}
+	matcher := newMatcher(geo)
+
+	type row struct {
+		Domain  string   `json:"domain"`
+		Tags    []string `json:"tags"`
+		Overlap bool     `json:"overlap"`
+	}
+	var rows []row
+	seen := make(map[string]bool)
+	var matches []geosite.Match
+	err = eachDomain(fs.Args(), *domainsPath, func() {}, func(raw string) {
+		host, err := domain.Normalize(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: skipping %q: %v\n", raw, err)
+			return
+		}
+		if seen[host] {
+			return
+		}
+		seen[host] = true
+		matches = matcher.AppendMatch(matches[:0], host)
+		var ts []string
+		for _, m := range matches {
+			if t := strings.ToLower(m.Tag); !slices.Contains(ts, t) {
+				ts = append(ts, t)
+			}
+		}
+		slices.Sort(ts)
+		rows = append(rows, row{Domain: host, Tags: ts, Overlap: len(ts) >= *overlap})
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	w, commit := openOutput(*outPath)
+	flagged := 0
+	enc := json.NewEncoder(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOMAIN\tTAGS\tLIST")
+	for _, r := range rows {
+		mark := ""
+		if r.Overlap {
+			flagged++
+			mark = "!"
+		}
+		if *format == "jsonl" {
+			if r.Tags == nil {
+				r.Tags = []string{}
+			}
+			_ = enc.Encode(r)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d%s\t%s\n", r.Domain, len(r.Tags), mark, strings.Join(r.Tags, ", "))
+	}
+	if *format == "text" {
+		_ = tw.Flush()
+	}
+	commit()
+	if flagged > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d domains are in %d+ tags (!): their outbound depends on the order of the rules using these tags\n", flagged, len(rows), *overlap)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"golang.org/x/net/publicsuffix"
+)
+
+// whynot explains why a host is not matched by a selector: which names
+// of its suffix chain the tag has rules for, whether an attribute filter
+// dropped the rule that would match, and the closest rules of the tag.
+func whynot(args []string) {
+	fs := flag.NewFlagSet("whynot", flag.ExitOnError)
+	geositePath := fs.String("geosite", "dlc.dat", "Path or URL to geosite.dat (v2fly/domain-list-community build)")
+	n := fs.Int("n", 5, "Number of closest rules to show")
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	_ = fs.Parse(args)
+	if err := profile.Start(); err != nil {
+		fatal(err)
+	}
+	defer profile.Stop()
+	if fs.NArg() != 2 {
+		fatal(errors.New("usage: v2fly whynot [-geosite dlc.dat] example.com geosite:TAG[@attr]"))
+	}
+
+	host, err := domain.Normalize(fs.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	selector := "geosite:" + strings.TrimPrefix(strings.ToLower(fs.Arg(1)), "geosite:")
+	geo, err := decodeOpts.Load(context.Background(), *geositePath)
+	if err != nil {
+		fatal(err)
+	}
+	tag, attrs := geosite.SplitSelector(selector)
+	site := geosite.Find(geo, tag)
+	if site == nil {
+		fatal(fmt.Errorf("%s: no tag %q", *geositePath, tag))
+	}
+	explainMiss(os.Stdout, newMatcher(geo), site, host, selector, attrs, *n)
+}
+
+func explainMiss(w io.Writer, m *geosite.Matcher, site *router.GeoSite, host, selector string, attrs []string, n int) {
+
+	cache := make(map[string]*regexp.Regexp)
+	var hits []*router.Domain
+	for _, d := range site.Domain {
+		if ok, _ := geosite.MatchRule(host, d, cache); ok {
+			if geosite.HasAttrs(d, attrs) {
+				fmt.Fprintf(w, "%s is matched by %s: %s\n", host, selector, geosite.FormatRule(d))
+				return
+			}
+			hits = append(hits, d)
+		}
+	}
+	fmt.Fprintf(w, "%s is not matched by %s (%d rules)\n", host, selector, len(m.Rules(selector)))
+
+	if len(hits) > 0 {
+		fmt.Fprintf(w, "\nattribute filter @%s excludes the rules of geosite:%s matching it:\n", strings.Join(attrs, "@"), strings.ToLower(site.CountryCode))
+		for _, d := range hits {
+			fmt.Fprintf(w, "  %s\n", geosite.FormatRule(d))
+		}
+	}
+
+	// The suffix chain is what domain rules are looked up by; a full rule
+	// only counts for the host itself.
+	fmt.Fprintln(w, "\nsuffix chain:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for name := host; ; {
+		var found []string
+		for _, d := range site.Domain {
+			t := int32(d.GetType())
+			if (t == 2 || (t == 3 && name == host)) && strings.EqualFold(d.GetValue(), name) {
+				found = append(found, geosite.FormatRule(d))
+			}
+		}
+		if len(found) == 0 {
+			found = []string{"no domain rule"}
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", name, strings.Join(found, ", "))
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+	_ = tw.Flush()
+
+	if c := closestRules(site, host, n); len(c) > 0 {
+		fmt.Fprintln(w, "\nclosest rules:")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, r := range c {
+			fmt.Fprintf(tw, "  %s\t%s\n", geosite.FormatRule(r.rule), r.why)
+		}
+		_ = tw.Flush()
+	}
+
+	var others []string
+	for _, mt := range m.Match(host) {
+		if mt.Attr == "" {
+			others = append(others, strings.ToLower(mt.Selector))
+		}
+	}
+	if len(others) > 0 {
+		fmt.Fprintf(w, "\nmatched instead by: %s\n", strings.Join(others, ", "))
+	}
+}
+
+type candidate struct {
+	rule *router.Domain
+	dist int
+	why  string
+}
+
+// closestRules ranks the domain, full and keyword rules of a tag by how
+// near they come to host: rules of the same registrable domain first,
+// then by edit distance to the part of host the rule would compare.
+// Rules that do match (and were filtered out by attribute) are skipped.
+func closestRules(site *router.GeoSite, host string, n int) []candidate {
+	reg, _ := publicsuffix.EffectiveTLDPlusOne(host)
+	cache := make(map[string]*regexp.Regexp)
+	var out []candidate
+	for _, d := range site.Domain {
+		if ok, _ := geosite.MatchRule(host, d, cache); ok {
+			continue
+		}
+		v := strings.ToLower(d.GetValue())
+		var c candidate
+		switch int32(d.GetType()) {
+		case 2, 3:
+			target := host
+			if int32(d.GetType()) == 2 {
+				target = lastLabels(host, strings.Count(v, ".")+1)
+			}
+			c.dist = editDistance(target, v)
+			if r, _ := publicsuffix.EffectiveTLDPlusOne(v); reg != "" && r == reg {
+				c.dist = 0
+				c.why = "same registrable domain " + reg
+				if int32(d.GetType()) == 3 {
+					c.why += ", but full: matches only " + v
+				} else {
+					c.why += ", but only covers " + v + " and below"
+				}
+			}
+		case 0:
+			c.dist = len(v)
+			for i := 0; i+len(v) <= len(host); i++ {
+				c.dist = min(c.dist, editDistance(host[i:i+len(v)], v))
+			}
+		default:
+			continue
+		}
+		if c.why == "" {
+			if c.dist > max(2, len(v)/3) {
+				continue
+			}
+			c.why = fmt.Sprintf("%d edit(s) away", c.dist)
+		}
+		c.rule = d
+		out = append(out, c)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].dist < out[j].dist })
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
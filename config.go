@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/devemio/v2raytun-routing/geosite"
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes profiles for the daemon and build commands.
+type Config struct {
+	Vars     map[string]string `yaml:"vars"` // defaults for ${name}, the environment wins
+	Daemon   DaemonConfig      `yaml:"daemon"`
+	Profiles []Profile         `yaml:"profiles"`
+}
+
+type DaemonConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Cron     string        `yaml:"cron"`
+}
+
+// Profile is one route built from a set of sources.
+type Profile struct {
+	Name       string        `yaml:"name"`
+	Route      string        `yaml:"route"`         // route name shown in the app, "Default" if empty
+	NameHash   bool          `yaml:"name-hash"`     // append a short content hash to the route name
+	Outbounds  string        `yaml:"outbounds"`     // client tags or config file, rules with others are warned about
+	Comments   bool          `yaml:"comment-names"` // one rule per entry comment, named after it
+	LinkPrefix string        `yaml:"link-prefix"`   // overrides -link-prefix
+	Sources    []string      `yaml:"sources"`
+	Exclude    []string      `yaml:"exclude"` // hosts never routed by the profile rules
+	Geosite    string        `yaml:"geosite"` // path or URL, enables optimize
+	Optimize   *Optimize     `yaml:"optimize"`
+	Shadowed   string        `yaml:"shadowed"` // report or prune entries shadowed by earlier rules
+	Sort       string        `yaml:"sort"`     // source (default), alpha or reverse
+	Subnets    []Subnet      `yaml:"subnets"`
+	Variants   []Variant     `yaml:"variants"`  // time windows with other settings
+	Countries  []string      `yaml:"countries"` // one profile per code, {cc} filled in the sources
+	Country    string        `yaml:"-"`
+	StaleAfter time.Duration `yaml:"stale-after"` // alert when a URL source is served from an older cache
+	Output     string        `yaml:"output"`
+	Webhook    string        `yaml:"webhook"`
+	Telegram   *Telegram     `yaml:"telegram"`
+}
+
+type Telegram struct {
+	Token string `yaml:"token"`
+	Chat  string `yaml:"chat"`
+}
+
+func loadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(Config)
+	if err := decodeConfig(b, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(cfg.Profiles) == 0 {
+		return nil, fmt.Errorf("%s: no profiles defined", path)
+	}
+	for i, p := range cfg.Profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("%s: profile #%d has no name", path, i+1)
+		}
+		if len(p.Sources) == 0 {
+			return nil, fmt.Errorf("%s: profile %s has no sources", path, p.Name)
+		}
+		if p.Shadowed != "" && p.Shadowed != "report" && p.Shadowed != "prune" {
+			return nil, fmt.Errorf("%s: profile %s: shadowed must be report or prune", path, p.Name)
+		}
+		if err := checkSortMode(p.Sort); err != nil {
+			return nil, fmt.Errorf("%s: profile %s: %w", path, p.Name, err)
+		}
+		for j := range p.Variants {
+			if err := p.Variants[j].parse(); err != nil {
+				return nil, fmt.Errorf("%s: profile %s: %w", path, p.Name, err)
+			}
+		}
+		for _, s := range p.Subnets {
+			if err := s.check(); err != nil {
+				return nil, fmt.Errorf("%s: profile %s: %w", path, p.Name, err)
+			}
+		}
+	}
+	profiles, err := expandCountries(cfg.Profiles)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.Profiles = profiles
+	if cfg.Daemon.Cron != "" {
+		if _, err := parseCron(cfg.Daemon.Cron); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// decodeConfig expands ${name} in every value before decoding, taking
+// names from the environment or the vars section, so one config works on
+// several machines. $$ is a literal $.
+func decodeConfig(b []byte, cfg *Config) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+
+	var head struct {
+		Vars map[string]string `yaml:"vars"`
+	}
+	if err := root.Decode(&head); err != nil {
+		return err
+	}
+	lookup := func(name string) (string, bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+		v, ok := head.Vars[name]
+		return v, ok
+	}
+	// vars may refer to the environment, but not to each other.
+	for k, v := range head.Vars {
+		x, err := expandVars(v, os.LookupEnv)
+		if err != nil {
+			return fmt.Errorf("vars.%s: %w", k, err)
+		}
+		head.Vars[k] = x
+	}
+
+	if err := expandNode(root, lookup); err != nil {
+		return err
+	}
+	return root.Decode(cfg)
+}
+
+func expandNode(n *yaml.Node, lookup func(string) (string, bool)) error {
+	if n.Kind == yaml.ScalarNode {
+		v, err := expandVars(n.Value, lookup)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		if v != n.Value {
+			n.Value = v
+			if n.Style == 0 {
+				// let "max-size: ${N}" resolve as a number
+				n.Tag = ""
+			}
+		}
+		return nil
+	}
+	for _, c := range n.Content {
+		if err := expandNode(c, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expandVars(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var out strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 || i == len(s)-1 {
+			out.WriteString(s)
+			return out.String(), nil
+		}
+		out.WriteString(s[:i])
+		switch s[i+1] {
+		case '$':
+			out.WriteByte('$')
+			s = s[i+2:]
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			name := s[i+2 : i+end]
+			v, ok := lookup(name)
+			if !ok {
+				return "", fmt.Errorf("undefined variable ${%s}", name)
+			}
+			out.WriteString(v)
+			s = s[i+end+1:]
+		default:
+			out.WriteByte('$')
+			s = s[i+1:]
+		}
+	}
+}
+
+// expandCountries replaces a profile with countries by one profile per
+// code, named <name>-<cc>. {cc} and {CC} are filled in route and output.
+func expandCountries(profiles []Profile) ([]Profile, error) {
+	var out []Profile
+	for _, p := range profiles {
+		if len(p.Countries) == 0 {
+			out = append(out, p)
+			continue
+		}
+		ccs, err := parseCountries(strings.Join(p.Countries, ","))
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		if p.Output != "" && !strings.Contains(strings.ToLower(p.Output), "{cc}") {
+			return nil, fmt.Errorf("profile %s: output must contain {cc} with countries", p.Name)
+		}
+		for _, cc := range ccs {
+			q := p
+			q.Name, q.Country, q.Countries = p.Name+"-"+cc, cc, nil
+			q.Route = countryName(p.Route, cc)
+			q.Output = countryReplacer(cc).Replace(p.Output)
+			out = append(out, q)
+		}
+	}
+	return out, nil
+}
+
+func (p Profile) encodeLink(route Route) (string, error) {
+	if p.LinkPrefix != "" {
+		return encodeLinkPrefix(route, p.LinkPrefix)
+	}
+	return encodeLink(route)
+}
+
+// buildResult is a built profile route plus what happened on the way.
+type buildResult struct {
+	Route    Route
+	Sources  []source
+	Stats    []sourceStat
+	Inputs   []string // hosts from the sources, before exclusion and optimization
+	Stale    []staleSource
+	Excluded []string
+	Selected []selectorUse
+	Matcher  *geosite.Matcher
+}
+
+// buildProfile runs the whole pipeline: fetch and merge sources, drop
+// exclusions, replace domains with geosite selectors, assemble the route.
+func buildProfile(p Profile, jobs int) (*buildResult, error) {
+	sources, err := fetchSources(p.Sources, jobs)
+	if err != nil {
+		return nil, err
+	}
+	if p.Country != "" {
+		sources = forCountry(sources, p.Country)
+	}
+	groups, stats, err := mergeSources(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := make([]string, 0, len(p.Exclude))
+	for _, x := range p.Exclude {
+		x, err := normalizeEntry(x)
+		if err != nil {
+			return nil, fmt.Errorf("exclude: %w", err)
+		}
+		exclude = append(exclude, x)
+	}
+	res := &buildResult{Sources: sources, Stats: stats, Inputs: groupHosts(groups)}
+	res.Stale = staleSources(sources, p.StaleAfter, time.Now())
+	groups, res.Excluded = excludeGroups(groups, exclude)
+	if len(groups) == 0 {
+		return nil, errors.New("domain list is empty")
+	}
+
+	var m *geosite.Matcher
+	if p.Geosite != "" {
+		if m, err = loadMatcher(p.Geosite); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Optimize != nil {
+		if m == nil {
+			return nil, errors.New("optimize requires geosite")
+		}
+		for i, g := range groups {
+			var used []selectorUse
+			groups[i], used = optimizeGroup(g, m, *p.Optimize, exclude)
+			res.Selected = append(res.Selected, used...)
+		}
+		saveMatchCaches()
+	}
+
+	sortGroups(groups, p.Sort)
+	if p.Comments {
+		groups = splitByNotes(groups)
+	}
+	res.Matcher = m
+	res.Route = withSubnets(checkShadowed(buildRoute(groups), p.Shadowed, m), p.Subnets)
+	if p.Route != "" {
+		res.Route.Name = p.Route
+	}
+	if p.Outbounds != "" {
+		known, err := knownOutbounds(p.Outbounds)
+		if err != nil {
+			return nil, err
+		}
+		checkOutbounds(os.Stderr, res.Route, known)
+	}
+	if p.NameHash {
+		res.Route = withContentHash(res.Route)
+	}
+	return res, nil
+}
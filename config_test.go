@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	vars := map[string]string{"HOME": "/home/u", "N": "5", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "plain", want: "plain"},
+		{in: "${HOME}/lists", want: "/home/u/lists"},
+		{in: "${N}${N}", want: "55"},
+		{in: "a${EMPTY}b", want: "ab"},
+		{in: "$$HOME costs $5", want: "$HOME costs $5"},
+		{in: "trailing $", want: "trailing $"},
+		{in: "${MISSING}", wantErr: true},
+		{in: "${HOME", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := expandVars(tt.in, lookup)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("expandVars(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		} else if got != tt.want {
+			t.Errorf("expandVars(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExpandCountries(t *testing.T) {
+	got, err := expandCountries([]Profile{
+		{Name: "plain"},
+		{Name: "geo", Route: "Route {CC}", Output: "out/{cc}.txt", Countries: []string{"RU", " kz"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range got {
+		names = append(names, p.Name+"|"+p.Country+"|"+p.Route+"|"+p.Output)
+	}
+	want := "plain|||,geo-ru|ru|Route RU|out/ru.txt,geo-kz|kz|Route KZ|out/kz.txt"
+	if s := strings.Join(names, ","); s != want {
+		t.Errorf("expandCountries = %s, want %s", s, want)
+	}
+
+	for _, p := range []Profile{
+		{Name: "bad", Countries: []string{"rus"}},
+		{Name: "noplaceholder", Output: "out.txt", Countries: []string{"ru"}},
+	} {
+		if _, err := expandCountries([]Profile{p}); err == nil {
+			t.Errorf("expandCountries(%s) succeeded, want an error", p.Name)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("V2RT_TEST_DIR", "/srv")
+	tests := []struct {
+		name, in string
+		wantErr  string
+		check    func(*Config) bool
+	}{
+		{
+			name: "vars and environment",
+			in: `vars:
+  lists: ${V2RT_TEST_DIR}/lists
+profiles:
+  - name: home
+    sources: ["${lists}/direct.txt"]
+    output: "${V2RT_TEST_DIR}/out"
+`,
+			check: func(c *Config) bool {
+				return c.Profiles[0].Sources[0] == "/srv/lists/direct.txt" && c.Profiles[0].Output == "/srv/out"
+			},
+		},
+		{name: "no profiles", in: "daemon:\n  interval: 1h\n", wantErr: "no profiles defined"},
+		{name: "no name", in: "profiles:\n  - sources: [a.txt]\n", wantErr: "has no name"},
+		{name: "no sources", in: "profiles:\n  - name: x\n", wantErr: "has no sources"},
+		{name: "bad shadowed", in: "profiles:\n  - name: x\n    sources: [a]\n    shadowed: yes\n", wantErr: "report or prune"},
+		{name: "bad cron", in: "daemon:\n  cron: \"* *\"\nprofiles:\n  - name: x\n    sources: [a]\n", wantErr: "want 5 fields"},
+		{name: "undefined var", in: "profiles:\n  - name: ${NOPE_V2RT}\n    sources: [a]\n", wantErr: "undefined variable"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(tt.in), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := loadConfig(path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !tt.check(cfg) {
+			t.Errorf("%s: unexpected config %+v", tt.name, cfg)
+		}
+	}
+}
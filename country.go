@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Templates for per-country routes use {cc} for the lowercase country
+// code, as in geoip:{cc} and geosite:category-{cc}, and {CC} for the
+// uppercase one, e.g. in the route name.
+func countryReplacer(cc string) *strings.Replacer {
+	return strings.NewReplacer("{cc}", cc, "{CC}", strings.ToUpper(cc))
+}
+
+// parseCountries splits a comma-separated list of two-letter codes.
+func parseCountries(s string) ([]string, error) {
+	var out []string
+	for _, cc := range strings.Split(s, ",") {
+		cc = strings.ToLower(strings.TrimSpace(cc))
+		if len(cc) != 2 || cc[0] < 'a' || cc[0] > 'z' || cc[1] < 'a' || cc[1] > 'z' {
+			return nil, fmt.Errorf("invalid country code %q", cc)
+		}
+		out = append(out, cc)
+	}
+	return out, nil
+}
+
+// forCountry fills the placeholders of the sources. A template without
+// any is built as is, with a warning.
+func forCountry(sources []source, cc string) []source {
+	r := countryReplacer(cc)
+	out := make([]source, len(sources))
+	found := false
+	for i, src := range sources {
+		s := string(src.Data)
+		found = found || strings.Contains(s, "{cc}") || strings.Contains(s, "{CC}")
+		out[i] = source{Path: src.Path, Data: []byte(r.Replace(s))}
+	}
+	if !found {
+		fmt.Fprintf(os.Stderr, "warning: %s: no {cc} in the sources, the route is the same for every country\n", cc)
+	}
+	return out
+}
+
+// countryName fills the placeholders of a name; an empty name becomes the
+// uppercase code.
+func countryName(name, cc string) string {
+	if name == "" {
+		return strings.ToUpper(cc)
+	}
+	return countryReplacer(cc).Replace(name)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+)
+
+// daemon rebuilds every profile on a schedule and delivers a profile only
+// when its route semantically changed (IDs differ on every build).
+// SIGHUP or POST /-/reload re-reads the config and triggers a rebuild.
+// Profile variants are switched on their own schedule.
+func daemon(args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	configPath := fs.String("config", "profiles.yaml", "Path to the profiles config")
+	once := fs.Bool("once", false, "Run a single build cycle and exit")
+	jobs := fs.Int("jobs", 4, "Number of sources fetched concurrently")
+	listen := fs.String("listen", "", "Address for the /-/reload endpoint, e.g. 127.0.0.1:8081 (disabled if empty)")
+	addLinkFlags(fs)
+	addInputFlags(fs)
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	_ = fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fail(err.Error())
+	}
+	if _, err := nextRun(cfg, time.Now()); err != nil && !*once {
+		fail(fmt.Sprintf("daemon: %v in %s", err, *configPath))
+	}
+
+	var current atomic.Pointer[Config]
+	current.Store(cfg)
+
+	wake := make(chan struct{}, 1)
+	reload := func() error {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		if _, err := nextRun(cfg, time.Now()); err != nil {
+			return err
+		}
+		current.Store(cfg)
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	if !*once {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := reload(); err != nil {
+					log.Printf("reload: %v", err)
+				}
+			}
+		}()
+	}
+
+	if *listen != "" && !*once {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /-/reload", func(w http.ResponseWriter, r *http.Request) {
+			if err := reload(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+		go func() {
+			log.Printf("listening on %s", *listen)
+			fail(http.ListenAndServe(*listen, mux).Error())
+		}()
+	}
+
+	last := make(map[string]Route)
+	alerted := make(map[string]time.Time)
+	for _, p := range cfg.Profiles {
+		if p.Output == "" {
+			continue
+		}
+		// Seed from the previous output so restarts don't redeliver.
+		if prev, err := loadRoute(p.Output); err == nil {
+			last[p.Name] = prev
+		}
+	}
+
+	for {
+		cfg := current.Load()
+		for _, p := range cfg.Profiles {
+			p, variant := p.at(time.Now())
+			if variant != "" {
+				log.Printf("%s: variant %s", p.Name, variant)
+			}
+			if err := rebuild(p, *jobs, last, alerted); err != nil {
+				log.Printf("%s: %v", p.Name, err)
+			}
+		}
+		if *once {
+			return
+		}
+
+		// A variant switch is delivered when it happens, not at the next
+		// scheduled build.
+		next, _ := nextRun(cfg, time.Now())
+		if sw := nextSwitch(cfg.Profiles, time.Now()); !sw.IsZero() && sw.Before(next) {
+			next = sw
+		}
+		log.Printf("next build at %s", next.Format(time.DateTime))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-wake:
+			timer.Stop()
+			log.Printf("config reloaded")
+		}
+	}
+}
+
+func nextRun(cfg *Config, now time.Time) (time.Time, error) {
+	if cfg.Daemon.Cron != "" {
+		cron, err := parseCron(cfg.Daemon.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		next := cron.next(now)
+		if next.IsZero() {
+			return next, errors.New("cron expression never fires")
+		}
+		return next, nil
+	}
+	if cfg.Daemon.Interval <= 0 {
+		return time.Time{}, errors.New("set daemon.interval or daemon.cron")
+	}
+	return now.Add(cfg.Daemon.Interval), nil
+}
+
+func rebuild(p Profile, jobs int, last map[string]Route, alerted map[string]time.Time) error {
+	res, err := buildProfile(p, jobs)
+	if err != nil {
+		return err
+	}
+	if err := alertStale(p, res.Stale, alerted); err != nil {
+		log.Printf("%s: stale alert: %v", p.Name, err)
+	}
+	route := res.Route
+
+	prev, seen := last[p.Name]
+	var changes []string
+	if seen {
+		if changes = diffRoutes(prev, route); len(changes) == 0 {
+			log.Printf("%s: no changes", p.Name)
+			return nil
+		}
+	}
+
+	link, err := p.encodeLink(route)
+	if err != nil {
+		return err
+	}
+	if err := deliver(p, link, changes); err != nil {
+		return fmt.Errorf("deliver: %w", err)
+	}
+	if err := recordHistory(link, "daemon "+p.Name, sourceHashes(res.Sources)); err != nil {
+		log.Printf("%s: history: %v", p.Name, err)
+	}
+
+	last[p.Name] = route
+	log.Printf("%s: delivered (%d changes)", p.Name, len(changes))
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/devemio/v2raytun-routing/atomicfile"
+	"github.com/devemio/v2raytun-routing/fetch"
+)
+
+// deliver pushes a changed link to every target configured in the profile.
+// The output file seeds the daemon state on restart, so it is written only
+// after the pushes succeeded; otherwise the next cycle retries all of them.
+func deliver(p Profile, link string, changes []string) error {
+	var errs []error
+	if p.Webhook != "" {
+		errs = append(errs, postWebhook(p.Webhook, p.Name, link, changes))
+	}
+	if p.Telegram != nil {
+		errs = append(errs, sendTelegram(*p.Telegram, p.Name, link, changes))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if p.Output != "" {
+		return atomicfile.WriteFile(p.Output, []byte(link))
+	}
+	return nil
+}
+
+func postWebhook(target, profile, link string, changes []string) error {
+	body, err := json.Marshal(map[string]any{
+		"profile": profile,
+		"link":    link,
+		"changes": changes,
+	})
+	if err != nil {
+		return err
+	}
+	return post(target, "application/json", body)
+}
+
+func sendTelegram(t Telegram, profile, link string, changes []string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Route %s updated", profile)
+	if len(changes) > 0 {
+		sb.WriteString(":\n")
+		for i, c := range changes {
+			if i == 20 {
+				fmt.Fprintf(&sb, "... and %d more\n", len(changes)-i)
+				break
+			}
+			sb.WriteString(c + "\n")
+		}
+	}
+	api := "https://api.telegram.org/bot" + t.Token
+	summary := strings.TrimRight(sb.String(), "\n")
+
+	if text := summary + "\n\n" + link; utf16Len(text) <= telegramTextLimit {
+		form := url.Values{"chat_id": {t.Chat}, "text": {text}}
+		return post(api+"/sendMessage", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	}
+
+	// Real links easily pass the message limit, so the link goes as a
+	// file with the summary as its caption.
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("chat_id", t.Chat)
+	_ = mw.WriteField("caption", truncateUTF16(summary, telegramCaptionLimit))
+	fw, err := mw.CreateFormFile("document", profile+".txt")
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write([]byte(link)); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	return post(api+"/sendDocument", mw.FormDataContentType(), body.Bytes())
+}
+
+// Telegram limits, counted in UTF-16 code units.
+const (
+	telegramTextLimit    = 4096
+	telegramCaptionLimit = 1024
+)
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// truncateUTF16 cuts s to at most n UTF-16 units, ending with "…" if cut.
+func truncateUTF16(s string, n int) string {
+	if utf16Len(s) <= n {
+		return s
+	}
+	used := 1 // the ellipsis
+	for i, r := range s {
+		if used+utf16.RuneLen(r) > n {
+			return s[:i] + "…"
+		}
+		used += utf16.RuneLen(r)
+	}
+	return s
+}
+
+func post(target, contentType string, body []byte) error {
+	client, err := fetch.Default.Client()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetch.Default.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Do not leak bot tokens into logs.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			return uerr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("post %s: %s", redact(target), resp.Status)
+	}
+	return nil
+}
+
+func redact(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "<invalid url>"
+	}
+	return u.Scheme + "://" + u.Host
+}
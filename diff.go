@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// exitChanged is returned by -diff-against when the routes differ, so
+// automation can tell "changed" apart from errors (exit code 1).
+const exitChanged = 2
+
+// diffRoutes describes semantic differences between two routes. IDs are
+// ignored since they are regenerated on every run.
+func diffRoutes(old, cur Route) []string {
+	var out []string
+
+	field := func(name, a, b string) {
+		if a != b {
+			out = append(out, fmt.Sprintf("~ %s: %q -> %q", name, a, b))
+		}
+	}
+	field("name", old.Name, cur.Name)
+	field("domainStrategy", old.DomainStrategy, cur.DomainStrategy)
+	field("domainMatcher", old.DomainMatcher, cur.DomainMatcher)
+	oldApps, curApps := old.Apps, cur.Apps
+	if oldApps == nil {
+		oldApps = &AppList{}
+	}
+	if curApps == nil {
+		curApps = &AppList{}
+	}
+	field("appList mode", oldApps.Mode, curApps.Mode)
+	added, removed := diffSets(oldApps.Packages, curApps.Packages)
+	for _, p := range added {
+		out = append(out, "+ app "+p)
+	}
+	for _, p := range removed {
+		out = append(out, "- app "+p)
+	}
+
+	oldRules := make(map[string]Rule, len(old.Rules))
+	var oldOrder []string
+	for i, r := range old.Rules {
+		k := ruleKey(r, i)
+		oldRules[k] = r
+		oldOrder = append(oldOrder, k)
+	}
+
+	var curOrder []string
+	for i, r := range cur.Rules {
+		k := ruleKey(r, i)
+		curOrder = append(curOrder, k)
+
+		o, ok := oldRules[k]
+		if !ok {
+			out = append(out, fmt.Sprintf("+ rule %s -> %s (%d domains)", k, r.OutboundTag, len(r.Domain)))
+			continue
+		}
+		delete(oldRules, k)
+
+		if o.OutboundTag != r.OutboundTag {
+			out = append(out, fmt.Sprintf("~ rule %s: outbound %s -> %s", k, o.OutboundTag, r.OutboundTag))
+		}
+		if o.Type != r.Type {
+			out = append(out, fmt.Sprintf("~ rule %s: type %s -> %s", k, o.Type, r.Type))
+		}
+		added, removed := diffSets(o.Domain, r.Domain)
+		for _, d := range added {
+			out = append(out, fmt.Sprintf("+ rule %s: %s", k, d))
+		}
+		for _, d := range removed {
+			out = append(out, fmt.Sprintf("- rule %s: %s", k, d))
+		}
+		added, removed = diffSets(o.IP, r.IP)
+		for _, d := range added {
+			out = append(out, fmt.Sprintf("+ rule %s: %s", k, d))
+		}
+		for _, d := range removed {
+			out = append(out, fmt.Sprintf("- rule %s: %s", k, d))
+		}
+		added, removed = diffSets(o.Source, r.Source)
+		for _, s := range added {
+			out = append(out, fmt.Sprintf("+ rule %s: source %s", k, s))
+		}
+		for _, s := range removed {
+			out = append(out, fmt.Sprintf("- rule %s: source %s", k, s))
+		}
+	}
+
+	for _, k := range oldOrder {
+		if r, ok := oldRules[k]; ok {
+			out = append(out, fmt.Sprintf("- rule %s -> %s (%d domains)", k, r.OutboundTag, len(r.Domain)))
+		}
+	}
+
+	// First-match semantics make reordering of surviving rules a change too.
+	oldCommon, curCommon := commonOrder(oldOrder, curOrder), commonOrder(curOrder, oldOrder)
+	if strings.Join(oldCommon, "\x00") != strings.Join(curCommon, "\x00") {
+		out = append(out, fmt.Sprintf("~ rule order: %s -> %s", strings.Join(oldCommon, ", "), strings.Join(curCommon, ", ")))
+	}
+
+	return out
+}
+
+func ruleKey(r Rule, i int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// commonOrder returns the elements of a that are also in b, in a's order.
+func commonOrder(a, b []string) []string {
+	inB := make(map[string]struct{}, len(b))
+	for _, s := range b {
+		inB[s] = struct{}{}
+	}
+	var out []string
+	for _, s := range a {
+		if _, ok := inB[s]; ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// diffSets returns elements only in b (added) and only in a (removed),
+// preserving input order.
+func diffSets(a, b []string) (added, removed []string) {
+	inA := make(map[string]struct{}, len(a))
+	for _, s := range a {
+		inA[s] = struct{}{}
+	}
+	inB := make(map[string]struct{}, len(b))
+	for _, s := range b {
+		inB[s] = struct{}{}
+		if _, ok := inA[s]; !ok {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a {
+		if _, ok := inB[s]; !ok {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
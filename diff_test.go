@@ -0,0 +1,37 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffRoutes(t *testing.T) {
+	old := Route{Name: "R", Rules: []Rule{
+		{Name: "Ads", OutboundTag: "block", Domain: []string{"geosite:category-ads-all"}},
+		{Name: "Direct", OutboundTag: "direct", Domain: []string{"a.ru", "b.ru"}},
+		{Name: "Proxy", OutboundTag: "proxy", Domain: []string{"x.com"}},
+	}}
+	cur := Route{Name: "R2", Apps: &AppList{Mode: "bypass", Packages: []string{"com.bank"}}, Rules: []Rule{
+		{Name: "Ads", OutboundTag: "block", Domain: []string{"geosite:category-ads-all"}},
+		{Name: "Proxy", OutboundTag: "proxy", Domain: []string{"x.com"}, IP: []string{"10.0.0.0/8"}},
+		{Name: "Direct", OutboundTag: "proxy", Domain: []string{"a.ru", "c.ru"}},
+		{Name: "Video", OutboundTag: "proxy", Domain: []string{"v.com"}},
+	}}
+	want := []string{
+		`~ name: "R" -> "R2"`,
+		`~ appList mode: "" -> "bypass"`,
+		"+ app com.bank",
+		"+ rule Proxy: 10.0.0.0/8",
+		"~ rule Direct: outbound direct -> proxy",
+		"+ rule Direct: c.ru",
+		"- rule Direct: b.ru",
+		"+ rule Video -> proxy (1 domains)",
+		"~ rule order: Ads, Direct, Proxy -> Ads, Proxy, Direct",
+	}
+	if got := diffRoutes(old, cur); !slices.Equal(got, want) {
+		t.Errorf("diffRoutes:\n got %q\nwant %q", got, want)
+	}
+	if got := diffRoutes(cur, cur); len(got) != 0 {
+		t.Errorf("diffRoutes of a route with itself = %q, want nothing", got)
+	}
+}
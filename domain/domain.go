@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize accepts:
+//   - pure host: sub.example.com
+//   - host:port, [ipv6]:port, bare IPv6
+//   - URL with any scheme (http, https, ws, wss, ftp, socks5, ...),
+//     with or without userinfo
+//   - scheme-less URL: example.com/path?q, user@example.com:8080
+//
+// Returns lowercase host without port, brackets or trailing dot;
+// internationalized names are NFC-normalized and converted to punycode.
+func Normalize(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", errors.New("empty")
+	}
+
+	if ip := net.ParseIP(strings.Trim(s, "[]")); ip != nil {
+		return cleanHost(ip.String())
+	}
+
+	if !strings.Contains(s, "://") {
+		// host:port and scheme-less URLs parse as network-path references.
+		s = "//" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Host == "" {
+		// e.g. "mailto:x" or "scheme://" with nothing after it
+		return "", fmt.Errorf("no host in %q", s)
+	}
+	return cleanHost(u.Hostname())
+}
+
+func cleanHost(host string) (string, error) {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", errors.New("empty host after normalization")
+	}
+	if strings.ContainsAny(host, " \t/\\") {
+		return "", fmt.Errorf("invalid host: %q", host)
+	}
+	if !isASCII(host) {
+		// NFC first, so that composed and decomposed forms of the same
+		// name end up as one punycode entry.
+		a, err := idna.Lookup.ToASCII(norm.NFC.String(host))
+		if err != nil {
+			return "", fmt.Errorf("invalid international host %q: %w", host, err)
+		}
+		host = a
+	}
+	return host, nil
+}
+
+// Extract pulls the domain out of email addresses (user@example.com,
+// mailto:...) and SRV-style names (_sip._tcp.example.com), which lists
+// copied from documentation often contain. ok is false for anything else.
+func Extract(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if rest, found := strings.CutPrefix(strings.ToLower(s), "mailto:"); found {
+		s = rest
+	}
+
+	if !strings.Contains(s, "://") && !strings.Contains(s, "/") {
+		if i := strings.LastIndex(s, "@"); i >= 0 {
+			return strings.TrimSpace(s[i+1:]), true
+		}
+	}
+
+	host, err := Normalize(s)
+	if err != nil || !strings.HasPrefix(host, "_") {
+		return "", false
+	}
+	for strings.HasPrefix(host, "_") {
+		_, rest, found := strings.Cut(host, ".")
+		if !found {
+			return "", false
+		}
+		host = rest
+	}
+	return host, true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "Example.COM", want: "example.com"},
+		{in: "  example.com.  ", want: "example.com"},
+		{in: "https://www.Example.com:8443/path?q=1", want: "www.example.com"},
+		{in: "example.com:443", want: "example.com"},
+		{in: "example.com/path", want: "example.com"},
+		{in: "1.2.3.4", want: "1.2.3.4"},
+		{in: "[2001:DB8::1]", want: "2001:db8::1"},
+		{in: "Пример.рф", want: "xn--e1afmkfd.xn--p1ai"},
+		{in: "xn--e1afmkfd.xn--p1ai", want: "xn--e1afmkfd.xn--p1ai"},
+		{in: "", wantErr: true},
+		{in: "https://", wantErr: true},
+		{in: "mailto:x", wantErr: true},
+		{in: "a b.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Normalize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		} else if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"user@example.com", "example.com", true},
+		{"mailto:Support@Bank.ru", "bank.ru", true},
+		{"_sip._tcp.example.com", "example.com", true},
+		{"_dmarc.example.com", "example.com", true},
+		{"example.com", "", false},
+		{"https://user@example.com/", "", false},
+		{"_only", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := Extract(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Extract(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// latinLookalikes maps Cyrillic and Greek letters to the Latin letter
+// they are usually mistaken for.
+var latinLookalikes = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i',
+	'ј': 'j', 'ԁ': 'd', 'һ': 'h', 'ӏ': 'l', 'ԛ': 'q', 'ԝ': 'w', 'ь': 'b',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+}
+
+// Skeleton reduces a host (punycode or Unicode) to the Latin string it
+// looks like, so that homoglyphs of each other share a skeleton.
+func Skeleton(host string) string {
+	if u, err := idna.ToUnicode(host); err == nil {
+		host = u
+	}
+	return strings.Map(func(r rune) rune {
+		if l, ok := latinLookalikes[r]; ok {
+			return l
+		}
+		return r
+	}, host)
+}
+
+// MixedScript reports whether a label of host mixes letters of several
+// scripts, e.g. Latin with a Cyrillic "а".
+func MixedScript(host string) bool {
+	if u, err := idna.ToUnicode(host); err == nil {
+		host = u
+	}
+	for _, label := range strings.Split(host, ".") {
+		var script *unicode.RangeTable
+		for _, r := range label {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			s := scriptOf(r)
+			if script != nil && s != script {
+				return true
+			}
+			script = s
+		}
+	}
+	return false
+}
+
+func scriptOf(r rune) *unicode.RangeTable {
+	for _, t := range []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek} {
+		if unicode.Is(t, r) {
+			return t
+		}
+	}
+	return nil
+}
+
+// Homoglyphs remembers hosts by skeleton to spot lookalikes of earlier
+// entries, as happens with lists crowd-sourced over chats.
+type Homoglyphs map[string]string
+
+// Check records host and returns an earlier, different host it looks
+// like, if either of them mixes scripts.
+func (h Homoglyphs) Check(host string) (string, bool) {
+	sk := Skeleton(host)
+	prev, ok := h[sk]
+	if !ok {
+		h[sk] = host
+		return "", false
+	}
+	if prev == host || !(MixedScript(host) || MixedScript(prev)) {
+		return "", false
+	}
+	return prev, true
+}
@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redirectors maps hosts of known tracking wrappers to the query
+// parameter that carries the destination URL. The google.* entries
+// cover country domains such as google.co.uk.
+var redirectors = map[string][]string{
+	"l.facebook.com":        {"u"},
+	"lm.facebook.com":       {"u"},
+	"l.messenger.com":       {"u"},
+	"l.instagram.com":       {"u"},
+	"l.threads.net":         {"u"},
+	"vk.com":                {"to"},
+	"m.vk.com":              {"to"},
+	"away.vk.com":           {"to"},
+	"youtube.com":           {"q"},
+	"www.youtube.com":       {"q"},
+	"slack-redir.net":       {"url"},
+	"steamcommunity.com":    {"url"},
+	"href.li":               nil, // destination follows "?"
+	"out.reddit.com":        {"url"},
+	"click.linksynergy.com": {"murl"},
+	"google.*":              {"q", "url"},
+	"www.google.*":          {"q", "url"},
+}
+
+// shorteners only reveal the destination via an HTTP redirect.
+var shorteners = map[string]bool{
+	"t.co":        true,
+	"bit.ly":      true,
+	"goo.gl":      true,
+	"tinyurl.com": true,
+	"vk.cc":       true,
+	"clck.ru":     true,
+	"ow.ly":       true,
+	"is.gd":       true,
+}
+
+// Unwrap returns the destination URL of a known redirector such as
+// l.facebook.com/l.php?u=... or google.com/url?q=..., following nested
+// wrappers. Anything else is returned unchanged.
+func Unwrap(s string) string {
+	for range 5 {
+		next, ok := unwrapOnce(s)
+		if !ok {
+			break
+		}
+		s = next
+	}
+	return s
+}
+
+func unwrapOnce(s string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	params, ok := redirectorParams(strings.ToLower(u.Hostname()), u.Path)
+	if !ok {
+		return "", false
+	}
+	if params == nil {
+		if dest, err := url.QueryUnescape(u.RawQuery); err == nil && strings.Contains(dest, "://") {
+			return dest, true
+		}
+		return "", false
+	}
+	q := u.Query()
+	for _, p := range params {
+		if dest := q.Get(p); strings.Contains(dest, "://") {
+			return dest, true
+		}
+	}
+	return "", false
+}
+
+func redirectorParams(host, path string) ([]string, bool) {
+	if p, ok := redirectors[host]; ok {
+		return p, true
+	}
+	if path != "/url" {
+		return nil, false
+	}
+	// google.com/url, google.co.uk/url, www.google.ru/url, ...
+	for _, prefix := range []string{"google.", "www.google."} {
+		if rest, ok := strings.CutPrefix(host, prefix); ok && rest != "" && len(rest) <= 6 {
+			return redirectors[prefix+"*"], true
+		}
+	}
+	return nil, false
+}
+
+// IsShortener reports whether s points at a link shortener whose
+// destination can only be learned with Expand.
+func IsShortener(s string) bool {
+	host, err := Normalize(s)
+	return err == nil && shorteners[host]
+}
+
+// Expand asks a shortener where s leads without following the redirect.
+func Expand(c *http.Client, s string) (string, error) {
+	return ExpandContext(context.Background(), c, s)
+}
+
+// ExpandContext is Expand with ctx bounding the request.
+func ExpandContext(ctx context.Context, c *http.Client, s string) (string, error) {
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	nc := *c
+	nc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := nc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", errors.New("no redirect from " + s)
+	}
+	return loc, nil
+}
+
+// Resolve unwraps s and, if it is a shortener, expands it with c. On
+// error s is returned unwrapped as far as possible.
+func Resolve(c *http.Client, s string) (string, error) {
+	return ResolveContext(context.Background(), c, s)
+}
+
+// ResolveContext is Resolve with ExpandContext.
+func ResolveContext(ctx context.Context, c *http.Client, s string) (string, error) {
+	s = Unwrap(s)
+	if !IsShortener(s) {
+		return s, nil
+	}
+	dest, err := ExpandContext(ctx, c, s)
+	if err != nil {
+		return s, err
+	}
+	return Unwrap(dest), nil
+}
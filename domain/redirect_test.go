@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnwrap(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com%2Fa&h=x", "https://example.com/a"},
+		{"https://www.google.co.uk/url?q=https://example.com/&sa=D", "https://example.com/"},
+		{"https://google.com/url?url=https://example.com/", "https://example.com/"},
+		{"https://vk.com/away.php?to=https%3A%2F%2Fexample.com", "https://example.com"},
+		{"https://href.li/?https://example.com/x", "https://example.com/x"},
+		// Nested wrappers are followed.
+		{"https://l.facebook.com/l.php?u=" + "https%3A%2F%2Fwww.google.com%2Furl%3Fq%3Dhttps%3A%2F%2Fexample.com", "https://example.com"},
+		{"https://google.com/search?q=https://example.com", "https://google.com/search?q=https://example.com"},
+		{"https://www.google.verylongtld/url?q=https://example.com", "https://www.google.verylongtld/url?q=https://example.com"},
+		{"https://vk.com/away.php?to=not-a-url", "https://vk.com/away.php?to=not-a-url"},
+		{"example.com", "example.com"},
+	}
+	for _, tt := range tests {
+		if got := Unwrap(tt.in); got != tt.want {
+			t.Errorf("Unwrap(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsShortener(t *testing.T) {
+	for s, want := range map[string]bool{
+		"https://t.co/abc": true,
+		"bit.ly/x":         true,
+		"T.CO":             true,
+		"example.com":      false,
+		"sub.bit.ly/x":     false,
+	} {
+		if got := IsShortener(s); got != want {
+			t.Errorf("IsShortener(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method = %s, want HEAD", r.Method)
+		}
+		if r.URL.Path == "/none" {
+			return
+		}
+		http.Redirect(w, r, "https://example.com/dest", http.StatusMovedPermanently)
+	}))
+	defer srv.Close()
+
+	got, err := Expand(srv.Client(), srv.URL+"/abc")
+	if err != nil || got != "https://example.com/dest" {
+		t.Errorf("Expand = %q, %v; want https://example.com/dest", got, err)
+	}
+	if _, err := Expand(srv.Client(), srv.URL+"/none"); err == nil {
+		t.Error("Expand without a redirect succeeded, want an error")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// routeCmd edits an existing link: route add|remove <link|file> host...
+func routeCmd(args []string) {
+	usage := "usage: go run . route add|remove [-o file] <link|file> host... (- reads hosts from stdin)"
+	if len(args) == 0 {
+		fail(usage)
+	}
+
+	fs := flag.NewFlagSet("route "+args[0], flag.ExitOnError)
+	outPath := fs.String("o", "", "Write the new link to this file (atomically) instead of stdout")
+	ruleName := fs.String("rule-name", "", "Target the rule with this name; add creates it if missing")
+	ruleID := fs.String("rule-id", "", "Target the rule with this ID")
+	outbound := fs.String("outbound", "direct", "Outbound of a rule created by -rule-name")
+	addLinkFlags(fs)
+	_ = fs.Parse(args[1:])
+	if fs.NArg() < 2 {
+		fail(usage)
+	}
+
+	route, err := loadRoute(fs.Arg(0))
+	if err != nil {
+		fail(err.Error())
+	}
+	hosts, err := inputDomains(fs.Args()[1:], "")
+	if err != nil {
+		fail(err.Error())
+	}
+
+	i := -1
+	if *ruleName != "" || *ruleID != "" {
+		if i = findRule(route, *ruleName, *ruleID); i < 0 && (args[0] != "add" || *ruleName == "") {
+			fail("no such rule in route")
+		}
+	}
+
+	switch args[0] {
+	case "add":
+		if i < 0 && *ruleName != "" {
+			route.Rules = append(route.Rules, Rule{
+				ID:          uuid.NewString(),
+				Type:        "field",
+				OutboundTag: *outbound,
+				Name:        *ruleName,
+			})
+			i = len(route.Rules) - 1
+			fmt.Fprintf(os.Stderr, "created rule %s -> %s\n", *ruleName, *outbound)
+		} else if i < 0 {
+			if i = targetRule(route); i < 0 {
+				fail("route has no rules to add domains to")
+			}
+		}
+		added := addDomains(&route.Rules[i], route, hosts)
+		fmt.Fprintf(os.Stderr, "added %d domains to %s\n", added, ruleLabel(route.Rules[i]))
+	case "remove":
+		removed := removeDomains(&route, hosts, i)
+		fmt.Fprintf(os.Stderr, "removed %d entries\n", removed)
+	default:
+		fail(usage)
+	}
+
+	link, err := encodeLink(route)
+	if err != nil {
+		fail(err.Error())
+	}
+	out := openOutput(*outPath)
+	fmt.Fprint(out, link)
+	out.commit()
+}
+
+// findRule looks a rule up by ID or, case-insensitively, by name.
+func findRule(route Route, name, id string) int {
+	for i, r := range route.Rules {
+		if (id != "" && r.ID == id) || (id == "" && strings.EqualFold(r.Name, name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// targetRule picks the first rule that does not block, since the ads rule
+// comes first in generated routes.
+func targetRule(route Route) int {
+	for i, r := range route.Rules {
+		if r.OutboundTag != "block" {
+			return i
+		}
+	}
+	return len(route.Rules) - 1
+}
+
+// addDomains appends hosts not already present anywhere in the route.
+func addDomains(rule *Rule, route Route, hosts []string) int {
+	seen := make(map[string]struct{})
+	for _, r := range route.Rules {
+		for _, e := range r.Domain {
+			seen[e] = struct{}{}
+		}
+	}
+
+	n := 0
+	for _, h := range hosts {
+		if _, ok := seen[h]; ok {
+			fmt.Fprintf(os.Stderr, "warning: %s is already in the route\n", h)
+			continue
+		}
+		seen[h] = struct{}{}
+		rule.Domain = append(rule.Domain, h)
+		n++
+	}
+	return n
+}
+
+// removeDomains drops a host's plain, domain: and full: entries from rule
+// only (every rule if only < 0); rules left empty are dropped.
+func removeDomains(route *Route, hosts []string, only int) int {
+	drop := make(map[string]struct{}, 3*len(hosts))
+	for _, h := range hosts {
+		drop[h] = struct{}{}
+		drop["domain:"+h] = struct{}{}
+		drop["full:"+h] = struct{}{}
+	}
+
+	n := 0
+	rules := route.Rules[:0]
+	for i, r := range route.Rules {
+		if only >= 0 && i != only {
+			rules = append(rules, r)
+			continue
+		}
+		kept := r.Domain[:0]
+		for _, e := range r.Domain {
+			if _, ok := drop[strings.ToLower(e)]; ok {
+				n++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		r.Domain = kept
+		if len(r.Domain)+len(r.IP) > 0 {
+			rules = append(rules, r)
+		}
+	}
+	route.Rules = rules
+	return n
+}
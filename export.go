@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/geosite"
+)
+
+// Entry kinds of the common export model. Plain hosts from the lists are
+// exported as suffixes: that is what a list entry means, even though
+// v2ray itself matches them as substrings.
+const (
+	entrySuffix  = "suffix"
+	entryFull    = "full"
+	entryKeyword = "keyword"
+	entryRegexp  = "regexp"
+	entryIP      = "ip" // address or CIDR
+)
+
+type exportEntry struct {
+	Kind  string
+	Value string
+}
+
+// exportRule is a route rule reduced to what other clients understand.
+type exportRule struct {
+	Name     string
+	Outbound string
+	Entries  []exportEntry
+	Process  []string // process names and paths
+	Source   []string // client addresses or CIDRs
+}
+
+// exportFormat writes rules for another client. Formats without a
+// policy per line hold a single rule; blocklists take the block rules.
+// Native formats speak v2ray syntax and read job.Native, with geosite
+// selectors left as they are. Only desktop formats match process names
+// and client addresses.
+type exportFormat struct {
+	policy    bool
+	blocklist bool
+	native    bool
+	desktop   bool
+	write     func(w io.Writer, job exportJob) error
+}
+
+// exportOptions come from the command line.
+type exportOptions struct {
+	Format   string
+	Rules    string // names, comma-separated
+	Resolver string // DNS server for forwarding formats
+	Set      string // address list or set name, the outbound if empty
+	Address  string // answer for cloaking formats
+
+	PACProxy   string // PAC return value for outbounds other than direct and block
+	PACDefault string // PAC return value for hosts no rule matches
+
+	DNS        outboundMap // outbound -> DNS server for v2ray-dns
+	DNSDefault string      // server for everything else
+
+	FakeDNS        bool   // v2ray-dns answers with fakedns except for FakeDNSSection
+	FakeDNSSection string // input [section] with hosts that must get real addresses
+}
+
+// exportJob is what a format writes.
+type exportJob struct {
+	exportOptions
+	Name     string // route name
+	Rules    []exportRule
+	Native   []Rule              // the picked rules as they are, for native formats
+	Sections map[string][]string // [section] name -> hosts from the input lists
+}
+
+func addExportFlags(fs *flag.FlagSet, o *exportOptions) {
+	fs.StringVar(&o.Format, "format", "link", "Output format: link, or rules for another client: "+exportFormatNames())
+	fs.StringVar(&o.Rules, "rule", "", "Rules to export with -format, by name (comma-separated); single-rule formats default to the only non-block rule")
+	fs.StringVar(&o.Resolver, "resolver", "1.1.1.1", "DNS server that DNS forwarding formats send the domains to")
+	fs.StringVar(&o.Address, "address", "0.0.0.0", "Address that cloaking formats answer with for the domains")
+	fs.StringVar(&o.PACProxy, "pac-proxy", "SOCKS5 127.0.0.1:10808; SOCKS 127.0.0.1:10808", "PAC return value for rules with a proxy outbound")
+	fs.StringVar(&o.PACDefault, "pac-default", "DIRECT", "PAC return value for hosts no rule matches")
+	fs.StringVar(&o.Set, "set", "", "Address list or firewall set name for the formats that fill one (default: the rule outbound)")
+	fs.Var(&o.DNS, "dns", "DNS server for the domains of rules with an outbound, e.g. direct=77.88.8.8 or proxy=https://1.1.1.1/dns-query (repeatable, v2ray-dns)")
+	fs.StringVar(&o.DNSDefault, "dns-default", "https://1.1.1.1/dns-query", "DNS server for all other domains (v2ray-dns)")
+	fs.BoolVar(&o.FakeDNS, "fakedns", false, "Answer with fakedns, except for hosts in the -fakedns-section of the input, which -dns-default resolves (v2ray-dns)")
+	fs.StringVar(&o.FakeDNSSection, "fakedns-section", "no-fakedns", "Input [section] with hosts that must never be faked, e.g. banking apps with certificate pinning")
+}
+
+// setName is the address list or set for rule r.
+func (j exportJob) setName(r exportRule) string {
+	if j.Set != "" {
+		return j.Set
+	}
+	return r.Outbound
+}
+
+var exportFormats = map[string]exportFormat{
+	"surge-domain-set":    {write: writeSurgeDomainSet},
+	"surge-rule-set":      {write: writeSurgeRuleSet},
+	"quanx":               {policy: true, write: writeQuanX},
+	"shadowrocket":        {policy: true, write: writeShadowrocket},
+	"loon":                {policy: true, write: writeLoonPlugin},
+	"stash":               {write: writeStashProvider},
+	"routeros":            {policy: true, write: writeRouterOS},
+	"nftables":            {policy: true, write: writeNftables},
+	"ipset":               {policy: true, write: writeIpset},
+	"unbound":             {policy: true, write: writeUnbound},
+	"smartdns":            {policy: true, write: writeSmartDNS},
+	"hosts":               {blocklist: true, write: writeHostsBlocklist},
+	"adguard":             {blocklist: true, write: writeAdGuardBlocklist},
+	"dnscrypt-forwarding": {policy: true, write: writeDNSCryptForwarding},
+	"dnscrypt-cloaking":   {blocklist: true, write: writeDNSCryptCloaking},
+	"dnsmasq":             {policy: true, write: writeDnsmasqNftset},
+	"dnsmasq-ipset":       {policy: true, write: writeDnsmasqIpset},
+	"squid":               {write: writeSquid},
+	"pac":                 {policy: true, write: writePAC},
+	"v2ray-dns":           {policy: true, native: true, write: writeV2rayDNS},
+	"fakedns-exclude":     {policy: true, native: true, write: writeFakeDNSExclude},
+	"xray":                {policy: true, native: true, desktop: true, write: writeXrayRouting},
+	"sing-box":            {policy: true, desktop: true, write: writeSingBox},
+}
+
+func exportFormatNames() string {
+	return strings.Join(slices.Sorted(maps.Keys(exportFormats)), ", ")
+}
+
+// exportRoute converts the route with f. names picks rules by name
+// (comma-separated); by default single-rule formats take the one rule
+// that is not block and blocklists take the block rules. Geosite
+// selectors are expanded with m, or dropped with a warning without it.
+// sections are the [section] hosts of the input.
+func exportRoute(w io.Writer, route Route, o exportOptions, m *geosite.Matcher, sections map[string][]string) error {
+	format, names := o.Format, o.Rules
+	f, ok := exportFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q (want link, %s)", format, exportFormatNames())
+	}
+
+	var picked []Rule
+	for _, r := range route.Rules {
+		if len(r.Source) > 0 && !f.desktop {
+			fmt.Fprintf(os.Stderr, "warning: %s: rule %s skipped, source subnets not supported\n", format, ruleLabel(r))
+			continue
+		}
+		switch {
+		case names != "":
+			if slices.ContainsFunc(strings.Split(names, ","), func(n string) bool {
+				return strings.EqualFold(strings.TrimSpace(n), ruleLabel(r))
+			}) {
+				picked = append(picked, r)
+			}
+		case f.blocklist:
+			if r.OutboundTag == "block" {
+				picked = append(picked, r)
+			}
+		case f.policy || r.OutboundTag != "block":
+			picked = append(picked, r)
+		}
+	}
+	if len(picked) == 0 {
+		switch {
+		case names != "":
+			return fmt.Errorf("no rule named %q", names)
+		case f.blocklist:
+			return errors.New("route has no rule with outbound block")
+		default:
+			return errors.New("route has no rules to export")
+		}
+	}
+	if !f.policy && !f.blocklist && len(picked) > 1 {
+		labels := make([]string, len(picked))
+		for i, r := range picked {
+			labels[i] = ruleLabel(r)
+		}
+		return fmt.Errorf("%s holds one rule, pick it with -rule (have %s)", format, strings.Join(labels, ", "))
+	}
+
+	job := exportJob{exportOptions: o, Name: route.Name, Native: picked, Sections: sections}
+	processes := 0
+	for _, r := range picked {
+		processes += len(r.Process)
+		if !f.native {
+			job.Rules = append(job.Rules, toExportRule(r, m))
+		}
+	}
+	if processes > 0 && !f.desktop {
+		fmt.Fprintf(os.Stderr, "warning: %s: %d process entries skipped, not supported\n", format, processes)
+	}
+	return f.write(w, job)
+}
+
+func toExportRule(r Rule, m *geosite.Matcher) exportRule {
+	out := exportRule{Name: ruleLabel(r), Outbound: r.OutboundTag, Process: r.Process, Source: r.Source}
+	for _, e := range r.IP {
+		if isIP(e) {
+			out.Entries = append(out.Entries, exportEntry{entryIP, e})
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "warning: rule %s: %s cannot be exported\n", out.Name, e)
+	}
+	for _, e := range r.Domain {
+		if isIP(e) {
+			out.Entries = append(out.Entries, exportEntry{entryIP, e})
+			continue
+		}
+		kind, val, ok := strings.Cut(e, ":")
+		if !ok {
+			out.Entries = append(out.Entries, exportEntry{entrySuffix, e})
+			continue
+		}
+		switch kind {
+		case "domain":
+			out.Entries = append(out.Entries, exportEntry{entrySuffix, val})
+		case "full":
+			out.Entries = append(out.Entries, exportEntry{entryFull, val})
+		case "keyword":
+			out.Entries = append(out.Entries, exportEntry{entryKeyword, val})
+		case "regexp":
+			out.Entries = append(out.Entries, exportEntry{entryRegexp, val})
+		case "geosite":
+			if m == nil {
+				fmt.Fprintf(os.Stderr, "warning: rule %s: %s dropped, expanding selectors needs -geosite\n", out.Name, e)
+				continue
+			}
+			for _, d := range m.Rules(e) {
+				out.Entries = append(out.Entries, geositeEntry(int32(d.GetType()), d.GetValue()))
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "warning: rule %s: %s cannot be exported\n", out.Name, e)
+		}
+	}
+	return out
+}
+
+func isIP(s string) bool {
+	if _, _, err := net.ParseCIDR(s); err == nil {
+		return true
+	}
+	return net.ParseIP(s) != nil
+}
+
+// geositeEntry maps geosite rule types by number, see geosite.MatchRule.
+func geositeEntry(t int32, val string) exportEntry {
+	val = strings.ToLower(strings.TrimSuffix(val, "."))
+	switch t {
+	case 1:
+		return exportEntry{entryRegexp, val}
+	case 2:
+		return exportEntry{entrySuffix, val}
+	case 3:
+		return exportEntry{entryFull, val}
+	default:
+		return exportEntry{entryKeyword, val}
+	}
+}
+
+// writeLines writes one line per entry; line returns "" for entries the
+// format cannot express, which are reported once per kind.
+func writeLines(w io.Writer, format string, rules []exportRule, line func(r exportRule, e exportEntry) string) error {
+	skipped := make(map[string]int)
+	for _, r := range rules {
+		for _, e := range r.Entries {
+			s := line(r, e)
+			if s == "" {
+				skipped[e.Kind]++
+				continue
+			}
+			if _, err := fmt.Fprintln(w, s); err != nil {
+				return err
+			}
+		}
+	}
+	for _, kind := range slices.Sorted(maps.Keys(skipped)) {
+		fmt.Fprintf(os.Stderr, "warning: %s: %d %s entries skipped, not supported\n", format, skipped[kind], kind)
+	}
+	return nil
+}
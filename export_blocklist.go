@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Blocklists for Pi-hole and AdGuard Home, so DNS-level blocking follows
+// the block rules of the route.
+
+// writeHostsBlocklist writes 0.0.0.0 lines; hosts files cannot match
+// subdomains, so suffix entries block only the name itself.
+func writeHostsBlocklist(w io.Writer, job exportJob) error {
+	return writeBlocklist(w, job, "hosts", "#", func(e exportEntry) string {
+		if e.Kind == entrySuffix || e.Kind == entryFull {
+			return "0.0.0.0 " + e.Value
+		}
+		return ""
+	})
+}
+
+// writeAdGuardBlocklist uses the adblock-style syntax AdGuard Home and
+// Pi-hole v6 understand.
+func writeAdGuardBlocklist(w io.Writer, job exportJob) error {
+	return writeBlocklist(w, job, "adguard", "!", func(e exportEntry) string {
+		switch e.Kind {
+		case entrySuffix:
+			return "||" + e.Value + "^"
+		case entryFull:
+			return "|" + e.Value + "^"
+		case entryKeyword:
+			return e.Value
+		case entryRegexp:
+			return "/" + e.Value + "/"
+		}
+		return ""
+	})
+}
+
+// writeBlocklist puts a header with the list metadata before the lines.
+func writeBlocklist(w io.Writer, job exportJob, format, comment string, line func(exportEntry) string) error {
+	var body strings.Builder
+	err := writeLines(&body, format, job.Rules, func(_ exportRule, e exportEntry) string { return line(e) })
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(job.Rules))
+	for i, r := range job.Rules {
+		names[i] = r.Name
+	}
+	fmt.Fprintf(w, "%s Title: %s (%s)\n", comment, job.Name, strings.Join(names, ", "))
+	fmt.Fprintf(w, "%s Description: block rules of the v2rayTun route, generated by v2raytun-routing\n", comment)
+	fmt.Fprintf(w, "%s Last modified: %s\n", comment, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "%s Entries: %d\n\n", comment, strings.Count(body.String(), "\n"))
+	_, err = io.WriteString(w, body.String())
+	return err
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Routing sections for the desktop and router cores, Xray and sing-box.
+// Unlike the mobile client they can match the local process that opened
+// the connection and the client address, so process: entries and subnet
+// rules are exported too. Fields of one rule are ANDed by both cores,
+// hence domains, addresses and processes of a route rule become separate
+// rules next to each other.
+
+// xrayRule is a rule of the Xray routing object.
+type xrayRule struct {
+	Type        string   `json:"type"`
+	Domain      []string `json:"domain,omitempty"`
+	IP          []string `json:"ip,omitempty"`
+	Process     []string `json:"process,omitempty"`
+	Source      []string `json:"source,omitempty"`
+	OutboundTag string   `json:"outboundTag"`
+	RuleTag     string   `json:"ruleTag,omitempty"`
+}
+
+// writeXrayRouting writes the routing section of an Xray config. Entries
+// keep the v2ray syntax, geosite selectors included; the process field
+// takes names (discord.exe) and full paths alike.
+func writeXrayRouting(w io.Writer, job exportJob) error {
+	var rules []xrayRule
+	for _, r := range job.Native {
+		var domains []string
+		ips := slices.Clone(r.IP)
+		for _, e := range r.Domain {
+			if isIP(e) {
+				ips = append(ips, e)
+			} else {
+				domains = append(domains, e)
+			}
+		}
+		for _, part := range []xrayRule{{Domain: domains}, {IP: ips}, {Process: r.Process}} {
+			if len(part.Domain)+len(part.IP)+len(part.Process) == 0 {
+				continue
+			}
+			part.Type, part.OutboundTag, part.RuleTag = "field", r.OutboundTag, ruleLabel(r)
+			part.Source = r.Source
+			rules = append(rules, part)
+		}
+	}
+	return writeJSON(w, map[string]any{"routing": map[string]any{"domainStrategy": "AsIs", "rules": rules}})
+}
+
+// singBoxRule is a route rule of sing-box 1.11 or later.
+type singBoxRule struct {
+	Domain        []string `json:"domain,omitempty"`
+	DomainSuffix  []string `json:"domain_suffix,omitempty"`
+	DomainKeyword []string `json:"domain_keyword,omitempty"`
+	DomainRegex   []string `json:"domain_regex,omitempty"`
+	IPCIDR        []string `json:"ip_cidr,omitempty"`
+	ProcessName   []string `json:"process_name,omitempty"`
+	ProcessPath   []string `json:"process_path,omitempty"`
+	SourceIPCIDR  []string `json:"source_ip_cidr,omitempty"`
+	Action        string   `json:"action,omitempty"`
+	Outbound      string   `json:"outbound,omitempty"`
+}
+
+// writeSingBox writes the route section of a sing-box config. Geosite
+// selectors are expanded, since sing-box dropped geosite; block rules
+// use the reject action. Entries with a path separator are process paths.
+func writeSingBox(w io.Writer, job exportJob) error {
+	var rules []singBoxRule
+	for _, r := range job.Rules {
+		var hosts, ips, procs singBoxRule
+		for _, e := range r.Entries {
+			switch e.Kind {
+			case entrySuffix:
+				hosts.DomainSuffix = append(hosts.DomainSuffix, e.Value)
+			case entryFull:
+				hosts.Domain = append(hosts.Domain, e.Value)
+			case entryKeyword:
+				hosts.DomainKeyword = append(hosts.DomainKeyword, e.Value)
+			case entryRegexp:
+				hosts.DomainRegex = append(hosts.DomainRegex, e.Value)
+			case entryIP:
+				ips.IPCIDR = append(ips.IPCIDR, e.Value)
+			}
+		}
+		for _, p := range r.Process {
+			if strings.ContainsAny(p, `/\`) {
+				procs.ProcessPath = append(procs.ProcessPath, p)
+			} else {
+				procs.ProcessName = append(procs.ProcessName, p)
+			}
+		}
+		for _, part := range []singBoxRule{hosts, ips, procs} {
+			if part.empty() {
+				continue
+			}
+			part.SourceIPCIDR = r.Source
+			if r.Outbound == "block" {
+				part.Action = "reject"
+			} else {
+				part.Outbound = r.Outbound
+			}
+			rules = append(rules, part)
+		}
+	}
+	return writeJSON(w, map[string]any{"route": map[string]any{"rules": rules}})
+}
+
+func (r singBoxRule) empty() bool {
+	return len(r.Domain)+len(r.DomainSuffix)+len(r.DomainKeyword)+len(r.DomainRegex)+
+		len(r.IPCIDR)+len(r.ProcessName)+len(r.ProcessPath) == 0
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
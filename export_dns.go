@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// Selective DNS forwarding configs: the domains of a rule are sent to
+// -resolver, so DNS and the route built from the same list agree. Both
+// forward whole zones, full: entries included.
+
+func writeUnbound(w io.Writer, job exportJob) error {
+	addr := job.Resolver
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		addr = host + "@" + port
+	}
+	return writeLines(w, "unbound", job.Rules, func(_ exportRule, e exportEntry) string {
+		if e.Kind != entrySuffix && e.Kind != entryFull {
+			return ""
+		}
+		return fmt.Sprintf("forward-zone:\n\tname: %q\n\tforward-addr: %s", e.Value+".", addr)
+	})
+}
+
+// writeSmartDNS sends the domains to a server group named after -set or
+// the outbound; the group itself is defined with "server ... -group".
+func writeSmartDNS(w io.Writer, job exportJob) error {
+	return writeLines(w, "smartdns", job.Rules, func(r exportRule, e exportEntry) string {
+		if e.Kind != entrySuffix && e.Kind != entryFull {
+			return ""
+		}
+		return fmt.Sprintf("nameserver /%s/%s", e.Value, job.setName(r))
+	})
+}
+
+// writeDNSCryptForwarding writes forwarding-rules.txt for dnscrypt-proxy,
+// where a name covers its subdomains.
+func writeDNSCryptForwarding(w io.Writer, job exportJob) error {
+	return writeLines(w, "dnscrypt-forwarding", job.Rules, func(_ exportRule, e exportEntry) string {
+		if e.Kind != entrySuffix && e.Kind != entryFull {
+			return ""
+		}
+		return e.Value + " " + job.Resolver
+	})
+}
+
+// writeDNSCryptCloaking writes cloaking-rules.txt: by default the block
+// rules answered with 0.0.0.0, or any rule with -rule and -address.
+func writeDNSCryptCloaking(w io.Writer, job exportJob) error {
+	return writeLines(w, "dnscrypt-cloaking", job.Rules, func(_ exportRule, e exportEntry) string {
+		switch e.Kind {
+		case entrySuffix:
+			return e.Value + " " + job.Address
+		case entryFull:
+			return "=" + e.Value + " " + job.Address
+		case entryKeyword:
+			return "*" + e.Value + "* " + job.Address
+		}
+		return ""
+	})
+}
+
+// writeDnsmasqNftset writes dnsmasq-full lines for OpenWrt: the domains
+// are resolved through -resolver and their addresses added to the fw4
+// sets <set>4 and <set>6, the names -format nftables uses, for policy
+// routing.
+func writeDnsmasqNftset(w io.Writer, job exportJob) error {
+	return writeDnsmasq(w, job, "dnsmasq", func(domain, set string) string {
+		return fmt.Sprintf("nftset=/%s/4#inet#fw4#%s4,6#inet#fw4#%s6", domain, set, set)
+	})
+}
+
+// writeDnsmasqIpset is the same for firewalls using ipset.
+func writeDnsmasqIpset(w io.Writer, job exportJob) error {
+	return writeDnsmasq(w, job, "dnsmasq-ipset", func(domain, set string) string {
+		return fmt.Sprintf("ipset=/%s/%s4,%s6", domain, set, set)
+	})
+}
+
+func writeDnsmasq(w io.Writer, job exportJob, format string, tag func(domain, set string) string) error {
+	server := job.Resolver
+	if host, port, err := net.SplitHostPort(server); err == nil {
+		server = host + "#" + port
+	}
+	return writeLines(w, format, job.Rules, func(r exportRule, e exportEntry) string {
+		if e.Kind != entrySuffix && e.Kind != entryFull {
+			return ""
+		}
+		return fmt.Sprintf("server=/%s/%s\n%s", e.Value, server, tag(e.Value, job.setName(r)))
+	})
+}
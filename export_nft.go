@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// addrSet is a rule resolved to addresses for a firewall set.
+type addrSet struct {
+	Name   string
+	Rule   string
+	V4, V6 []netip.Prefix
+}
+
+// resolveSets resolves the domains of every rule; rules sharing a set
+// name (always, with -set) are merged. Only the names
+// themselves are resolved: subdomains of a suffix entry are not known
+// in advance, dnsmasq nftset/ipset fills those at query time. It returns
+// the smallest TTL seen to suggest how often to refresh.
+func resolveSets(job exportJob, format string) ([]addrSet, time.Duration) {
+	var minTTL time.Duration
+	skipped := 0
+	var sets []addrSet
+	byName := make(map[string]int)
+	all := make(map[string][]netip.Prefix)
+	for _, r := range job.Rules {
+		name := job.setName(r)
+		if _, ok := byName[name]; !ok {
+			byName[name] = len(sets)
+			sets = append(sets, addrSet{Name: name, Rule: r.Name})
+		} else {
+			sets[byName[name]].Rule += ", " + r.Name
+		}
+		var hosts []string
+		prefixes := all[name]
+		for _, e := range r.Entries {
+			switch e.Kind {
+			case entryIP:
+				if p, err := netip.ParsePrefix(e.Value); err == nil {
+					prefixes = append(prefixes, p)
+				} else if a, err := netip.ParseAddr(e.Value); err == nil {
+					prefixes = append(prefixes, netip.PrefixFrom(a, a.BitLen()))
+				}
+			case entrySuffix, entryFull:
+				hosts = append(hosts, e.Value)
+			default:
+				skipped++
+			}
+		}
+
+		for _, res := range resolveHosts(job.Resolver, hosts, 16) {
+			if res.Err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s: %s: %v\n", format, res.Host, res.Err)
+				continue
+			}
+			for _, a := range res.Addrs {
+				prefixes = append(prefixes, netip.PrefixFrom(a, a.BitLen()))
+			}
+			if minTTL == 0 || (res.TTL > 0 && res.TTL < minTTL) {
+				minTTL = res.TTL
+			}
+		}
+
+		all[name] = prefixes
+	}
+
+	for i := range sets {
+		prefixes := all[sets[i].Name]
+		slices.SortFunc(prefixes, func(a, b netip.Prefix) int {
+			if c := a.Addr().Compare(b.Addr()); c != 0 {
+				return c
+			}
+			return a.Bits() - b.Bits()
+		})
+		for _, p := range slices.Compact(prefixes) {
+			if p.Addr().Is4() {
+				sets[i].V4 = append(sets[i].V4, p)
+			} else {
+				sets[i].V6 = append(sets[i].V6, p)
+			}
+		}
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s: %d keyword/regexp entries skipped, they cannot be resolved\n", format, skipped)
+	}
+	return sets, minTTL
+}
+
+// refreshNote is the header line telling when the resolved sets go stale.
+func refreshNote(ttl time.Duration) string {
+	if ttl == 0 {
+		return "# no addresses resolved"
+	}
+	return fmt.Sprintf("# addresses resolved %s, shortest TTL %s: rebuild at least that often (e.g. from cron)",
+		time.Now().UTC().Format(time.RFC3339), ttl)
+}
+
+// nftTable holds the sets written by -format nftables.
+const nftTable = "v2raytun"
+
+// writeNftables writes a file for nft -f with an ipv4 and an ipv6 set per
+// rule, named <set>4 and <set>6. Loading it again replaces the sets.
+func writeNftables(w io.Writer, job exportJob) error {
+	sets, ttl := resolveSets(job, "nftables")
+
+	var b strings.Builder
+	fmt.Fprintln(&b, refreshNote(ttl))
+	fmt.Fprintf(&b, "table inet %s\nflush table inet %s\ntable inet %s {\n", nftTable, nftTable, nftTable)
+	for _, s := range sets {
+		for _, fam := range []struct {
+			suffix, typ string
+			elems       []netip.Prefix
+		}{{"4", "ipv4_addr", s.V4}, {"6", "ipv6_addr", s.V6}} {
+			fmt.Fprintf(&b, "\tset %s%s {\n\t\ttype %s\n\t\tflags interval\n\t\tauto-merge\n\t\tcomment %q\n", s.Name, fam.suffix, fam.typ, s.Rule)
+			if len(fam.elems) > 0 {
+				fmt.Fprintf(&b, "\t\telements = { %s }\n", joinPrefixes(fam.elems, ", "))
+			}
+			fmt.Fprintln(&b, "\t}")
+		}
+	}
+	fmt.Fprintln(&b, "}")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeIpset writes a file for ipset restore.
+func writeIpset(w io.Writer, job exportJob) error {
+	sets, ttl := resolveSets(job, "ipset")
+
+	var b strings.Builder
+	fmt.Fprintln(&b, refreshNote(ttl))
+	for _, s := range sets {
+		for _, fam := range []struct {
+			suffix, family string
+			elems          []netip.Prefix
+		}{{"4", "inet", s.V4}, {"6", "inet6", s.V6}} {
+			name := s.Name + fam.suffix
+			fmt.Fprintf(&b, "create %s hash:net family %s -exist\nflush %s\n", name, fam.family, name)
+			for _, p := range fam.elems {
+				fmt.Fprintf(&b, "add %s %s\n", name, prefixString(p))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// prefixString drops the length of single addresses.
+func prefixString(p netip.Prefix) string {
+	if p.IsSingleIP() {
+		return p.Addr().String()
+	}
+	return p.String()
+}
+
+func joinPrefixes(ps []netip.Prefix, sep string) string {
+	s := make([]string, len(ps))
+	for i, p := range ps {
+		s[i] = prefixString(p)
+	}
+	return strings.Join(s, sep)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// pacTmpl keeps v2ray's first-match order: every suffix of the host is
+// looked up and the earliest rule wins, so the cost is one map lookup
+// per label whatever the list size.
+const pacTmpl = `// Generated by v2raytun-routing from route %s.
+var returns = %s;
+var suffixes = %s;
+var full = %s;
+var keywords = %s;
+var regexps = [%s];
+var fallback = %s;
+
+function FindProxyForURL(url, host) {
+  host = host.toLowerCase().replace(/\.$/, "");
+  var best = -1;
+  var pick = function(i) {
+    if (best < 0 || i < best) best = i;
+  };
+  var has = Object.prototype.hasOwnProperty;
+  if (has.call(full, host)) pick(full[host]);
+  for (var h = host; ; ) {
+    if (has.call(suffixes, h)) pick(suffixes[h]);
+    var dot = h.indexOf(".");
+    if (dot < 0) break;
+    h = h.substring(dot + 1);
+  }
+  for (var i = 0; i < keywords.length; i++) {
+    if (host.indexOf(keywords[i][0]) >= 0) pick(keywords[i][1]);
+  }
+  for (var i = 0; i < regexps.length; i++) {
+    if (regexps[i][0].test(host)) pick(regexps[i][1]);
+  }
+  return best < 0 ? fallback : returns[best];
+}
+`
+
+// writePAC writes a proxy auto-config file. direct rules return DIRECT,
+// block rules a dead proxy, anything else -pac-proxy.
+func writePAC(w io.Writer, job exportJob) error {
+	returns := make([]string, len(job.Rules))
+	suffixes := make(map[string]int)
+	full := make(map[string]int)
+	var keywords [][2]any
+	var regexps string
+
+	add := func(m map[string]int, k string, i int) {
+		if _, ok := m[k]; !ok {
+			m[k] = i
+		}
+	}
+	for i, r := range job.Rules {
+		switch r.Outbound {
+		case "direct":
+			returns[i] = "DIRECT"
+		case "block":
+			returns[i] = "PROXY 0.0.0.0:1"
+		default:
+			returns[i] = job.PACProxy
+		}
+		for _, e := range r.Entries {
+			switch e.Kind {
+			case entrySuffix:
+				add(suffixes, e.Value, i)
+			case entryFull:
+				add(full, e.Value, i)
+			case entryKeyword:
+				keywords = append(keywords, [2]any{e.Value, i})
+			case entryRegexp:
+				if _, err := regexp.Compile(e.Value); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: pac: skipping regexp %q: %v\n", e.Value, err)
+					continue
+				}
+				js, _ := json.Marshal(e.Value)
+				if regexps != "" {
+					regexps += ", "
+				}
+				regexps += fmt.Sprintf("[new RegExp(%s), %d]", js, i)
+			case entryIP:
+				add(full, e.Value, i)
+			}
+		}
+	}
+
+	enc := func(v any) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	if keywords == nil {
+		keywords = [][2]any{}
+	}
+	_, err := fmt.Fprintf(w, pacTmpl, job.Name, enc(returns), enc(suffixes), enc(full), enc(keywords), regexps, enc(job.PACDefault))
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// writeRouterOS writes a MikroTik script: addresses go straight to a
+// firewall address list, domains become DNS FWD entries that add the
+// addresses they resolve to into the same list, for policy routing.
+func writeRouterOS(w io.Writer, job exportJob) error {
+	return writeLines(w, "routeros", job.Rules, func(r exportRule, e exportEntry) string {
+		list := rosString(job.setName(r))
+		comment := rosString(r.Name)
+		fwd := fmt.Sprintf("type=FWD forward-to=%s address-list=%s comment=%s", job.Resolver, list, comment)
+
+		switch e.Kind {
+		case entryIP:
+			path := "/ip"
+			if isIPv6(e.Value) {
+				path = "/ipv6"
+			}
+			return fmt.Sprintf("%s firewall address-list add list=%s address=%s comment=%s", path, list, e.Value, comment)
+		case entrySuffix:
+			return fmt.Sprintf("/ip dns static add name=%s match-subdomain=yes %s", e.Value, fwd)
+		case entryFull:
+			return fmt.Sprintf("/ip dns static add name=%s %s", e.Value, fwd)
+		case entryKeyword:
+			return fmt.Sprintf("/ip dns static add regexp=%s %s", rosString(routerOSQuote(e.Value)), fwd)
+		case entryRegexp:
+			return fmt.Sprintf("/ip dns static add regexp=%s %s", rosString(e.Value), fwd)
+		}
+		return ""
+	})
+}
+
+// routerOSQuote escapes a keyword for the POSIX regexps RouterOS uses.
+func routerOSQuote(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`.[]()*+?{}|^$\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// rosString quotes s for a RouterOS script, where $ starts a variable.
+func rosString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(s) + `"`
+}
+
+// isIPv6 is true for IPv6 addresses and prefixes.
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		ip, _, _ = net.ParseCIDR(s)
+	}
+	return ip != nil && ip.To4() == nil
+}
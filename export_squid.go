@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// writeSquid writes a dstdomain ACL file, e.g. for
+// acl allowed dstdomain "/etc/squid/allowed.txt". The lines are also
+// valid Privoxy patterns under an action section. Squid complains about
+// names covered by another .suffix line, so those are left out.
+func writeSquid(w io.Writer, job exportJob) error {
+	suffixes := make(map[string]bool)
+	for _, r := range job.Rules {
+		for _, e := range r.Entries {
+			if e.Kind == entrySuffix {
+				suffixes[e.Value] = true
+			}
+		}
+	}
+	covered := func(host string) bool {
+		for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+			host = host[i+1:]
+			if suffixes[host] {
+				return true
+			}
+		}
+		return false
+	}
+
+	rules := make([]exportRule, len(job.Rules))
+	for i, r := range job.Rules {
+		rules[i] = exportRule{Name: r.Name, Outbound: r.Outbound}
+		for _, e := range r.Entries {
+			if covered(e.Value) || (e.Kind == entryFull && suffixes[e.Value]) {
+				continue
+			}
+			rules[i].Entries = append(rules[i].Entries, e)
+		}
+	}
+	return writeLines(w, "squid", rules, func(_ exportRule, e exportEntry) string {
+		switch e.Kind {
+		case entrySuffix:
+			return "." + e.Value
+		case entryFull:
+			return e.Value
+		}
+		return ""
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Rule files for the iOS clients: Surge and Quantumult X, plus
+// Shadowrocket, Loon and Stash, which reuse the Surge rule syntax with
+// small differences in the file around it.
+
+func writeSurgeDomainSet(w io.Writer, job exportJob) error {
+	return writeLines(w, "surge-domain-set", job.Rules, func(_ exportRule, e exportEntry) string {
+		switch e.Kind {
+		case entrySuffix:
+			return "." + e.Value
+		case entryFull:
+			return e.Value
+		}
+		return ""
+	})
+}
+
+func writeSurgeRuleSet(w io.Writer, job exportJob) error {
+	return writeLines(w, "surge-rule-set", job.Rules, func(_ exportRule, e exportEntry) string {
+		if t := surgeType(e.Kind); t != "" {
+			return t + "," + e.Value
+		}
+		return ""
+	})
+}
+
+func writeQuanX(w io.Writer, job exportJob) error {
+	return writeLines(w, "quanx", job.Rules, func(r exportRule, e exportEntry) string {
+		var t string
+		switch e.Kind {
+		case entrySuffix:
+			t = "HOST-SUFFIX"
+		case entryFull:
+			t = "HOST"
+		case entryKeyword:
+			t = "HOST-KEYWORD"
+		default:
+			return ""
+		}
+		return t + "," + e.Value + "," + quanxPolicy(r.Outbound)
+	})
+}
+
+// surgeType is the rule type shared by Surge and the clients that copied
+// its syntax (Shadowrocket, Loon, Stash).
+func surgeType(kind string) string {
+	switch kind {
+	case entrySuffix:
+		return "DOMAIN-SUFFIX"
+	case entryFull:
+		return "DOMAIN"
+	case entryKeyword:
+		return "DOMAIN-KEYWORD"
+	}
+	return ""
+}
+
+func quanxPolicy(outbound string) string {
+	if outbound == "block" {
+		return "reject"
+	}
+	return outbound
+}
+
+func writeShadowrocket(w io.Writer, job exportJob) error {
+	if _, err := fmt.Fprintln(w, "[Rule]"); err != nil {
+		return err
+	}
+	return writeSurgeRules(w, "shadowrocket", job.Rules)
+}
+
+// writeLoonPlugin writes a plugin that can be added by URL in Loon.
+func writeLoonPlugin(w io.Writer, job exportJob) error {
+	_, err := fmt.Fprintf(w, "#!name=%s\n#!desc=Generated by v2raytun-routing\n\n[Rule]\n", job.Name)
+	if err != nil {
+		return err
+	}
+	return writeSurgeRules(w, "loon", job.Rules)
+}
+
+// writeStashProvider writes a classical rule provider; the policy is
+// set where the provider is used.
+func writeStashProvider(w io.Writer, job exportJob) error {
+	if _, err := fmt.Fprintln(w, "payload:"); err != nil {
+		return err
+	}
+	return writeLines(w, "stash", job.Rules, func(_ exportRule, e exportEntry) string {
+		if t := surgeType(e.Kind); t != "" {
+			return "  - " + t + "," + e.Value
+		}
+		return ""
+	})
+}
+
+func writeSurgeRules(w io.Writer, format string, rules []exportRule) error {
+	return writeLines(w, format, rules, func(r exportRule, e exportEntry) string {
+		if t := surgeType(e.Kind); t != "" {
+			return t + "," + e.Value + "," + surgePolicy(r.Outbound)
+		}
+		return ""
+	})
+}
+
+func surgePolicy(outbound string) string {
+	switch outbound {
+	case "direct":
+		return "DIRECT"
+	case "block":
+		return "REJECT"
+	case "proxy":
+		return "PROXY"
+	}
+	return outbound
+}
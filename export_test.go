@@ -0,0 +1,23 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestExportRouteNoRule(t *testing.T) {
+	route := Route{Rules: []Rule{{Domain: []string{"example.com"}, OutboundTag: "proxy", Name: "Proxy"}}}
+	tests := []struct {
+		o    exportOptions
+		want string
+	}{
+		{exportOptions{Format: "hosts"}, "route has no rule with outbound block"},
+		{exportOptions{Format: "hosts", Rules: "Ads"}, `no rule named "Ads"`},
+	}
+	for _, tt := range tests {
+		err := exportRoute(io.Discard, route, tt.o, nil, nil)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("exportRoute(%+v) = %v, want %q", tt.o, err, tt.want)
+		}
+	}
+}
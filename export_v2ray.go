@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// outboundMap is a repeatable outbound=value flag.
+type outboundMap map[string]string
+
+func (m outboundMap) String() string {
+	var parts []string
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		parts = append(parts, k+"="+m[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *outboundMap) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
+		return fmt.Errorf("want outbound=value, got %q", s)
+	}
+	if *m == nil {
+		*m = make(outboundMap)
+	}
+	(*m)[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	return nil
+}
+
+// v2rayDNSServer is an entry of the servers list of the v2ray/Xray dns
+// object.
+type v2rayDNSServer struct {
+	Address      string   `json:"address"`
+	Port         int      `json:"port,omitempty"`
+	Domains      []string `json:"domains"`
+	SkipFallback bool     `json:"skipFallback"`
+}
+
+// writeV2rayDNS writes the dns section of a v2ray/Xray client config for
+// the route: the domains of each rule whose outbound has a -dns server
+// are resolved there, the rest by -dns-default. Entries keep the routing
+// syntax, which the dns section shares, so routing and DNS split the same
+// way. An https:// server is queried through the routing (usually the
+// proxy), https+local:// and plain addresses directly.
+func writeV2rayDNS(w io.Writer, job exportJob) error {
+	var servers []any
+	byAddr := make(map[string]*v2rayDNSServer)
+	skipped := 0
+	for _, r := range job.Native {
+		addr, ok := job.DNS[r.OutboundTag]
+		if !ok {
+			continue
+		}
+		s := byAddr[addr]
+		if s == nil {
+			s = &v2rayDNSServer{Address: addr, SkipFallback: true}
+			if host, port, err := net.SplitHostPort(addr); err == nil && !strings.Contains(addr, "://") {
+				s.Address = host
+				s.Port, _ = strconv.Atoi(port)
+			}
+			byAddr[addr] = s
+			servers = append(servers, s)
+		}
+		for _, e := range r.Domain {
+			if isIP(e) {
+				skipped++
+				continue
+			}
+			s.Domains = append(s.Domains, e)
+		}
+	}
+	for outbound := range job.DNS {
+		if !slices.ContainsFunc(job.Native, func(r Rule) bool { return r.OutboundTag == outbound }) {
+			fmt.Fprintf(os.Stderr, "warning: v2ray-dns: no rule has outbound %q\n", outbound)
+		}
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "warning: v2ray-dns: %d ip entries skipped, not supported\n", skipped)
+	}
+	if job.FakeDNS {
+		// Hosts that must get real addresses and have no server above go
+		// to -dns-default before the fakedns fallback sees them.
+		real := job.Sections[job.FakeDNSSection]
+		if len(real) == 0 {
+			fmt.Fprintf(os.Stderr, "warning: v2ray-dns: no hosts in [%s], every domain gets a fake address\n", job.FakeDNSSection)
+		}
+		var rest []string
+		for _, h := range real {
+			if !slices.ContainsFunc(slices.Collect(maps.Values(byAddr)), func(s *v2rayDNSServer) bool {
+				return slices.Contains(s.Domains, h)
+			}) {
+				rest = append(rest, h)
+			}
+		}
+		if len(rest) > 0 {
+			servers = append(servers, &v2rayDNSServer{Address: job.DNSDefault, Domains: rest, SkipFallback: true})
+		}
+		servers = append(servers, "fakedns")
+	}
+	if job.DNSDefault != "" {
+		servers = append(servers, job.DNSDefault)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"dns": map[string]any{"servers": servers}})
+}
+
+// writeFakeDNSExclude lists the hosts of the -fakedns-section, one per
+// line, for fakedns filters of other clients; they come from the same
+// lists as the route, so the two stay in lockstep.
+func writeFakeDNSExclude(w io.Writer, job exportJob) error {
+	hosts := job.Sections[job.FakeDNSSection]
+	if len(hosts) == 0 {
+		return fmt.Errorf("no hosts in [%s] of the input", job.FakeDNSSection)
+	}
+	for _, h := range hosts {
+		if _, err := fmt.Fprintln(w, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
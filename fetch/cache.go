@@ -0,0 +1,93 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+
+	"github.com/devemio/v2raytun-routing/atomicfile"
+)
+
+// cacheEntry is the metadata stored next to a cached body.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+
+	body []byte
+}
+
+func (o Options) cacheDir() (string, error) {
+	if o.CacheDir != "" {
+		return o.CacheDir, nil
+	}
+	return filepath.Join(xdg.CacheHome, "v2raytun-routing", "fetch"), nil
+}
+
+func (o Options) cachePaths(rawURL string) (body, meta string, err error) {
+	dir, err := o.cacheDir()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	base := filepath.Join(dir, hex.EncodeToString(sum[:16]))
+	return base + ".body", base + ".json", nil
+}
+
+// loadCache returns nil if nothing usable is cached.
+func (o Options) loadCache(rawURL string) *cacheEntry {
+	bodyPath, metaPath, err := o.cachePaths(rawURL)
+	if err != nil {
+		return nil
+	}
+	mb, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil
+	}
+	e := new(cacheEntry)
+	if err := json.Unmarshal(mb, e); err != nil || e.URL != rawURL {
+		return nil
+	}
+	if e.body, err = os.ReadFile(bodyPath); err != nil {
+		return nil
+	}
+	return e
+}
+
+// LastFetch returns when rawURL was last fetched successfully, revalidations
+// included, as recorded in the cache. Without a cache it is unknown.
+func (o Options) LastFetch(rawURL string) (time.Time, bool) {
+	if o.NoCache {
+		return time.Time{}, false
+	}
+	e := o.loadCache(rawURL)
+	if e == nil {
+		return time.Time{}, false
+	}
+	return e.Fetched, true
+}
+
+func (o Options) storeCache(e *cacheEntry) error {
+	bodyPath, metaPath, err := o.cachePaths(e.URL)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(bodyPath), 0o755); err != nil {
+		return err
+	}
+	mb, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// Body first: metadata without a body is ignored by loadCache.
+	// Each write gets its own temp file, so concurrent fetches of one URL
+	// do not clobber each other's.
+	return errors.Join(atomicfile.WriteFile(bodyPath, e.body), atomicfile.WriteFile(metaPath, mb))
+}
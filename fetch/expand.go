@@ -0,0 +1,65 @@
+package fetch
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Expand returns the files a local path stands for: the matches of a
+// glob ("lists/*.txt"), the regular files below a directory, walked
+// recursively in lexical order and skipping hidden entries, or the path
+// itself. URLs, git+ paths and "-" are returned as is.
+func Expand(path string) ([]string, error) {
+	if path == "-" || IsRemote(path) || IsGit(path) {
+		return []string{path}, nil
+	}
+	if strings.ContainsAny(path, "*?[") {
+		m, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(m) == 0 {
+			return nil, fmt.Errorf("%s: no files match", path)
+		}
+		var out []string
+		for _, p := range m {
+			files, err := Expand(p)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, files...)
+		}
+		return out, nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil || !fi.IsDir() {
+		return []string{path}, nil // ReadFile reports the error
+	}
+	var out []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != path && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			out = append(out, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no files in directory", path)
+	}
+	return out, nil
+}
@@ -0,0 +1,53 @@
+package fetch
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.txt", "b.txt", "c.csv", "sub/d.txt", ".hidden/e.txt", ".f.txt"} {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(names ...string) []string {
+		out := make([]string, len(names))
+		for i, n := range names {
+			out[i] = filepath.Join(dir, n)
+		}
+		return out
+	}
+
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "-", want: []string{"-"}},
+		{in: "https://h.com/l.txt", want: []string{"https://h.com/l.txt"}},
+		{in: "git+https://h.com/r.git//l.txt", want: []string{"git+https://h.com/r.git//l.txt"}},
+		// Hidden entries are skipped in directories only, a glob names them.
+		{in: filepath.Join(dir, "*.txt"), want: join(".f.txt", "a.txt", "b.txt")},
+		{in: dir, want: join("a.txt", "b.txt", "c.csv", "sub/d.txt")},
+		{in: filepath.Join(dir, "a.txt"), want: join("a.txt")},
+		{in: filepath.Join(dir, "missing.txt"), want: join("missing.txt")},
+		{in: filepath.Join(dir, "*.md"), wantErr: true},
+		{in: filepath.Join(dir, ".hidden"), want: join(".hidden/e.txt")},
+	}
+	for _, tt := range tests {
+		got, err := Expand(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Expand(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		} else if !slices.Equal(got, tt.want) {
+			t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
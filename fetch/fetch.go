@@ -0,0 +1,226 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options control remote fetches. The zero Proxy means HTTP_PROXY,
+// HTTPS_PROXY and ALL_PROXY from the environment; socks5:// is supported.
+//
+// Responses are cached in CacheDir (XDG cache dir by default) and reused
+// without a request while younger than MaxAge; older entries are
+// revalidated with If-None-Match/If-Modified-Since and served stale if the
+// upstream is unreachable.
+type Options struct {
+	Timeout  time.Duration
+	Retries  int
+	Backoff  time.Duration
+	Proxy    string
+	NoCache  bool
+	CacheDir string
+	MaxAge   time.Duration
+}
+
+// Default is used by ReadFile and configured by AddFlags.
+var Default = Options{
+	Timeout: 30 * time.Second,
+	Retries: 3,
+	Backoff: time.Second,
+}
+
+func AddFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&Default.Timeout, "timeout", Default.Timeout, "Timeout for each remote fetch attempt")
+	fs.IntVar(&Default.Retries, "retries", Default.Retries, "Retries for failed remote fetches")
+	fs.DurationVar(&Default.Backoff, "backoff", Default.Backoff, "Initial delay between retries, doubled after each attempt")
+	fs.StringVar(&Default.Proxy, "proxy", Default.Proxy, "Proxy URL for remote fetches (http://, socks5://); defaults to HTTP_PROXY/ALL_PROXY")
+	fs.BoolVar(&Default.NoCache, "no-cache", Default.NoCache, "Do not cache remote fetches")
+	fs.DurationVar(&Default.MaxAge, "max-age", Default.MaxAge, "Reuse cached remote fetches younger than this without revalidating")
+}
+
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// ReadFile reads a local path, an http(s) URL, a file in a Git
+// repository (git+ URL), or stdin for "-".
+func ReadFile(path string) ([]byte, error) {
+	return ReadFileContext(context.Background(), path)
+}
+
+// ReadFileContext is ReadFile giving up on downloads, retries and git
+// fetches once ctx is done.
+func ReadFileContext(ctx context.Context, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	if IsGit(path) {
+		return Default.ReadGitContext(ctx, path)
+	}
+	if !IsRemote(path) {
+		return os.ReadFile(path)
+	}
+	return Default.GetContext(ctx, path)
+}
+
+// Open is ReadFile for callers that stream: local files and stdin are
+// read as they go, remote ones are fetched (and cached) first.
+func Open(path string) (io.ReadCloser, error) {
+	return OpenContext(context.Background(), path)
+}
+
+// OpenContext is Open with ctx bounding the fetch of remote files.
+func OpenContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	if !IsRemote(path) && !IsGit(path) {
+		return os.Open(path)
+	}
+	b, err := ReadFileContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (o Options) Get(rawURL string) ([]byte, error) {
+	return o.GetContext(context.Background(), rawURL)
+}
+
+// GetContext is Get with ctx ending the request and the waits between
+// retries; a cancelled fetch fails instead of falling back to the cache,
+// since the caller no longer wants the answer.
+func (o Options) GetContext(ctx context.Context, rawURL string) ([]byte, error) {
+	var cached *cacheEntry
+	if !o.NoCache {
+		cached = o.loadCache(rawURL)
+		if cached != nil && time.Since(cached.Fetched) < o.MaxAge {
+			return cached.body, nil
+		}
+	}
+
+	client, err := o.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	delay := o.Backoff
+	for attempt := 0; ; attempt++ {
+		e, retry, err := o.get(ctx, client, rawURL, cached)
+		if err == nil {
+			if !o.NoCache {
+				if err := o.storeCache(e); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: cache %s: %v\n", rawURL, err)
+				}
+			}
+			return e.body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("fetch %s: %w", rawURL, ctx.Err())
+		}
+		if !retry || attempt >= o.Retries {
+			if cached != nil {
+				fmt.Fprintf(os.Stderr, "warning: fetch %s: %v, using cached copy from %s\n", rawURL, err, cached.Fetched.Local().Format(time.DateTime))
+				return cached.body, nil
+			}
+			return nil, fmt.Errorf("fetch %s: %w", rawURL, err)
+		}
+		fmt.Fprintf(os.Stderr, "warning: fetch %s: %v, retrying in %s\n", rawURL, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("fetch %s: %w", rawURL, ctx.Err())
+		}
+		delay *= 2
+	}
+}
+
+// get performs one conditional request; a 304 returns the cached entry
+// with a refreshed fetch time.
+func (o Options) get(ctx context.Context, client *http.Client, rawURL string, cached *cacheEntry) (*cacheEntry, bool, error) {
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		e := *cached
+		e.Fetched = time.Now().UTC()
+		return &e, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, errors.New(resp.Status)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	return &cacheEntry{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now().UTC(),
+		body:         b,
+	}, false, nil
+}
+
+// Client returns an HTTP client using the configured proxy.
+func (o Options) Client() (*http.Client, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy := o.Proxy
+	if proxy == "" {
+		proxy = os.Getenv("ALL_PROXY")
+		if proxy == "" {
+			proxy = os.Getenv("all_proxy")
+		}
+		if proxy == "" {
+			// HTTP_PROXY/HTTPS_PROXY/NO_PROXY as usual.
+			return &http.Client{Transport: tr}, nil
+		}
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+	tr.Proxy = http.ProxyURL(u)
+	return &http.Client{Transport: tr}, nil
+}
@@ -0,0 +1,133 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testOptions fetch directly, with a private cache and no waits.
+func testOptions(t *testing.T) Options {
+	t.Helper()
+	t.Setenv("ALL_PROXY", "")
+	t.Setenv("all_proxy", "")
+	return Options{Retries: 2, Backoff: time.Millisecond, CacheDir: t.TempDir()}
+}
+
+func TestGetRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // answers in order, the last one repeats
+		want     string
+		wantErr  bool
+		requests int32
+	}{
+		{name: "ok", statuses: []int{200}, want: "body", requests: 1},
+		{name: "5xx is retried", statuses: []int{503, 502, 200}, want: "body", requests: 3},
+		{name: "429 is retried", statuses: []int{429, 200}, want: "body", requests: 2},
+		{name: "retries run out", statuses: []int{500}, wantErr: true, requests: 3},
+		{name: "404 is not retried", statuses: []int{404}, wantErr: true, requests: 1},
+	}
+	for _, tt := range tests {
+		var n atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			i := int(n.Add(1)) - 1
+			status := tt.statuses[min(i, len(tt.statuses)-1)]
+			w.WriteHeader(status)
+			if status == 200 {
+				w.Write([]byte("body"))
+			}
+		}))
+		o := testOptions(t)
+		o.NoCache = true
+		got, err := o.Get(srv.URL)
+		srv.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		} else if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if n.Load() != tt.requests {
+			t.Errorf("%s: %d requests, want %d", tt.name, n.Load(), tt.requests)
+		}
+	}
+}
+
+func TestGetCache(t *testing.T) {
+	var n, revalidated atomic.Int32
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("list"))
+	}))
+	defer srv.Close()
+
+	o := testOptions(t)
+	o.Retries = 0
+	get := func(o Options) string {
+		t.Helper()
+		b, err := o.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if got := get(o); got != "list" {
+		t.Fatalf("first fetch = %q", got)
+	}
+	if _, ok := o.LastFetch(srv.URL); !ok {
+		t.Error("LastFetch after a fetch = false")
+	}
+
+	// Younger than MaxAge: no request at all.
+	fresh := o
+	fresh.MaxAge = time.Hour
+	if got := get(fresh); got != "list" || n.Load() != 1 {
+		t.Errorf("fresh cache: got %q after %d requests, want 1", got, n.Load())
+	}
+
+	// Older: revalidated with the ETag, 304 serves the cached body.
+	if got := get(o); got != "list" || revalidated.Load() != 1 {
+		t.Errorf("revalidation: got %q, %d revalidations", got, revalidated.Load())
+	}
+
+	// Upstream down: the stale copy is served.
+	down.Store(true)
+	if got := get(o); got != "list" {
+		t.Errorf("stale fallback = %q, want list", got)
+	}
+
+	// Without the cache the failure shows.
+	o.NoCache = true
+	if _, err := o.Get(srv.URL); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("no-cache fetch error = %v, want 502", err)
+	}
+}
+
+func TestGetCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	o := testOptions(t)
+	o.Backoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := o.GetContext(ctx, srv.URL); err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Errorf("GetContext error = %v, want the deadline", err)
+	}
+}
@@ -0,0 +1,177 @@
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitPrefix marks a file in a Git repository:
+//
+//	git+https://github.com/team/lists.git//ru/direct.txt?ref=v1.2
+//
+// The part after "//" is the path in the repository; ref is a branch, tag
+// or commit and defaults to the remote HEAD.
+const gitPrefix = "git+"
+
+// gitSyncEvery bounds how often one checkout is fetched within a process,
+// so the files of a repository read by one build share a fetch.
+const gitSyncEvery = time.Minute
+
+func IsGit(path string) bool {
+	return strings.HasPrefix(path, gitPrefix)
+}
+
+// gitSource is a parsed git+ path.
+type gitSource struct {
+	Repo string
+	Path string
+	Ref  string
+}
+
+func parseGit(s string) (gitSource, error) {
+	rest, ok := strings.CutPrefix(s, gitPrefix)
+	scheme, after, hasScheme := strings.Cut(rest, "://")
+	if !ok || !hasScheme {
+		return gitSource{}, fmt.Errorf("invalid git source %q: want git+<scheme>://<repo>//<path>[?ref=<ref>]", s)
+	}
+	var g gitSource
+	after, g.Ref, _ = strings.Cut(after, "?ref=")
+	repo, path, ok := strings.Cut(after, "//")
+	if !ok || path == "" {
+		return gitSource{}, fmt.Errorf("invalid git source %q: no //<path> in the repository", s)
+	}
+	if path = filepath.Clean(path); !filepath.IsLocal(path) {
+		return gitSource{}, fmt.Errorf("invalid git source %q: path leaves the repository", s)
+	}
+	if g.Ref != "" && !validRef(g.Ref) {
+		return gitSource{}, fmt.Errorf("invalid git source %q: bad ref %q", s, g.Ref)
+	}
+	g.Repo, g.Path = scheme+"://"+repo, path
+	return g, nil
+}
+
+// validRef applies the git check-ref-format rules, one-level names
+// allowed, so a ref from a remote list cannot pass for a git option.
+// Commit SHAs are valid names too.
+func validRef(ref string) bool {
+	if strings.HasPrefix(ref, "-") || ref == "@" || strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".") ||
+		strings.Contains(ref, "..") || strings.Contains(ref, "@{") {
+		return false
+	}
+	for _, part := range strings.Split(ref, "/") {
+		if part == "" || strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+			return false
+		}
+	}
+	for _, c := range ref {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// gitCheckout guards one checkout directory.
+type gitCheckout struct {
+	mu     sync.Mutex
+	synced time.Time
+}
+
+var checkouts sync.Map // dir -> *gitCheckout
+
+// ReadGit reads a file from a shallow checkout of the repository, which
+// is kept in the cache dir and fetched again once older than MaxAge (and
+// gitSyncEvery). If the fetch fails, an existing checkout is used with a
+// warning, like a stale cached download.
+func (o Options) ReadGit(path string) ([]byte, error) {
+	return o.ReadGitContext(context.Background(), path)
+}
+
+// ReadGitContext is ReadGit with ctx stopping the git commands.
+func (o Options) ReadGitContext(ctx context.Context, path string) ([]byte, error) {
+	g, err := parseGit(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := o.cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(g.Repo + "\x00" + g.Ref))
+	dir = filepath.Join(dir, "git", hex.EncodeToString(sum[:16]))
+
+	c, _ := checkouts.LoadOrStore(dir, new(gitCheckout))
+	co := c.(*gitCheckout)
+	co.mu.Lock()
+	if time.Since(co.synced) >= max(o.MaxAge, gitSyncEvery) {
+		if err := o.syncGit(ctx, dir, g); err != nil {
+			if ctx.Err() != nil {
+				co.mu.Unlock()
+				return nil, fmt.Errorf("git %s: %w", g.Repo, ctx.Err())
+			}
+			if _, serr := os.Stat(filepath.Join(dir, ".git")); serr != nil {
+				co.mu.Unlock()
+				return nil, fmt.Errorf("git %s: %w", g.Repo, err)
+			}
+			fmt.Fprintf(os.Stderr, "warning: git %s: %v, using the existing checkout\n", g.Repo, err)
+		}
+		co.synced = time.Now()
+	}
+	co.mu.Unlock()
+
+	return os.ReadFile(filepath.Join(dir, g.Path))
+}
+
+// syncGit fetches ref with depth 1 and checks it out. Fetching by ref
+// rather than cloning a branch also pins tags and commits.
+func (o Options) syncGit(ctx context.Context, dir string, g gitSource) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		if err := o.git(ctx, dir, "init", "-q"); err != nil {
+			return err
+		}
+		if err := o.git(ctx, dir, "remote", "add", "--", "origin", g.Repo); err != nil {
+			return err
+		}
+	}
+	ref := g.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := o.git(ctx, dir, "fetch", "-q", "--depth", "1", "--", "origin", ref); err != nil {
+		return err
+	}
+	return o.git(ctx, dir, "checkout", "-q", "--force", "--detach", "FETCH_HEAD")
+}
+
+func (o Options) git(ctx context.Context, dir string, args ...string) error {
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	if o.Proxy != "" {
+		args = append([]string{"-c", "http.proxy=" + o.Proxy}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(strings.ReplaceAll(msg, "\n", "; "))
+		}
+		return err
+	}
+	return nil
+}
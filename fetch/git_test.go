@@ -0,0 +1,36 @@
+package fetch
+
+import "testing"
+
+func TestParseGit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    gitSource
+		wantErr bool
+	}{
+		{in: "git+https://github.com/team/lists.git//ru/direct.txt", want: gitSource{Repo: "https://github.com/team/lists.git", Path: "ru/direct.txt"}},
+		{in: "git+https://github.com/team/lists.git//direct.txt?ref=v1.2", want: gitSource{Repo: "https://github.com/team/lists.git", Path: "direct.txt", Ref: "v1.2"}},
+		{in: "git+ssh://git@host/r.git//a/b.txt?ref=refs/heads/main", want: gitSource{Repo: "ssh://git@host/r.git", Path: "a/b.txt", Ref: "refs/heads/main"}},
+		{in: "git+https://h/r.git//a.txt?ref=3f2a9c1d", want: gitSource{Repo: "https://h/r.git", Path: "a.txt", Ref: "3f2a9c1d"}},
+		{in: "git+https://h/r.git", wantErr: true},
+		{in: "git+https://h/r.git//../etc/passwd", wantErr: true},
+		{in: "git+https://h/r.git//a.txt?ref=--upload-pack=touch /tmp/x", wantErr: true},
+		{in: "git+https://h/r.git//a.txt?ref=-b", wantErr: true},
+		{in: "git+https://h/r.git//a.txt?ref=a..b", wantErr: true},
+		{in: "git+https://h/r.git//a.txt?ref=main@{1}", wantErr: true},
+		{in: "git+https://h/r.git//a.txt?ref=feature/.x", wantErr: true},
+		{in: "git+https://h/r.git//a.txt?ref=x.lock", wantErr: true},
+		{in: "git+https://h/r.git//a.txt?ref=a b", wantErr: true},
+		{in: "https://h/r.git//a.txt", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseGit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseGit(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseGit(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package geosite
+
+// acAutomaton finds every pattern occurring in a string in one pass, so
+// plain (substring) rules cost the same however many there are.
+type acAutomaton struct {
+	trie  []map[byte]int32 // while adding; dropped by build
+	class [256]int32       // byte -> column in next, 0 for bytes no pattern has
+	width int32
+	next  []int32   // node*width+class -> node, failure transitions folded in
+	out   [][]int32 // node -> ids of patterns ending here, suffixes included
+}
+
+func newACAutomaton() *acAutomaton {
+	return &acAutomaton{trie: []map[byte]int32{{}}, out: make([][]int32, 1)}
+}
+
+// add inserts pattern p with id; build must be called after the last add.
+func (a *acAutomaton) add(p string, id int32) {
+	n := int32(0)
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		child, ok := a.trie[n][c]
+		if !ok {
+			child = int32(len(a.trie))
+			a.trie = append(a.trie, map[byte]int32{})
+			a.out = append(a.out, nil)
+			a.trie[n][c] = child
+			if a.class[c] == 0 {
+				a.width++
+				a.class[c] = a.width
+			}
+		}
+		n = child
+	}
+	a.out[n] = append(a.out[n], id)
+}
+
+// build computes failure links breadth-first and folds them into a dense
+// transition table over the bytes the patterns use.
+func (a *acAutomaton) build() {
+	a.width++
+	w := a.width
+	a.next = make([]int32, int32(len(a.trie))*w)
+	fail := make([]int32, len(a.trie))
+
+	var queue []int32
+	for c, child := range a.trie[0] {
+		a.next[a.class[c]] = child
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		a.out[n] = append(a.out[n], a.out[fail[n]]...)
+		copy(a.next[n*w:(n+1)*w], a.next[fail[n]*w:(fail[n]+1)*w])
+		for c, child := range a.trie[n] {
+			col := a.class[c]
+			fail[child] = a.next[fail[n]*w+col]
+			a.next[n*w+col] = child
+			queue = append(queue, child)
+		}
+	}
+	a.trie = nil
+}
+
+// appendMatches appends the id of every pattern occurring in s to dst.
+func (a *acAutomaton) appendMatches(dst []int32, s string) []int32 {
+	if a.next == nil {
+		return dst
+	}
+	n := int32(0)
+	for i := 0; i < len(s); i++ {
+		n = a.next[n*a.width+a.class[s[i]]]
+		dst = append(dst, a.out[n]...)
+	}
+	return dst
+}
@@ -0,0 +1,21 @@
+package geosite
+
+import (
+	"slices"
+	"testing"
+)
+
+// Patterns may use every byte value, one column each plus column 0.
+func TestACAutomatonAllBytes(t *testing.T) {
+	a := newACAutomaton()
+	for c := 0; c < 256; c++ {
+		a.add(string([]byte{byte(c), 'x'}), int32(c))
+	}
+	a.build()
+	for _, c := range []int{0, 1, 'a', 254, 255} {
+		s := string([]byte{'x', byte(c), 'x'})
+		if got := a.appendMatches(nil, s); !slices.Equal(got, []int32{int32(c)}) {
+			t.Errorf("appendMatches(%q) = %v, want [%d]", s, got, c)
+		}
+	}
+}
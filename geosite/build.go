@@ -0,0 +1,227 @@
+package geosite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// sourceList is one file of a domain-list-community style data tree.
+type sourceList struct {
+	rules    []*router.Domain
+	includes []include
+}
+
+// include is "include:name @attr @-attr": only rules of name with every
+// @attr and none of the @-attr are taken, as upstream does.
+type include struct {
+	name    string
+	want    []string
+	without []string
+	line    int
+}
+
+// BuildDir builds a list from a data directory where every file is a tag
+// named after it, resolving nested include: directives. The result only
+// depends on the files: tags are sorted by name, rules by type and value
+// and attributes by key, so with Marshal the bytes are reproducible.
+func BuildDir(dir string) (*router.GeoSiteList, error) {
+	return BuildDirContext(context.Background(), dir)
+}
+
+// BuildDirContext is BuildDir stopping between files and tags once ctx is
+// done.
+func BuildDirContext(ctx context.Context, dir string) (*router.GeoSiteList, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]*sourceList)
+	var names []string
+	files := make(map[string]string) // tag -> file name
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		src, err := parseSource(e.Name(), b)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(e.Name())
+		if prev, ok := files[name]; ok {
+			return nil, fmt.Errorf("%s and %s are the same tag, names differ only in case", prev, e.Name())
+		}
+		files[name] = e.Name()
+		sources[name] = src
+		names = append(names, name)
+	}
+
+	r := resolver{sources: sources, done: make(map[string][]*router.Domain), state: make(map[string]int)}
+	list := new(router.GeoSiteList)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rules, err := r.resolve(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		list.Entry = append(list.Entry, &router.GeoSite{CountryCode: strings.ToUpper(name), Domain: sortRules(rules)})
+	}
+	slices.SortFunc(list.Entry, func(a, b *router.GeoSite) int {
+		return strings.Compare(a.CountryCode, b.CountryCode)
+	})
+	return list, nil
+}
+
+// sortRules orders a copy of rules; the rules may be shared with other
+// tags through includes, so their attributes are sorted in copies too.
+func sortRules(rules []*router.Domain) []*router.Domain {
+	out := make([]*router.Domain, len(rules))
+	for i, d := range rules {
+		c := &router.Domain{Type: d.Type, Value: d.Value, Attribute: slices.Clone(d.Attribute)}
+		slices.SortFunc(c.Attribute, func(a, b *router.Domain_Attribute) int {
+			return strings.Compare(a.GetKey(), b.GetKey())
+		})
+		out[i] = c
+	}
+	slices.SortFunc(out, func(a, b *router.Domain) int {
+		if a.Type != b.Type {
+			return int(a.Type) - int(b.Type)
+		}
+		if c := strings.Compare(a.Value, b.Value); c != 0 {
+			return c
+		}
+		return strings.Compare(FormatRule(a), FormatRule(b))
+	})
+	return out
+}
+
+func parseSource(name string, b []byte) (*sourceList, error) {
+	src := new(sourceList)
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(line, "include:"); ok {
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("%s:%d: include: needs a list name", name, n)
+			}
+			inc := include{name: strings.ToLower(fields[0]), line: n}
+			for _, f := range fields[1:] {
+				attr, ok := strings.CutPrefix(f, "@")
+				if !ok || attr == "" || attr == "-" {
+					return nil, fmt.Errorf("%s:%d: unexpected %q, want @attr or @-attr", name, n, f)
+				}
+				if a, ok := strings.CutPrefix(attr, "-"); ok {
+					inc.without = append(inc.without, strings.ToLower(a))
+				} else {
+					inc.want = append(inc.want, strings.ToLower(attr))
+				}
+			}
+			src.includes = append(src.includes, inc)
+			continue
+		}
+
+		d, err := ParseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		src.rules = append(src.rules, d)
+	}
+	return src, sc.Err()
+}
+
+// resolver expands includes depth-first, caching finished lists.
+type resolver struct {
+	sources map[string]*sourceList
+	done    map[string][]*router.Domain
+	state   map[string]int // 1 while being resolved, 2 when done
+}
+
+func (r *resolver) resolve(name string, path []string) ([]*router.Domain, error) {
+	path = append(path, name)
+	switch r.state[name] {
+	case 2:
+		return r.done[name], nil
+	case 1:
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(path, " -> "))
+	}
+	src, ok := r.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: included list not found", strings.Join(path, " -> "))
+	}
+
+	r.state[name] = 1
+	var out []*router.Domain
+	seen := make(map[string]bool)
+	add := func(d *router.Domain) {
+		k := ruleKey(d)
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, d)
+		}
+	}
+	for _, d := range src.rules {
+		add(d)
+	}
+	for _, inc := range src.includes {
+		rules, err := r.resolve(inc.name, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range rules {
+			if HasAttrs(d, inc.want) && !hasAnyAttr(d, inc.without) {
+				add(d)
+			}
+		}
+	}
+	r.state[name] = 2
+	r.done[name] = out
+	return out, nil
+}
+
+func hasAnyAttr(d *router.Domain, attrs []string) bool {
+	for _, a := range d.GetAttribute() {
+		for _, x := range attrs {
+			if strings.EqualFold(a.GetKey(), x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ruleKey identifies a rule for deduplication by type, value and its
+// attributes in sorted order, so "@a @b" and "@b @a" are the same rule.
+func ruleKey(d *router.Domain) string {
+	keys := make([]string, 0, len(d.GetAttribute()))
+	for _, a := range d.GetAttribute() {
+		keys = append(keys, a.GetKey())
+	}
+	slices.Sort(keys)
+	return fmt.Sprintf("%d\x00%s\x00%s", d.GetType(), d.GetValue(), strings.Join(keys, "\x00"))
+}
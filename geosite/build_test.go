@@ -0,0 +1,48 @@
+package geosite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeLists(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuildDirDedupAttrOrder(t *testing.T) {
+	dir := writeLists(t, map[string]string{
+		"a":   "x.com @a @b\n",
+		"b":   "x.com @b @a\n",
+		"all": "include:a\ninclude:b\n",
+	})
+	list, err := BuildDirContext(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, site := range list.GetEntry() {
+		if site.GetCountryCode() != "ALL" {
+			continue
+		}
+		if n := len(site.GetDomain()); n != 1 {
+			t.Errorf("ALL has %d rules, want 1", n)
+		}
+		return
+	}
+	t.Fatal("no ALL tag")
+}
+
+func TestBuildDirCaseClash(t *testing.T) {
+	dir := writeLists(t, map[string]string{"Google": "google.com\n", "google": "g.co\n"})
+	if _, err := BuildDirContext(context.Background(), dir); err == nil {
+		t.Fatal("BuildDirContext succeeded with Google and google, want an error")
+	}
+}
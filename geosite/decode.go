@@ -0,0 +1,170 @@
+package geosite
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// DecodeOptions tunes decoding. The zero value is strict: the first
+// corrupt entry fails the whole load.
+type DecodeOptions struct {
+	// Lenient skips entries that do not parse and keeps the tags before
+	// a truncated or corrupt end instead of failing.
+	Lenient bool
+	// Warn, if set, is told about each entry Lenient mode got past.
+	Warn func(error)
+}
+
+// Decode parses a geosite.dat from r one entry at a time instead of
+// reading the whole file first, so peak memory is the parsed list plus
+// the largest tag rather than twice the file; it matters on routers.
+func Decode(r io.Reader) (*router.GeoSiteList, error) {
+	return DecodeContext(context.Background(), r)
+}
+
+// DecodeContext is Decode stopping between entries once ctx is done.
+func DecodeContext(ctx context.Context, r io.Reader) (*router.GeoSiteList, error) {
+	return DecodeOptions{}.Decode(ctx, r)
+}
+
+// Decode is DecodeContext with these options. Errors name the entry and
+// its byte offset, so a partial download reads as truncated rather than
+// as an opaque proto error.
+func (o DecodeOptions) Decode(ctx context.Context, r io.Reader) (*router.GeoSiteList, error) {
+	cr := &countingReader{br: bufio.NewReaderSize(r, 64<<10)}
+	list := new(router.GeoSiteList)
+	var buf []byte
+	for i := 0; ; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		at := cr.n
+		tag, err := binary.ReadUvarint(cr)
+		if err == io.EOF {
+			return list, nil
+		} else if err != nil {
+			return o.lenient(list, decodeErr(list, i, at, err))
+		}
+		num, typ := protowire.DecodeTag(tag)
+		if num != 1 || typ != protowire.BytesType {
+			if err := skipField(cr, typ); err != nil {
+				return o.lenient(list, decodeErr(list, i, at, fmt.Errorf("field %d: %w", num, err)))
+			}
+			continue
+		}
+
+		n, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return o.lenient(list, decodeErr(list, i, at, err))
+		} else if n > maxEntry {
+			return o.lenient(list, decodeErr(list, i, at, fmt.Errorf("entry of %d bytes, length is corrupt", n)))
+		}
+		buf = grow(buf, int(n))
+		if got, err := io.ReadFull(cr, buf); err != nil {
+			return o.lenient(list, decodeErr(list, i, at, fmt.Errorf("%w: %d of %d bytes, partial download?", io.ErrUnexpectedEOF, got, n)))
+		}
+		site := new(router.GeoSite)
+		if err := proto.Unmarshal(buf, site); err != nil {
+			// The length prefix held, so the next entry can still be read.
+			err = decodeErr(list, i, at, err)
+			if !o.Lenient {
+				return nil, err
+			}
+			o.warn(fmt.Errorf("%w, skipping it", err))
+		} else {
+			list.Entry = append(list.Entry, site)
+		}
+		i++
+	}
+}
+
+// lenient returns err, or in Lenient mode the tags decoded so far with a
+// warning.
+func (o DecodeOptions) lenient(list *router.GeoSiteList, err error) (*router.GeoSiteList, error) {
+	if !o.Lenient {
+		return nil, err
+	}
+	o.warn(fmt.Errorf("%w, keeping the %d tags before it", err, len(list.Entry)))
+	return list, nil
+}
+
+func (o DecodeOptions) warn(err error) {
+	if o.Warn != nil {
+		o.Warn(err)
+	}
+}
+
+// decodeErr places err at entry i starting at offset at, after the last
+// tag read.
+func decodeErr(list *router.GeoSiteList, i int, at int64, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	where := "first entry"
+	if n := len(list.Entry); n > 0 {
+		where = "after tag " + list.Entry[n-1].GetCountryCode()
+	}
+	return fmt.Errorf("geosite.dat: entry %d at offset %d (%s): %w", i, at, where, err)
+}
+
+// countingReader tracks the offset into the file for error messages.
+type countingReader struct {
+	br *bufio.Reader
+	n  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.br.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.br.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// maxEntry guards against allocating for a corrupt length prefix.
+const maxEntry = 1 << 30
+
+// grow returns buf resized to n bytes, reusing its storage when it fits.
+func grow(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+// skipField reads past an unknown top-level field.
+func skipField(r *countingReader, typ protowire.Type) error {
+	var n uint64
+	switch typ {
+	case protowire.VarintType:
+		_, err := binary.ReadUvarint(r)
+		return err
+	case protowire.Fixed32Type:
+		n = 4
+	case protowire.Fixed64Type:
+		n = 8
+	case protowire.BytesType:
+		var err error
+		if n, err = binary.ReadUvarint(r); err != nil {
+			return err
+		}
+	default:
+		return errors.New("unsupported wire type")
+	}
+	_, err := io.CopyN(io.Discard, r, int64(n))
+	return err
+}
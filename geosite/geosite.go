@@ -0,0 +1,621 @@
+package geosite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+type Match struct {
+	Selector   string `json:"selector"` // geosite:<tag> or geosite:<tag>@<attr>
+	Tag        string `json:"tag"`
+	Attr       string `json:"attr,omitempty"` // "" for base
+	GroupSize  int    `json:"size"`           // number of domain rules in that selector
+	Why        string `json:"why"`            // matched rule type: domain/full/plain/regex
+	WhyRuleVal string `json:"value"`          // matched rule value
+	Score      int    `json:"score"`          // 0-100, how specific the match is, see score
+}
+
+// Load reads a geosite.dat from a local path or an http(s) URL. Local
+// files are decoded as they are read, see Decode.
+func Load(path string) (*router.GeoSiteList, error) {
+	return LoadContext(context.Background(), path)
+}
+
+// LoadContext is Load giving up on the download or the decoding once ctx
+// is done.
+func LoadContext(ctx context.Context, path string) (*router.GeoSiteList, error) {
+	return DecodeOptions{}.Load(ctx, path)
+}
+
+// Load is LoadContext with these options.
+func (o DecodeOptions) Load(ctx context.Context, path string) (*router.GeoSiteList, error) {
+	f, err := fetch.OpenContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return o.Decode(ctx, f)
+}
+
+// LoadIfChanged is LoadContext that also returns the SHA-256 of the
+// file, hashed as it streams. If the sum equals prev the list is nil; a
+// local file is then only hashed, not decoded, so an unchanged file costs
+// one read and no memory beyond the buffer.
+func LoadIfChanged(ctx context.Context, path string, prev [sha256.Size]byte) (*router.GeoSiteList, [sha256.Size]byte, error) {
+	return DecodeOptions{}.LoadIfChanged(ctx, path, prev)
+}
+
+// LoadIfChanged is LoadIfChanged with these options.
+func (o DecodeOptions) LoadIfChanged(ctx context.Context, path string, prev [sha256.Size]byte) (*router.GeoSiteList, [sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	if prev != sum && path != "-" && !fetch.IsRemote(path) && !fetch.IsGit(path) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, sum, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, sum, err
+		}
+		if h.Sum(sum[:0]); sum == prev {
+			return nil, sum, nil
+		}
+	}
+
+	f, err := fetch.OpenContext(ctx, path)
+	if err != nil {
+		return nil, sum, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	tee := io.TeeReader(f, h)
+	list, err := o.Decode(ctx, tee)
+	if err != nil {
+		return nil, sum, err
+	}
+	// A lenient decode may stop early; the sum covers the whole file.
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return nil, sum, err
+	}
+	h.Sum(sum[:0])
+	if sum == prev {
+		return nil, sum, nil
+	}
+	return list, sum, nil
+}
+
+// Parse decodes a geosite.dat already in memory, as Decode does.
+func Parse(b []byte) (*router.GeoSiteList, error) {
+	return Decode(bytes.NewReader(b))
+}
+
+// Matcher finds every selector of a geosite list that covers a host. It
+// is safe for concurrent use; Reload swaps in a new list without blocking
+// lookups, which finish on the list they started with.
+type Matcher struct {
+	cur atomic.Pointer[index]
+}
+
+func NewMatcher(list *router.GeoSiteList) *Matcher {
+	m := new(Matcher)
+	m.Set(list)
+	return m
+}
+
+// Set replaces the list being matched.
+func (m *Matcher) Set(list *router.GeoSiteList) {
+	m.cur.Store(newIndex(list))
+}
+
+// Reload loads path as Load does and swaps it in; on error the current
+// list stays.
+func (m *Matcher) Reload(path string) error {
+	return m.ReloadContext(context.Background(), path)
+}
+
+// ReloadContext is Reload with LoadContext.
+func (m *Matcher) ReloadContext(ctx context.Context, path string) error {
+	list, err := LoadContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	m.Set(list)
+	return nil
+}
+
+func (m *Matcher) List() *router.GeoSiteList {
+	return m.cur.Load().list
+}
+
+// RegexErrors lists the regex rules that failed to compile, once per tag
+// and value.
+func (m *Matcher) RegexErrors() []RegexError {
+	return m.cur.Load().regexErrs
+}
+
+// Match returns all base and attribute selectors covering host, unsorted.
+func (m *Matcher) Match(host string) []Match {
+	return m.cur.Load().appendMatch(nil, host)
+}
+
+// AppendMatch is Match appending to dst, so batch callers can reuse one
+// slice; selector strings are shared, not allocated per call.
+func (m *Matcher) AppendMatch(dst []Match, host string) []Match {
+	return m.cur.Load().appendMatch(dst, host)
+}
+
+// MatchAll matches a batch of hosts against one snapshot of the list,
+// checking ctx every matchBatch hosts; on cancellation it returns the
+// results so far with ctx's error.
+func (m *Matcher) MatchAll(ctx context.Context, hosts []string) ([][]Match, error) {
+	ix := m.cur.Load()
+	out := make([][]Match, 0, len(hosts))
+	for i, h := range hosts {
+		if i%matchBatch == 0 {
+			if err := ctx.Err(); err != nil {
+				return out, err
+			}
+		}
+		out = append(out, ix.appendMatch(nil, h))
+	}
+	return out, nil
+}
+
+// matchBatch is how many hosts MatchAll matches between ctx checks.
+const matchBatch = 256
+
+// Covers reports whether the selector geosite:<tag>[@attr...] matches host.
+// Tags are compared case-insensitively, like v2ray does when loading them.
+func (m *Matcher) Covers(selector, host string) bool {
+	return m.cur.Load().covers(selector, host)
+}
+
+// Rules lists the rules behind a selector such as "geosite:google@cn".
+func (m *Matcher) Rules(selector string) []*router.Domain {
+	return m.cur.Load().selectorRules(selector)
+}
+
+// index is an immutable snapshot of one list prepared for lookups.
+type index struct {
+	list      *router.GeoSiteList
+	baseSize  map[string]int            // tag -> count
+	attrSize  map[string]map[string]int // tag -> attr -> count
+	regexErrs []RegexError
+
+	// Rule values are normalized once here, lookups compare them as is.
+	rules  []ruleRef          // every rule in list order
+	plain  *acAutomaton       // plain values -> index in rules
+	suffix map[string][]int32 // domain values
+	full   map[string][]int32 // full values
+	regex  []int32            // regex rules, tried one by one
+
+	selectors []Match   // interned selectors with sizes, Why left empty
+	hitPool   sync.Pool // *[]int32 scratch for hits
+}
+
+type ruleRef struct {
+	tag  string
+	rule *router.Domain
+	val  string         // normalized value, see ruleValue
+	re   *regexp.Regexp // compiled regex rule, nil if invalid
+	kind string         // as reported in Match.Why
+	sels []int32        // base selector, then one per attribute
+}
+
+// RegexError is a regex rule that does not compile; it never matches.
+type RegexError struct {
+	Tag   string
+	Value string
+	Err   error
+}
+
+func (e RegexError) Error() string {
+	return fmt.Sprintf("geosite:%s: bad regexp %q: %v", e.Tag, e.Value, e.Err)
+}
+
+func newIndex(list *router.GeoSiteList) *index {
+	m := &index{list: list}
+	m.baseSize, m.attrSize = computeSizes(list)
+	m.indexRules()
+	return m
+}
+
+// indexRules numbers the rules and files each normalized value under its
+// rule type.
+func (m *index) indexRules() {
+	var compiled map[string]*regexp.Regexp
+	compiled, m.regexErrs = compileRegexps(m.list)
+	m.plain = newACAutomaton()
+	m.suffix = make(map[string][]int32)
+	m.full = make(map[string][]int32)
+	selID := make(map[string]int32)
+	intern := func(tag, attr string) int32 {
+		sel := "geosite:" + tag
+		size := m.baseSize[tag]
+		if attr != "" {
+			sel += "@" + attr
+			size = m.attrSize[tag][attr]
+		}
+		id, ok := selID[sel]
+		if !ok {
+			id = int32(len(m.selectors))
+			selID[sel] = id
+			m.selectors = append(m.selectors, Match{Selector: sel, Tag: tag, Attr: attr, GroupSize: size})
+		}
+		return id
+	}
+
+	for _, site := range loadedSites(m.list) {
+		tag := site.GetCountryCode()
+		for _, d := range site.GetDomain() {
+			id := int32(len(m.rules))
+			val := ruleValue(d)
+			ref := ruleRef{tag: tag, rule: d, val: val, kind: matchKind(d), sels: []int32{intern(tag, "")}}
+			for _, k := range attrKeys(d) {
+				ref.sels = append(ref.sels, intern(tag, k))
+			}
+			switch t := int32(d.GetType()); {
+			case val == "":
+			case t == 0:
+				m.plain.add(val, id)
+			case t == 1:
+				ref.re = compiled[val]
+				m.regex = append(m.regex, id)
+			case t == 2:
+				m.suffix[val] = append(m.suffix[val], id)
+			default:
+				// Full, and unknown types as exact matches like MatchRule.
+				m.full[val] = append(m.full[val], id)
+			}
+			m.rules = append(m.rules, ref)
+		}
+	}
+	m.plain.build()
+	m.hitPool.New = func() any { return new([]int32) }
+}
+
+// compileRegexps compiles all regex rules up front on a worker pool, so
+// lookups never compile and bad patterns are known at load time.
+func compileRegexps(list *router.GeoSiteList) (map[string]*regexp.Regexp, []RegexError) {
+	type job struct {
+		tag, val string
+	}
+	var jobs []job
+	seen := make(map[job]bool)
+	for _, site := range list.GetEntry() {
+		for _, d := range site.GetDomain() {
+			if int32(d.GetType()) != 1 {
+				continue
+			}
+			j := job{site.GetCountryCode(), ruleValue(d)}
+			if j.val == "" || seen[j] {
+				continue
+			}
+			seen[j] = true
+			jobs = append(jobs, j)
+		}
+	}
+
+	res := make([]*regexp.Regexp, len(jobs))
+	errs := make([]error, len(jobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), max(len(jobs), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				res[i], errs[i] = regexp.Compile(jobs[i].val)
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	cache := make(map[string]*regexp.Regexp, len(jobs))
+	var bad []RegexError
+	for i, j := range jobs {
+		cache[j.val] = res[i]
+		if errs[i] != nil {
+			bad = append(bad, RegexError{Tag: j.tag, Value: j.val, Err: errs[i]})
+		}
+	}
+	return cache, bad
+}
+
+// computeSizes counts the rules of each tag and, per lower-cased
+// attribute, the rules carrying it, as v2ray would load them.
+func computeSizes(geo *router.GeoSiteList) (map[string]int, map[string]map[string]int) {
+	base := make(map[string]int)
+	attr := make(map[string]map[string]int)
+
+	for _, site := range loadedSites(geo) {
+		tag := site.GetCountryCode()
+		domains := site.GetDomain()
+
+		base[tag] = len(domains)
+		attr[tag] = make(map[string]int)
+		for _, d := range domains {
+			for _, k := range attrKeys(d) {
+				attr[tag][k]++
+			}
+		}
+	}
+
+	return base, attr
+}
+
+// loadedSites drops the entries v2ray never loads: it takes the first
+// entry whose tag equals the selector's case-insensitively, so a later
+// entry with the same tag is dead.
+func loadedSites(geo *router.GeoSiteList) []*router.GeoSite {
+	seen := make(map[string]bool)
+	out := make([]*router.GeoSite, 0, len(geo.GetEntry()))
+	for _, site := range geo.GetEntry() {
+		tag := strings.ToLower(site.GetCountryCode())
+		if !seen[tag] {
+			seen[tag] = true
+			out = append(out, site)
+		}
+	}
+	return out
+}
+
+// attrKeys lists the attributes of a rule lower-cased and once each, as
+// selectors name them.
+func attrKeys(d *router.Domain) []string {
+	var keys []string
+	for _, a := range d.GetAttribute() {
+		if k := strings.ToLower(strings.TrimSpace(a.GetKey())); k != "" && !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (m *index) appendMatch(dst []Match, host string) []Match {
+	buf := m.hitPool.Get().(*[]int32)
+	*buf = m.appendHits((*buf)[:0], host)
+	start := len(dst)
+
+	// The first hit of a selector explains it.
+next:
+	for _, id := range *buf {
+		r := &m.rules[id]
+		for _, sel := range r.sels {
+			s := &m.selectors[sel]
+			for i := start; i < len(dst); i++ {
+				if dst[i].Selector == s.Selector {
+					continue next
+				}
+			}
+			match := *s
+			match.Why, match.WhyRuleVal = r.kind, r.rule.GetValue()
+			match.Score = score(r.kind, r.val, host, match.GroupSize)
+			dst = append(dst, match)
+		}
+	}
+	m.hitPool.Put(buf)
+	return dst
+}
+
+// score rates a match by how much it says about host: the rule type
+// (full > domain > regex > plain) counts for up to 50, the share of host
+// the value spells out for 25 and a small group for 25. A keyword "goo"
+// in a 10k-rule tag thus ranks below domain:google.com in a big one.
+func score(kind, value, host string, size int) int {
+	var s float64
+	switch kind {
+	case "full":
+		s = 50
+	case "domain":
+		s = 40
+	case "regex":
+		s = 20
+	case "plain":
+		s = 10
+	}
+	if len(host) > 0 {
+		s += 25 * float64(min(len(value), len(host))) / float64(len(host))
+	}
+	s += 25 / (1 + math.Log10(float64(max(size, 1))))
+	return int(math.Round(s))
+}
+
+// appendHits appends the rules matching host in list order to dst.
+func (m *index) appendHits(dst []int32, host string) []int32 {
+	start := len(dst)
+	dst = m.plain.appendMatches(dst, host)
+	dst = append(dst, m.full[host]...)
+	for s := host; ; {
+		dst = append(dst, m.suffix[s]...)
+		i := strings.IndexByte(s, '.')
+		if i < 0 {
+			break
+		}
+		s = s[i+1:]
+	}
+	for _, id := range m.regex {
+		if re := m.rules[id].re; re != nil && re.MatchString(host) {
+			dst = append(dst, id)
+		}
+	}
+	hits := dst[start:]
+	slices.Sort(hits)
+	return dst[:start+len(slices.Compact(hits))]
+}
+
+func (m *index) covers(selector, host string) bool {
+	tag, attrs := SplitSelector(selector)
+
+	buf := m.hitPool.Get().(*[]int32)
+	defer m.hitPool.Put(buf)
+	*buf = m.appendHits((*buf)[:0], host)
+	for _, id := range *buf {
+		r := m.rules[id]
+		if strings.EqualFold(r.tag, tag) && HasAttrs(r.rule, attrs) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *index) selectorRules(selector string) []*router.Domain {
+	tag, attrs := SplitSelector(selector)
+
+	var out []*router.Domain
+	for _, site := range m.list.GetEntry() {
+		if !strings.EqualFold(site.GetCountryCode(), tag) {
+			continue
+		}
+		for _, rule := range site.GetDomain() {
+			if HasAttrs(rule, attrs) {
+				out = append(out, rule)
+			}
+		}
+		break // later entries with the tag are never loaded
+	}
+	return out
+}
+
+// HasAttrs reports whether d carries every one of attrs, compared
+// case-insensitively: v2ray filters a tag's rules by all the attributes
+// of a selector, geosite:google@cn@ads taking the rules with both.
+func HasAttrs(d *router.Domain, attrs []string) bool {
+	for _, want := range attrs {
+		found := false
+		for _, a := range d.GetAttribute() {
+			if strings.EqualFold(a.GetKey(), want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitSelector parses geosite:<tag>[@attr...] the way v2ray-core does:
+// attributes are trimmed and lower-cased, empty ones dropped, so
+// geosite:cn@ is geosite:cn.
+func SplitSelector(sel string) (tag string, attrs []string) {
+	parts := strings.Split(strings.TrimPrefix(sel, "geosite:"), "@")
+	for _, a := range parts[1:] {
+		if a = strings.ToLower(strings.TrimSpace(a)); a != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	return strings.TrimSpace(parts[0]), attrs
+}
+
+// ParseSelector is SplitSelector with the attributes joined by "@".
+func ParseSelector(sel string) (tag string, attr string) {
+	tag, attrs := SplitSelector(sel)
+	return tag, strings.Join(attrs, "@")
+}
+
+// IMPORTANT COMPAT FIX:
+// Different v2fly/v2ray-core versions generate different enum constant names.
+// To avoid "undefined: router.Domain_Domain", we match by the numeric enum values.
+// According to the proto, the mapping is typically:
+//
+//	Plain=0, Regex=1, Domain=2, Full=3
+//
+// If your version differs, you can adjust the numbers below.
+func MatchRule(host string, d *router.Domain, cache map[string]*regexp.Regexp) (bool, string) {
+	val := ruleValue(d)
+	if val == "" {
+		return false, ""
+	}
+
+	t := int32(d.GetType())
+
+	switch t {
+	case 0: // Plain
+		if strings.Contains(host, val) {
+			return true, "plain"
+		}
+		return false, "plain"
+
+	case 2: // Domain (suffix)
+		if host == val || strings.HasSuffix(host, "."+val) {
+			return true, "domain"
+		}
+		return false, "domain"
+
+	case 3: // Full
+		if host == val {
+			return true, "full"
+		}
+		return false, "full"
+
+	case 1: // Regex
+		re, ok := cache[val]
+		if !ok {
+			r, err := regexp.Compile(val)
+			if err != nil {
+				cache[val] = nil
+				return false, "regex"
+			}
+			cache[val] = r
+			re = r
+		}
+		if re != nil && re.MatchString(host) {
+			return true, "regex"
+		}
+		return false, "regex"
+
+	default:
+		// Conservative fallback: exact match only
+		if host == val {
+			return true, "unknown"
+		}
+		return false, "unknown"
+	}
+}
+
+// ruleValue is the rule value as compared against hosts. Regexps stay
+// as written: v2ray compiles them so and matches case-sensitively.
+func ruleValue(d *router.Domain) string {
+	if int32(d.GetType()) == 1 {
+		return strings.TrimSpace(d.GetValue())
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d.GetValue()), "."))
+}
+
+// matchKind names a rule type the way MatchRule reports it.
+func matchKind(d *router.Domain) string {
+	switch int32(d.GetType()) {
+	case 0:
+		return "plain"
+	case 1:
+		return "regex"
+	case 2:
+		return "domain"
+	case 3:
+		return "full"
+	default:
+		return "unknown"
+	}
+}
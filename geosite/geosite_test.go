@@ -0,0 +1,167 @@
+package geosite
+
+import (
+	"slices"
+	"testing"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+func rule(t router.Domain_Type, v string, attrs ...string) *router.Domain {
+	d := &router.Domain{Type: t, Value: v}
+	for _, a := range attrs {
+		d.Attribute = append(d.Attribute, &router.Domain_Attribute{Key: a, TypedValue: &router.Domain_Attribute_BoolValue{BoolValue: true}})
+	}
+	return d
+}
+
+// attrList is loaded by v2ray-core as: MIX@cn = a.com, b.com, kw;
+// MIX@ads = a.com, c.com; MIX@cn@ads = a.com; dup = first.com only.
+func attrList() *router.GeoSiteList {
+	return &router.GeoSiteList{Entry: []*router.GeoSite{
+		{CountryCode: "MIX", Domain: []*router.Domain{
+			rule(router.Domain_RootDomain, "a.com", "cn", "ads"),
+			rule(router.Domain_RootDomain, "b.com", "CN"),
+			rule(router.Domain_RootDomain, "c.com", "ads", "ads"),
+			rule(router.Domain_Full, "d.com"),
+			rule(router.Domain_Plain, "kw", "cn"),
+		}},
+		{CountryCode: "DUP", Domain: []*router.Domain{rule(router.Domain_RootDomain, "first.com")}},
+		{CountryCode: "dup", Domain: []*router.Domain{rule(router.Domain_RootDomain, "second.com", "cn")}},
+	}}
+}
+
+func TestSplitSelector(t *testing.T) {
+	tests := []struct {
+		sel   string
+		tag   string
+		attrs []string
+	}{
+		{"geosite:cn", "cn", nil},
+		{"cn@ads", "cn", []string{"ads"}},
+		{"geosite:cn@ CN @", "cn", []string{"cn"}},
+		{"geosite:google@cn@ADS", "google", []string{"cn", "ads"}},
+		{"geosite:cn@", "cn", nil},
+		{"geosite: cn @@ads", "cn", []string{"ads"}},
+	}
+	for _, tt := range tests {
+		tag, attrs := SplitSelector(tt.sel)
+		if tag != tt.tag || !slices.Equal(attrs, tt.attrs) {
+			t.Errorf("SplitSelector(%q) = %q, %q; want %q, %q", tt.sel, tag, attrs, tt.tag, tt.attrs)
+		}
+	}
+}
+
+func TestHasAttrs(t *testing.T) {
+	d := rule(router.Domain_RootDomain, "a.com", "CN", "ads")
+	tests := []struct {
+		attrs []string
+		want  bool
+	}{
+		{nil, true},
+		{[]string{"cn"}, true},
+		{[]string{"Cn"}, true},
+		{[]string{"cn", "ads"}, true},
+		{[]string{"cn", "old"}, false},
+		{[]string{"old"}, false},
+	}
+	for _, tt := range tests {
+		if got := HasAttrs(d, tt.attrs); got != tt.want {
+			t.Errorf("HasAttrs(%q) = %v, want %v", tt.attrs, got, tt.want)
+		}
+	}
+}
+
+// TestSelectorSemantics checks the rules and coverage of selectors against
+// what v2ray-core's geodata loader returns for attrList.
+func TestSelectorSemantics(t *testing.T) {
+	m := NewMatcher(attrList())
+	tests := []struct {
+		sel    string
+		rules  []string
+		covers []string
+	}{
+		{"geosite:mix", []string{"a.com", "b.com", "c.com", "d.com", "kw"}, []string{"a.com", "x.b.com", "c.com", "d.com", "kw.org"}},
+		{"geosite:mix@cn", []string{"a.com", "b.com", "kw"}, []string{"a.com", "x.b.com", "kw.org"}},
+		{"geosite:MIX@CN", []string{"a.com", "b.com", "kw"}, []string{"a.com", "x.b.com", "kw.org"}},
+		{"geosite:mix@ cn ", []string{"a.com", "b.com", "kw"}, []string{"a.com", "x.b.com", "kw.org"}},
+		{"geosite:mix@ads", []string{"a.com", "c.com"}, []string{"a.com", "c.com"}},
+		{"geosite:mix@cn@ads", []string{"a.com"}, []string{"a.com"}},
+		{"geosite:mix@ads@cn", []string{"a.com"}, []string{"a.com"}},
+		{"geosite:mix@", []string{"a.com", "b.com", "c.com", "d.com", "kw"}, []string{"a.com", "x.b.com", "c.com", "d.com", "kw.org"}},
+		{"geosite:dup", []string{"first.com"}, []string{"first.com"}},
+		{"geosite:Dup", []string{"first.com"}, []string{"first.com"}},
+		{"geosite:dup@cn", nil, nil},
+	}
+	hosts := []string{"a.com", "x.b.com", "c.com", "d.com", "kw.org", "first.com", "second.com"}
+	for _, tt := range tests {
+		var rules []string
+		for _, d := range m.Rules(tt.sel) {
+			rules = append(rules, d.GetValue())
+		}
+		if !slices.Equal(rules, tt.rules) {
+			t.Errorf("Rules(%q) = %q, want %q", tt.sel, rules, tt.rules)
+		}
+		for _, h := range hosts {
+			if got, want := m.Covers(tt.sel, h), slices.Contains(tt.covers, h); got != want {
+				t.Errorf("Covers(%q, %q) = %v, want %v", tt.sel, h, got, want)
+			}
+		}
+	}
+}
+
+// TestMatchSizes checks the emitted selectors and their sizes: attribute
+// keys are compared case-insensitively and counted once per rule, and a
+// later entry of the same tag is never loaded.
+func TestMatchSizes(t *testing.T) {
+	m := NewMatcher(attrList())
+	tests := []struct {
+		host string
+		want map[string]int
+	}{
+		{"a.com", map[string]int{"geosite:MIX": 5, "geosite:MIX@cn": 3, "geosite:MIX@ads": 2}},
+		{"x.b.com", map[string]int{"geosite:MIX": 5, "geosite:MIX@cn": 3}},
+		{"c.com", map[string]int{"geosite:MIX": 5, "geosite:MIX@ads": 2}},
+		{"first.com", map[string]int{"geosite:DUP": 1}},
+		{"second.com", map[string]int{}},
+	}
+	for _, tt := range tests {
+		got := make(map[string]int)
+		for _, mt := range m.Match(tt.host) {
+			got[mt.Selector] = mt.GroupSize
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Match(%q) = %v, want %v", tt.host, got, tt.want)
+			continue
+		}
+		for sel, size := range tt.want {
+			if got[sel] != size {
+				t.Errorf("Match(%q) = %v, want %v", tt.host, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// TestRegexAsWritten checks regex rules are compiled as written, as
+// v2ray does: lower-casing would turn \S into \s and [A-Z] into [a-z].
+func TestRegexAsWritten(t *testing.T) {
+	m := NewMatcher(&router.GeoSiteList{Entry: []*router.GeoSite{
+		{CountryCode: "RE", Domain: []*router.Domain{
+			rule(router.Domain_Regex, `^\S+\.org$`),
+			rule(router.Domain_Regex, `^[A-Z]+\.com$`),
+		}},
+	}})
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"x.org", true},
+		{"abc.com", false},
+	}
+	for _, tt := range tests {
+		if got := len(m.Match(tt.host)) > 0; got != tt.want {
+			t.Errorf("Match(%q) found = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package geosite
+
+import (
+	"fmt"
+	"strings"
+
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+)
+
+// ParseRule reads a rule in domain-list-community syntax:
+// [domain:|full:|keyword:|regexp:]value [@attr...]. A bare value is a
+// domain rule, as upstream; "value@attr" is accepted too.
+func ParseRule(s string) (*router.Domain, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty rule")
+	}
+
+	d := new(router.Domain)
+	val := fields[0]
+	if i := strings.Index(val, "@"); i > 0 && !strings.HasPrefix(val, "regexp:") {
+		fields = append(fields, val[i:])
+		val = val[:i]
+	}
+
+	kind, rest, ok := strings.Cut(val, ":")
+	if !ok {
+		kind, rest = "domain", val
+	}
+	switch kind {
+	case "domain":
+		d.Type = router.Domain_Type(2)
+	case "full":
+		d.Type = router.Domain_Type(3)
+	case "keyword":
+		d.Type = router.Domain_Type(0)
+	case "regexp":
+		d.Type = router.Domain_Type(1)
+	default:
+		return nil, fmt.Errorf("unknown rule type %q in %q", kind, s)
+	}
+	if kind != "regexp" {
+		rest = strings.ToLower(rest)
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("empty value in %q", s)
+	}
+	d.Value = rest
+
+	for _, f := range fields[1:] {
+		attrs, ok := strings.CutPrefix(f, "@")
+		if !ok || strings.Trim(attrs, "@") == "" {
+			return nil, fmt.Errorf("unexpected %q in %q, want @attr", f, s)
+		}
+		// "@a@b" is two attributes, as in "value@a@b".
+		for _, attr := range strings.Split(attrs, "@") {
+			if attr == "" {
+				continue
+			}
+			d.Attribute = append(d.Attribute, &router.Domain_Attribute{
+				Key:        strings.ToLower(attr),
+				TypedValue: &router.Domain_Attribute_BoolValue{BoolValue: true},
+			})
+		}
+	}
+	return d, nil
+}
+
+// FormatRule is the inverse of ParseRule.
+func FormatRule(d *router.Domain) string {
+	var b strings.Builder
+	b.WriteString(ruleType(d) + ":" + d.GetValue())
+	for _, a := range d.GetAttribute() {
+		b.WriteString(" @" + a.GetKey())
+	}
+	return b.String()
+}
+
+// ruleType names a rule type by number, see MatchRule.
+func ruleType(d *router.Domain) string {
+	switch int32(d.GetType()) {
+	case 1:
+		return "regexp"
+	case 2:
+		return "domain"
+	case 3:
+		return "full"
+	default:
+		return "keyword"
+	}
+}
+
+// SameRule compares type and value, ignoring attributes.
+func SameRule(a, b *router.Domain) bool {
+	return a.GetType() == b.GetType() && strings.EqualFold(a.GetValue(), b.GetValue())
+}
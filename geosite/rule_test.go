@@ -0,0 +1,32 @@
+package geosite
+
+import "testing"
+
+func TestParseRuleAttrs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"a.com@cn", "domain:a.com @cn"},
+		{"a.com@cn@ADS", "domain:a.com @cn @ads"},
+		{"full:a.com @cn@ads", "full:a.com @cn @ads"},
+		{"a.com @cn @ads", "domain:a.com @cn @ads"},
+		{"a.com@cn@@ads@", "domain:a.com @cn @ads"},
+		{"regexp:^a@b$", "regexp:^a@b$"},
+	}
+	for _, tt := range tests {
+		d, err := ParseRule(tt.in)
+		if err != nil {
+			t.Errorf("ParseRule(%q): %v", tt.in, err)
+			continue
+		}
+		if got := FormatRule(d); got != tt.want {
+			t.Errorf("ParseRule(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"a.com @", "a.com @@"} {
+		if _, err := ParseRule(in); err == nil {
+			t.Errorf("ParseRule(%q) succeeded, want an error", in)
+		}
+	}
+}
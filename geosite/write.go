@@ -0,0 +1,33 @@
+package geosite
+
+import (
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/atomicfile"
+	router "github.com/v2fly/v2ray-core/v5/app/router/routercommon"
+	"google.golang.org/protobuf/proto"
+)
+
+// Marshal serializes a list the way v2ray reads it.
+func Marshal(list *router.GeoSiteList) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(list)
+}
+
+// Save writes a list to path atomically.
+func Save(path string, list *router.GeoSiteList) error {
+	b, err := Marshal(list)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, b)
+}
+
+// Find returns the entry with the tag, compared case-insensitively.
+func Find(list *router.GeoSiteList, tag string) *router.GeoSite {
+	for _, site := range list.GetEntry() {
+		if strings.EqualFold(site.GetCountryCode(), tag) {
+			return site
+		}
+	}
+	return nil
+}
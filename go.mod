@@ -3,13 +3,17 @@ module github.com/devemio/v2raytun-routing
 go 1.25
 
 require (
+	github.com/adrg/xdg v0.5.3
 	github.com/google/uuid v1.6.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/v2fly/v2ray-core/v5 v5.42.0
+	golang.org/x/net v0.47.0
+	golang.org/x/text v0.31.0
 	google.golang.org/protobuf v1.36.11
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/adrg/xdg v0.5.3 // indirect
 	github.com/golang/protobuf v1.5.4 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 )
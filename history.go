@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// HistoryEntry is one generated link, stored as a JSON line.
+type HistoryEntry struct {
+	N      int               `json:"n"`
+	Time   time.Time         `json:"time"`
+	Inputs map[string]string `json:"inputs"` // path -> sha256
+	Size   int               `json:"size"`
+	Note   string            `json:"note,omitempty"`
+	Link   string            `json:"link"`
+}
+
+// historyPath returns the history file, $V2RAYTUN_HISTORY or the XDG state dir.
+func historyPath() (string, error) {
+	if p := os.Getenv("V2RAYTUN_HISTORY"); p != "" {
+		return p, nil
+	}
+	return xdg.StateFile("v2raytun-routing/history.jsonl")
+}
+
+func readHistory() ([]HistoryEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []HistoryEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e HistoryEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+func recordHistory(link, note string, inputs map[string]string) error {
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+
+	e := HistoryEntry{
+		N:      1,
+		Time:   time.Now().UTC(),
+		Inputs: inputs,
+		Size:   len(link),
+		Note:   note,
+		Link:   link,
+	}
+	if len(entries) > 0 {
+		e.N = entries[len(entries)-1].N + 1
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func findHistory(n int) (HistoryEntry, error) {
+	entries, err := readHistory()
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	for _, e := range entries {
+		if e.N == n {
+			return e, nil
+		}
+	}
+	return HistoryEntry{}, fmt.Errorf("history entry %d not found", n)
+}
+
+// lastHistory returns the most recently generated link.
+func lastHistory() (HistoryEntry, error) {
+	entries, err := readHistory()
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	if len(entries) == 0 {
+		return HistoryEntry{}, errors.New("history is empty")
+	}
+	return entries[len(entries)-1], nil
+}
+
+func historyCmd(args []string) {
+	if len(args) == 0 {
+		fail("usage: go run . history list | history show N")
+	}
+
+	switch args[0] {
+	case "list":
+		entries, err := readHistory()
+		if err != nil {
+			fail(err.Error())
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "N\tTIME\tSIZE\tINPUTS\tNOTE")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n", e.N, e.Time.Local().Format(time.DateTime), e.Size, inputsSummary(e.Inputs), e.Note)
+		}
+		_ = tw.Flush()
+
+	case "show":
+		e := historyArg(args[1:])
+		fmt.Print(e.Link)
+
+	default:
+		fail("unknown history command: " + args[0])
+	}
+}
+
+// rollback re-emits link N and records it as the newest entry.
+func rollback(args []string) {
+	e := historyArg(args)
+	if err := recordHistory(e.Link, fmt.Sprintf("rollback to %d", e.N), nil); err != nil {
+		fail(err.Error())
+	}
+	fmt.Print(e.Link)
+}
+
+func historyArg(args []string) HistoryEntry {
+	if len(args) != 1 {
+		fail("history entry number required")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		fail(fmt.Sprintf("invalid history entry %q", args[0]))
+	}
+	e, err := findHistory(n)
+	if err != nil {
+		fail(err.Error())
+	}
+	return e
+}
+
+func inputsSummary(inputs map[string]string) string {
+	if len(inputs) == 0 {
+		return "-"
+	}
+	paths := make([]string, 0, len(inputs))
+	for path := range inputs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	parts := make([]string, 0, len(paths))
+	for _, path := range paths {
+		sum := inputs[path]
+		if len(sum) > 8 {
+			sum = sum[:8]
+		}
+		parts = append(parts, path+"@"+sum)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// groupBuilder collects rules of another client's config into groups by
+// outbound, the way parseMapping does for CSV: the first outbound of an
+// entry wins and later ones are reported.
+type groupBuilder struct {
+	path   string
+	groups []ruleGroup
+	index  map[string]int    // outbound -> groups index
+	seen   map[string]string // entry -> outbound
+}
+
+func newGroupBuilder(path string) *groupBuilder {
+	return &groupBuilder{path: path, index: make(map[string]int), seen: make(map[string]string)}
+}
+
+// add normalizes entry and files it under outbound. Entries this tool
+// cannot express are skipped with a warning by the caller.
+func (b *groupBuilder) add(outbound, entry string) {
+	e, err := normalizeEntry(entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %s: skipping %q: %v\n", b.path, entry, err)
+		return
+	}
+	if prev, ok := b.seen[e]; ok {
+		if prev != outbound {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s already mapped to %s, ignoring %s\n", b.path, e, prev, outbound)
+		}
+		return
+	}
+	b.seen[e] = outbound
+
+	i, ok := b.index[outbound]
+	if !ok {
+		i = len(b.groups)
+		b.index[outbound] = i
+		b.groups = append(b.groups, ruleGroup{
+			Name:     ruleName(outbound),
+			Outbound: outbound,
+			Attrs:    make(map[string][]string),
+			Sections: make(map[string][]string),
+			Notes:    make(map[string]string),
+		})
+	}
+	b.groups[i].Domains = append(b.groups[i].Domains, e)
+}
+
+// skip reports an entry of the source format that has no equivalent here.
+func (b *groupBuilder) skip(what string) {
+	fmt.Fprintf(os.Stderr, "warning: %s: %s not supported, skipped\n", b.path, what)
+}
+
+func (b *groupBuilder) result() ([]ruleGroup, error) {
+	if len(b.groups) == 0 {
+		return nil, fmt.Errorf("no domain rules found")
+	}
+	return b.groups, nil
+}
+
+// parseJSONSource tells the JSON configs apart by their top-level keys.
+func parseJSONSource(path string, b []byte) ([]ruleGroup, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(b, &top); err == nil {
+		_, route := top["route"]
+		_, version := top["version"]
+		_, rules := top["rules"]
+		if route || (version && rules && !bytes.Contains(top["rules"], []byte(`"outboundTag"`))) {
+			return parseSingBox(path, b)
+		}
+		// A v2rayTun route has an id; Xray's routing object does not.
+		_, routing := top["routing"]
+		_, id := top["id"]
+		if routing || (rules && !id) {
+			return parseXray(path, b)
+		}
+	}
+	return parseV2rayTunBackup(path, b)
+}
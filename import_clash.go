@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+	"gopkg.in/yaml.v3"
+)
+
+// clashConfig is the part of a Clash/mihomo config that routes.
+type clashConfig struct {
+	Rules     []string                 `yaml:"rules"`
+	Providers map[string]clashProvider `yaml:"rule-providers"`
+}
+
+type clashProvider struct {
+	Type     string   `yaml:"type"`     // http, file or inline
+	Behavior string   `yaml:"behavior"` // domain, ipcidr or classical
+	Format   string   `yaml:"format"`   // yaml (default), text or mrs
+	URL      string   `yaml:"url"`
+	Path     string   `yaml:"path"`
+	Payload  []string `yaml:"payload"`
+}
+
+// parseClash imports the rules: of a Clash/mihomo config, expanding
+// RULE-SET entries from their rule-providers. Policies map to outbounds
+// with policyOutbound.
+func parseClash(path string, b []byte) ([]ruleGroup, error) {
+	var cfg clashConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, fmt.Errorf("no rules: section")
+	}
+
+	gb := newGroupBuilder(path)
+	for _, line := range cfg.Rules {
+		f := splitRule(line)
+		if len(f) < 2 {
+			continue
+		}
+		kind := strings.ToUpper(f[0])
+		if kind == "MATCH" || kind == "FINAL" {
+			gb.skip(fmt.Sprintf("final rule %q", line))
+			continue
+		}
+		if len(f) < 3 {
+			gb.skip(fmt.Sprintf("rule %q", line))
+			continue
+		}
+		outbound := policyOutbound(f[2])
+		if kind != "RULE-SET" {
+			addClashRule(gb, outbound, kind, f[1], line)
+			continue
+		}
+
+		p, ok := cfg.Providers[f[1]]
+		if !ok {
+			return nil, fmt.Errorf("rule %q: no rule-provider %s", line, f[1])
+		}
+		payload, err := p.load(path)
+		if err != nil {
+			return nil, fmt.Errorf("rule-provider %s: %w", f[1], err)
+		}
+		for _, e := range payload {
+			switch strings.ToLower(p.Behavior) {
+			case "domain":
+				addClashDomain(gb, outbound, e)
+			case "ipcidr":
+				gb.add(outbound, e)
+			default: // classical
+				if rf := splitRule(e); len(rf) >= 2 {
+					addClashRule(gb, outbound, strings.ToUpper(rf[0]), rf[1], e)
+				}
+			}
+		}
+	}
+	return gb.result()
+}
+
+// splitRule splits "TYPE,value,policy[,options]" into trimmed fields.
+func splitRule(s string) []string {
+	f := strings.Split(s, ",")
+	for i := range f {
+		f[i] = strings.TrimSpace(f[i])
+	}
+	return f
+}
+
+// addClashRule converts one classical rule; Surge and Shadowrocket use
+// the same types.
+func addClashRule(gb *groupBuilder, outbound, kind, value, line string) {
+	switch kind {
+	case "DOMAIN":
+		gb.add(outbound, "full:"+value)
+	case "DOMAIN-SUFFIX":
+		gb.add(outbound, "domain:"+value)
+	case "DOMAIN-KEYWORD":
+		gb.add(outbound, "keyword:"+value)
+	case "DOMAIN-REGEX":
+		gb.add(outbound, "regexp:"+value)
+	case "GEOSITE":
+		gb.add(outbound, "geosite:"+value)
+	case "GEOIP":
+		gb.add(outbound, "geoip:"+value)
+	case "IP-CIDR", "IP-CIDR6":
+		gb.add(outbound, value)
+	case "PROCESS-NAME", "PROCESS-PATH":
+		gb.add(outbound, "process:"+value)
+	default:
+		gb.skip(fmt.Sprintf("rule %q", line))
+	}
+}
+
+// addClashDomain converts an entry of a domain provider: "+.x" is x and
+// its subdomains, ".x" and "*.x" only subdomains, a bare name exact.
+func addClashDomain(gb *groupBuilder, outbound, e string) {
+	switch {
+	case strings.HasPrefix(e, "+."):
+		gb.add(outbound, "domain:"+e[2:])
+	case strings.HasPrefix(e, ".") || strings.HasPrefix(e, "*."):
+		// v2ray has no subdomains-only match; domain: also takes the
+		// name itself.
+		gb.add(outbound, "domain:"+strings.TrimLeft(e, "*."))
+	case strings.Contains(e, "*"):
+		gb.skip(fmt.Sprintf("wildcard %q", e))
+	default:
+		gb.add(outbound, "full:"+e)
+	}
+}
+
+// load returns the payload of the provider: inline, from its url, or
+// from its path, relative to the config.
+func (p clashProvider) load(configPath string) ([]string, error) {
+	if strings.EqualFold(p.Type, "inline") {
+		return p.Payload, nil
+	}
+	if strings.EqualFold(p.Format, "mrs") {
+		return nil, fmt.Errorf("binary mrs format not supported, use yaml or text")
+	}
+	src := p.URL
+	if src == "" {
+		if p.Path == "" {
+			return nil, fmt.Errorf("no url or path")
+		}
+		src = relativeTo(configPath, p.Path)
+	}
+	b, err := fetch.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(p.Format, "text") {
+		var doc struct {
+			Payload []string `yaml:"payload"`
+		}
+		if err := yaml.Unmarshal(b, &doc); err == nil && len(doc.Payload) > 0 {
+			return doc.Payload, nil
+		}
+	}
+	return ruleLines(b)
+}
+
+// ruleLines returns the non-empty lines of a text rule list, without
+// comments.
+func ruleLines(b []byte) ([]string, error) {
+	var out []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		s := strings.TrimSpace(sc.Text())
+		if s != "" && !strings.HasPrefix(s, "#") && !strings.HasPrefix(s, "//") && !strings.HasPrefix(s, ";") {
+			out = append(out, s)
+		}
+	}
+	return out, sc.Err()
+}
+
+// relativeTo resolves a path of a list referenced by a local config
+// against the config's directory.
+func relativeTo(configPath, src string) string {
+	if strings.Contains(src, "://") || filepath.IsAbs(src) || strings.Contains(configPath, "://") {
+		return src
+	}
+	return filepath.Join(filepath.Dir(configPath), src)
+}
+
+// policyOutbound maps a Clash or Surge policy to an outbound tag: DIRECT
+// is direct, REJECT and its variants block, and any proxy or group the
+// proxy outbound of the app.
+func policyOutbound(policy string) string {
+	p := strings.ToUpper(strings.TrimSpace(policy))
+	switch {
+	case p == "DIRECT":
+		return "direct"
+	case strings.HasPrefix(p, "REJECT"):
+		return "block"
+	}
+	return "proxy"
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+)
+
+// singBoxHeadless is a rule of a sing-box rule-set, and the condition
+// part of a route rule. Only destination and process fields convert.
+type singBoxHeadless struct {
+	Type          string            `json:"type"` // "" or default; logical rules are skipped
+	Domain        []string          `json:"domain"`
+	DomainSuffix  []string          `json:"domain_suffix"`
+	DomainKeyword []string          `json:"domain_keyword"`
+	DomainRegex   []string          `json:"domain_regex"`
+	Geosite       []string          `json:"geosite"` // before 1.12
+	GeoIP         []string          `json:"geoip"`
+	IPCIDR        []string          `json:"ip_cidr"`
+	ProcessName   []string          `json:"process_name"`
+	ProcessPath   []string          `json:"process_path"`
+	PackageName   []string          `json:"package_name"`
+	RuleSet       []string          `json:"rule_set"`
+	Invert        bool              `json:"invert"`
+	Other         map[string]any    `json:"-"` // conditions that do not convert
+	Rules         []json.RawMessage `json:"rules"`
+}
+
+// singBoxKnown are the fields parseSingBoxRule understands.
+var singBoxKnown = []string{
+	"type", "domain", "domain_suffix", "domain_keyword", "domain_regex",
+	"geosite", "geoip", "ip_cidr", "process_name", "process_path",
+	"package_name", "rule_set", "invert", "outbound", "action", "rules", "mode",
+}
+
+type singBoxRuleSet struct {
+	Tag    string            `json:"tag"`
+	Type   string            `json:"type"`   // local, remote or inline
+	Format string            `json:"format"` // source or binary
+	Path   string            `json:"path"`
+	URL    string            `json:"url"`
+	Rules  []json.RawMessage `json:"rules"`
+}
+
+// parseSingBox imports route.rules of a sing-box config, expanding rule
+// sets, or a rule-set source file on its own, routed direct like a plain
+// list.
+func parseSingBox(path string, b []byte) ([]ruleGroup, error) {
+	var cfg struct {
+		Route struct {
+			Rules   []json.RawMessage `json:"rules"`
+			RuleSet []singBoxRuleSet  `json:"rule_set"`
+		} `json:"route"`
+		Version int               `json:"version"`
+		Rules   []json.RawMessage `json:"rules"`
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	gb := newGroupBuilder(path)
+	if cfg.Route.Rules == nil {
+		for _, raw := range cfg.Rules {
+			if err := addSingBoxRule(gb, path, "direct", raw, nil); err != nil {
+				return nil, err
+			}
+		}
+		return gb.result()
+	}
+
+	sets := make(map[string]singBoxRuleSet)
+	for _, s := range cfg.Route.RuleSet {
+		sets[s.Tag] = s
+	}
+	for _, raw := range cfg.Route.Rules {
+		var head struct {
+			Outbound string `json:"outbound"`
+			Action   string `json:"action"`
+		}
+		if err := json.Unmarshal(raw, &head); err != nil {
+			return nil, err
+		}
+		var outbound string
+		switch head.Action {
+		case "", "route":
+			outbound = head.Outbound
+		case "reject":
+			outbound = "block"
+		default:
+			gb.skip(fmt.Sprintf("rule with action %s", head.Action))
+			continue
+		}
+		if err := addSingBoxRule(gb, path, outbound, raw, sets); err != nil {
+			return nil, err
+		}
+	}
+	return gb.result()
+}
+
+// addSingBoxRule converts one rule. sing-box ORs the destination fields
+// of a rule and ANDs them with the process ones, so a rule with both, or
+// with any other condition, cannot be expressed and is skipped.
+func addSingBoxRule(gb *groupBuilder, path, outbound string, raw json.RawMessage, sets map[string]singBoxRuleSet) error {
+	var r singBoxHeadless
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	var fields map[string]any
+	_ = json.Unmarshal(raw, &fields)
+	for k := range fields {
+		if !slices.Contains(singBoxKnown, k) {
+			gb.skip(fmt.Sprintf("rule with %s", k))
+			return nil
+		}
+	}
+	if r.Type == "logical" || r.Invert {
+		gb.skip("logical or inverted rule")
+		return nil
+	}
+	r.addTo(gb, outbound)
+
+	for _, tag := range r.RuleSet {
+		s, ok := sets[tag]
+		if !ok {
+			return fmt.Errorf("rule_set %s is not defined", tag)
+		}
+		rules, err := s.load(path)
+		if err != nil {
+			return fmt.Errorf("rule_set %s: %w", tag, err)
+		}
+		for _, h := range rules {
+			if h.Type == "logical" || h.Invert || len(h.Other) > 0 {
+				gb.skip(fmt.Sprintf("rule of rule_set %s with other conditions", tag))
+				continue
+			}
+			h.addTo(gb, outbound)
+		}
+	}
+	return nil
+}
+
+func (r singBoxHeadless) addTo(gb *groupBuilder, outbound string) {
+	dest := len(r.Domain) + len(r.DomainSuffix) + len(r.DomainKeyword) + len(r.DomainRegex) +
+		len(r.Geosite) + len(r.GeoIP) + len(r.IPCIDR) + len(r.RuleSet)
+	if dest > 0 && len(r.ProcessName)+len(r.ProcessPath)+len(r.PackageName) > 0 {
+		gb.skip("rule matching both destination and process")
+		return
+	}
+	for _, d := range r.Domain {
+		gb.add(outbound, "full:"+d)
+	}
+	for _, d := range r.DomainSuffix {
+		// ".x" is only the subdomains; domain: also takes x itself.
+		gb.add(outbound, "domain:"+strings.TrimPrefix(d, "."))
+	}
+	for _, d := range r.DomainKeyword {
+		gb.add(outbound, "keyword:"+d)
+	}
+	for _, d := range r.DomainRegex {
+		gb.add(outbound, "regexp:"+d)
+	}
+	for _, d := range r.Geosite {
+		gb.add(outbound, "geosite:"+d)
+	}
+	for _, d := range r.GeoIP {
+		gb.add(outbound, "geoip:"+d)
+	}
+	for _, d := range r.IPCIDR {
+		gb.add(outbound, d)
+	}
+	for _, p := range slices.Concat(r.ProcessName, r.ProcessPath) {
+		gb.add(outbound, "process:"+p)
+	}
+	for _, p := range r.PackageName {
+		gb.add(outbound, "app:"+p)
+	}
+}
+
+// load returns the rules of the set: inline, or a source or binary file
+// from its url or path, relative to the config.
+func (s singBoxRuleSet) load(configPath string) ([]singBoxHeadless, error) {
+	raws := s.Rules
+	if s.Type != "inline" {
+		src := s.URL
+		if s.Type == "local" || src == "" {
+			src = relativeTo(configPath, s.Path)
+		}
+		b, err := fetch.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		if s.Format == "binary" || isSRS(b) {
+			return decodeSRS(b)
+		}
+		var doc struct {
+			Rules []json.RawMessage `json:"rules"`
+		}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+		raws = doc.Rules
+	}
+
+	out := make([]singBoxHeadless, 0, len(raws))
+	for _, raw := range raws {
+		var h singBoxHeadless
+		if err := json.Unmarshal(raw, &h); err != nil {
+			return nil, err
+		}
+		var fields map[string]any
+		_ = json.Unmarshal(raw, &fields)
+		for k, v := range fields {
+			if !slices.Contains(singBoxKnown, k) {
+				if h.Other == nil {
+					h.Other = make(map[string]any)
+				}
+				h.Other[k] = v
+			}
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+// parseSRS imports a binary rule-set on its own, routed direct.
+func parseSRS(path string, b []byte) ([]ruleGroup, error) {
+	rules, err := decodeSRS(b)
+	if err != nil {
+		return nil, err
+	}
+	gb := newGroupBuilder(path)
+	for _, h := range rules {
+		if h.Type == "logical" || h.Invert || len(h.Other) > 0 {
+			gb.skip("rule with other conditions")
+			continue
+		}
+		h.addTo(gb, "direct")
+	}
+	return gb.result()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+)
+
+// isSurgeConfig reports whether b has the [Rule] section of a Surge or
+// Shadowrocket config.
+func isSurgeConfig(b []byte) bool {
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		if strings.EqualFold(strings.TrimSpace(sc.Text()), "[Rule]") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSurge imports the [Rule] section of a Surge or Shadowrocket
+// config, expanding RULE-SET and DOMAIN-SET lists. The rule types are
+// Clash's, so lines convert with addClashRule and policyOutbound.
+func parseSurge(path string, b []byte) ([]ruleGroup, error) {
+	var rules []string
+	in := false
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		s := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			in = strings.EqualFold(s, "[Rule]")
+			continue
+		}
+		if in && s != "" && !strings.HasPrefix(s, "#") && !strings.HasPrefix(s, "//") && !strings.HasPrefix(s, ";") {
+			rules = append(rules, s)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no [Rule] section")
+	}
+
+	gb := newGroupBuilder(path)
+	for _, line := range rules {
+		f := splitRule(line)
+		kind := strings.ToUpper(f[0])
+		switch {
+		case kind == "FINAL":
+			gb.skip(fmt.Sprintf("final rule %q", line))
+			continue
+		case kind == "AND" || kind == "OR" || kind == "NOT":
+			gb.skip(fmt.Sprintf("logical rule %q", line))
+			continue
+		case len(f) < 3:
+			gb.skip(fmt.Sprintf("rule %q", line))
+			continue
+		}
+		outbound := policyOutbound(f[2])
+		switch kind {
+		case "RULE-SET", "DOMAIN-SET":
+			if strings.EqualFold(f[1], "SYSTEM") || strings.EqualFold(f[1], "LAN") {
+				gb.skip(fmt.Sprintf("built-in rule set %q", line))
+				continue
+			}
+			b, err := fetch.ReadFile(relativeTo(path, f[1]))
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", line, err)
+			}
+			list, err := ruleLines(b)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", line, err)
+			}
+			for _, e := range list {
+				if kind == "DOMAIN-SET" {
+					addClashDomain(gb, outbound, e)
+				} else if rf := splitRule(e); len(rf) >= 2 {
+					addClashRule(gb, outbound, strings.ToUpper(rf[0]), rf[1], e)
+				}
+			}
+		default:
+			addClashRule(gb, outbound, kind, f[1], line)
+		}
+	}
+	return gb.result()
+}
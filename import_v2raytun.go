@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// isRouteLinks reports whether b holds import links rather than a domain
+// list, e.g. a saved link or the .link files of -archive.
+func isRouteLinks(b []byte) bool {
+	s := strings.TrimSpace(string(b))
+	return strings.HasPrefix(s, linkPrefix) || strings.Contains(strings.SplitN(s, "\n", 2)[0], "://import_route/")
+}
+
+// parseRouteLinks imports every link of b, one per line.
+func parseRouteLinks(path string, b []byte) ([]ruleGroup, error) {
+	gb := newGroupBuilder(path)
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		route, err := decodeLink(line)
+		if err != nil {
+			return nil, err
+		}
+		addRoute(gb, route)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return gb.result()
+}
+
+// parseV2rayTunBackup imports the routes of a v2rayTun export: a route
+// object, a list of them, or a backup with routes anywhere inside. Routes
+// are recognized by their shape, objects with rules that have an
+// outboundTag, since the backup layout is not documented.
+func parseV2rayTunBackup(path string, b []byte) ([]ruleGroup, error) {
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	gb := newGroupBuilder(path)
+	n := 0
+	var walk func(v any) error
+	walk = func(v any) error {
+		switch v := v.(type) {
+		case map[string]any:
+			if looksLikeRoute(v) {
+				raw, _ := json.Marshal(v)
+				var route Route
+				if err := json.Unmarshal(raw, &route); err != nil {
+					return err
+				}
+				addRoute(gb, route)
+				n++
+				return nil
+			}
+			for _, c := range v {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for _, c := range v {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+		case string:
+			// Some exports keep routes as import links or JSON strings.
+			if strings.Contains(v, "import_route/") {
+				if route, err := decodeLink(v); err == nil {
+					addRoute(gb, route)
+					n++
+				}
+			} else if strings.HasPrefix(strings.TrimSpace(v), "{") {
+				var inner any
+				if json.Unmarshal([]byte(v), &inner) == nil {
+					return walk(inner)
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(doc); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no routes found")
+	}
+	return gb.result()
+}
+
+func looksLikeRoute(v map[string]any) bool {
+	rules, ok := v["rules"].([]any)
+	if !ok || len(rules) == 0 {
+		return false
+	}
+	r, ok := rules[0].(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = r["outboundTag"]
+	return ok
+}
+
+// addRoute files the entries of every rule under its outbound. The ads
+// rule every generated route starts with is left out, buildRoute adds
+// it again.
+func addRoute(gb *groupBuilder, route Route) {
+	for _, r := range route.Rules {
+		if r.OutboundTag == "block" && len(r.Domain) == 1 && r.Domain[0] == "geosite:category-ads-all" && len(r.IP) == 0 {
+			continue
+		}
+		if r.OutboundTag == "" {
+			gb.skip(fmt.Sprintf("rule %s without outboundTag", ruleLabel(r)))
+			continue
+		}
+		for _, e := range r.Domain {
+			gb.add(r.OutboundTag, e)
+		}
+		for _, e := range r.IP {
+			gb.add(r.OutboundTag, e)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// xrayImportRule is a routing rule of an Xray or v2ray config.
+type xrayImportRule struct {
+	Domain      []string `json:"domain"`
+	IP          []string `json:"ip"`
+	Process     []string `json:"process"`
+	OutboundTag string   `json:"outboundTag"`
+	BalancerTag string   `json:"balancerTag"`
+	RuleTag     string   `json:"ruleTag"`
+}
+
+// xrayKnown are the rule fields parseXray converts; any other field is a
+// condition this tool cannot express.
+var xrayKnown = []string{"type", "domain", "ip", "process", "outboundTag", "balancerTag", "ruleTag", "domainMatcher"}
+
+// parseXray imports the routing rules of an Xray config, or of just its
+// routing object. Entries keep the v2ray syntax, which is this tool's
+// own; plain entries without a dot, substring matches in v2ray, become
+// keyword: since they are not hosts. Fields of a rule are ANDed, so only
+// rules with a single kind of condition convert.
+func parseXray(path string, b []byte) ([]ruleGroup, error) {
+	var cfg struct {
+		Routing *struct {
+			Rules []json.RawMessage `json:"rules"`
+		} `json:"routing"`
+		Rules []json.RawMessage `json:"rules"`
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	raws := cfg.Rules
+	if cfg.Routing != nil {
+		raws = cfg.Routing.Rules
+	}
+
+	gb := newGroupBuilder(path)
+	for i, raw := range raws {
+		var r xrayImportRule
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		label := r.RuleTag
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+
+		var fields map[string]any
+		_ = json.Unmarshal(raw, &fields)
+		var other []string
+		for k := range fields {
+			if !slices.Contains(xrayKnown, k) {
+				other = append(other, k)
+			}
+		}
+		if len(other) > 0 {
+			slices.Sort(other)
+			gb.skip(fmt.Sprintf("rule %s with %s", label, strings.Join(other, ", ")))
+			continue
+		}
+		kinds := 0
+		for _, l := range [][]string{r.Domain, r.IP, r.Process} {
+			if len(l) > 0 {
+				kinds++
+			}
+		}
+		if kinds > 1 {
+			gb.skip(fmt.Sprintf("rule %s matching several of domain, ip and process at once", label))
+			continue
+		}
+
+		outbound := r.OutboundTag
+		if outbound == "block" && slices.Equal(r.Domain, []string{"geosite:category-ads-all"}) {
+			continue // buildRoute adds the ads rule itself
+		}
+		if outbound == "" {
+			if outbound = r.BalancerTag; outbound == "" {
+				gb.skip(fmt.Sprintf("rule %s without outboundTag", label))
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "warning: %s: rule %s: balancer %s imported as an outbound\n", path, label, outbound)
+		}
+		for _, d := range r.Domain {
+			if !strings.Contains(d, ":") && !strings.Contains(d, ".") {
+				d = "keyword:" + d
+			}
+			gb.add(outbound, d)
+		}
+		for _, ip := range r.IP {
+			gb.add(outbound, ip)
+		}
+		for _, p := range r.Process {
+			gb.add(outbound, "process:"+p)
+		}
+	}
+	return gb.result()
+}
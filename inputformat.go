@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// inputFormats are the values of -input-format. Clash, Surge, sing-box
+// rule-sets and route links are told apart by extension and content only.
+var inputFormats = []string{"auto", "plain", "hosts", "adguard", "dnsmasq", "csv", "json"}
+
+// inputFormat forces the format of every input, auto sniffs it per file.
+var inputFormat = "auto"
+
+func parseInputFormat(s string) error {
+	if !slices.Contains(inputFormats, s) {
+		return fmt.Errorf("unknown input format %q (want %s)", s, strings.Join(inputFormats, ", "))
+	}
+	inputFormat = s
+	return nil
+}
+
+// detectFormat names the format of an input: the one forced with
+// -input-format, else by extension, else by content.
+func detectFormat(path string, b []byte) string {
+	if inputFormat != "auto" {
+		return inputFormat
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv", ".tsv":
+		return "csv"
+	case ".json":
+		return "json"
+	case ".srs":
+		return "srs"
+	case ".yaml", ".yml":
+		return "clash"
+	case ".conf":
+		return "surge"
+	}
+	switch {
+	case isRouteLinks(b):
+		return "links"
+	case isSurgeConfig(b):
+		return "surge"
+	case bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")):
+		return "json"
+	}
+	return sniffLines(b)
+}
+
+// sniffLines classifies the first data lines of a list and picks the
+// format most of them have, plain if none has a majority.
+func sniffLines(b []byte) string {
+	counts := make(map[string]int)
+	total := 0
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() && total < 200 {
+		s := strings.TrimSpace(sc.Text())
+		if _, include := includeTarget(s); s == "" || strings.HasPrefix(s, "#") || include {
+			continue
+		}
+		if strings.HasPrefix(s, "[Adblock") || strings.HasPrefix(s, "[AdGuard") {
+			return "adguard"
+		}
+		total++
+		switch {
+		case isHostsLine(s):
+			counts["hosts"]++
+		case isDnsmasqLine(s):
+			counts["dnsmasq"]++
+		case strings.HasPrefix(s, "||") || strings.HasPrefix(s, "@@") || strings.HasPrefix(s, "!") ||
+			strings.HasSuffix(s, "^") || strings.Contains(s, "^$") || strings.Contains(s, "##"):
+			counts["adguard"]++
+		case strings.ContainsAny(s, ",\t"):
+			counts["csv"]++
+		}
+	}
+	best := "plain"
+	for _, f := range []string{"hosts", "dnsmasq", "adguard", "csv"} {
+		if counts[f]*2 > total && counts[f] > counts[best] {
+			best = f
+		}
+	}
+	return best
+}
+
+func isHostsLine(s string) bool {
+	f := strings.Fields(s)
+	return len(f) >= 2 && net.ParseIP(f[0]) != nil
+}
+
+var dnsmasqKeys = []string{"server", "address", "local", "ipset", "nftset"}
+
+func isDnsmasqLine(s string) bool {
+	k, v, ok := strings.Cut(s, "=")
+	return ok && strings.HasPrefix(v, "/") && slices.Contains(dnsmasqKeys, k)
+}
+
+// toPlain rewrites a hosts, AdGuard or dnsmasq list into plain lines,
+// keeping comments, blank lines and includes, so parseDomains sees the notes
+// and blocks of the original. Other formats are returned as is.
+func toPlain(path, format string, b []byte) []byte {
+	var conv func(string) ([]string, bool)
+	switch format {
+	case "hosts":
+		conv = hostsEntries
+	case "adguard":
+		conv = adguardEntries
+	case "dnsmasq":
+		conv = dnsmasqEntries
+	default:
+		return b
+	}
+
+	var out bytes.Buffer
+	skipped := 0
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		s := strings.TrimSpace(sc.Text())
+		if _, ok := includeTarget(s); ok {
+			out.WriteString(s + "\n")
+			continue
+		}
+		if c, ok := strings.CutPrefix(s, "!"); ok && format == "adguard" {
+			s = "#" + c
+		}
+		if s == "" || strings.HasPrefix(s, "#") {
+			out.WriteString(s + "\n")
+			continue
+		}
+		entries, ok := conv(s)
+		if !ok {
+			skipped++
+			continue
+		}
+		for _, e := range entries {
+			out.WriteString(e + "\n")
+		}
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s: skipped %d %s lines that are not domain rules\n", path, skipped, format)
+	}
+	return out.Bytes()
+}
+
+// cutNote splits an inline "# comment" off a line, returning it in the
+// form parseDomains reads.
+func cutNote(s string) (string, string) {
+	body, note, ok := strings.Cut(s, "#")
+	if !ok || strings.TrimSpace(note) == "" {
+		return strings.TrimSpace(body), ""
+	}
+	return strings.TrimSpace(body), " # " + strings.TrimSpace(note)
+}
+
+// hostsEntries converts "0.0.0.0 ads.example.com tracker.example.com";
+// the names of the machine itself are dropped.
+func hostsEntries(s string) ([]string, bool) {
+	body, note := cutNote(s)
+	f := strings.Fields(body)
+	if len(f) < 2 || net.ParseIP(f[0]) == nil {
+		return nil, false
+	}
+	var out []string
+	for _, h := range f[1:] {
+		switch l := strings.ToLower(h); {
+		case l == "localhost", l == "localhost.localdomain", l == "local", l == "broadcasthost",
+			strings.HasPrefix(l, "ip6-"), net.ParseIP(l) != nil:
+			continue
+		}
+		out = append(out, h+note)
+	}
+	return out, true
+}
+
+// adguardEntries converts the domain rules of AdGuard and Adblock Plus
+// syntax: "||example.com^" and bare names are the domain with its
+// subdomains, "/re/" a regexp. Exceptions, cosmetic and URL rules, and
+// modifiers other than $important have no equivalent.
+func adguardEntries(s string) ([]string, bool) {
+	if strings.HasPrefix(s, "[") {
+		return nil, true // [Adblock Plus 2.0] header
+	}
+	if isHostsLine(s) {
+		return hostsEntries(s)
+	}
+	if strings.HasPrefix(s, "@@") || strings.Contains(s, "##") || strings.Contains(s, "#@#") ||
+		strings.Contains(s, "#$#") || strings.Contains(s, "#?#") {
+		return nil, false
+	}
+	if re, ok := strings.CutPrefix(s, "/"); ok && strings.HasSuffix(re, "/") && len(re) > 1 {
+		return []string{"regexp:" + strings.TrimSuffix(re, "/")}, true
+	}
+	rule, mods, _ := strings.Cut(s, "$")
+	for _, m := range strings.Split(mods, ",") {
+		if m != "" && m != "important" && m != "all" {
+			return nil, false
+		}
+	}
+	h := strings.TrimPrefix(rule, "||")
+	h = strings.TrimSuffix(strings.TrimSuffix(h, "|"), "^")
+	if h == "" || strings.ContainsAny(h, "|/*^:") {
+		return nil, false
+	}
+	return []string{h}, true
+}
+
+// dnsmasqEntries converts server=, address=, local=, ipset= and nftset=
+// lines, which match the listed domains with their subdomains; other
+// options are not rules and are ignored.
+func dnsmasqEntries(s string) ([]string, bool) {
+	body, note := cutNote(s)
+	if !isDnsmasqLine(body) {
+		return nil, true
+	}
+	_, v, _ := strings.Cut(body, "=")
+	parts := strings.Split(v, "/")
+	var out []string
+	for _, d := range parts[1 : len(parts)-1] {
+		if d != "" && d != "#" {
+			out = append(out, d+note)
+		}
+	}
+	return out, true
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		path, in, want string
+	}{
+		{"list.csv", "anything", "csv"},
+		{"rules.TSV", "", "csv"},
+		{"set.json", "", "json"},
+		{"set.srs", "", "srs"},
+		{"clash.yml", "", "clash"},
+		{"surge.conf", "", "surge"},
+		{"links.txt", "v2rayTun://import_route/eyJ9\n", "links"},
+		{"other.txt", "foo://import_route/eyJ9\n", "links"},
+		{"surge.txt", "[General]\n[Rule]\nDOMAIN,a.com,DIRECT\n", "surge"},
+		{"set.txt", " {\"rules\": []}", "json"},
+		{"hosts", "# blocked\n0.0.0.0 ads.com\n127.0.0.1 t.com x.com\n", "hosts"},
+		{"dnsmasq.txt", "server=/a.com/1.1.1.1\nipset=/b.com/set\n", "dnsmasq"},
+		{"ag.txt", "[Adblock Plus 2.0]\nexample.com\n", "adguard"},
+		{"ag.txt", "||a.com^\n||b.com^$important\nc.com\n", "adguard"},
+		{"map.txt", "a.com,proxy\nb.com,direct\n", "csv"},
+		{"list.txt", "a.com\nb.com\n0.0.0.0 c.com\n", "plain"},
+		{"list.txt", "include:other.txt\n!include other.txt\na.com\n", "plain"},
+	}
+	for _, tt := range tests {
+		if got := detectFormat(tt.path, []byte(tt.in)); got != tt.want {
+			t.Errorf("detectFormat(%q, %q) = %q, want %q", tt.path, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestToPlain(t *testing.T) {
+	tests := []struct {
+		format, in, want string
+	}{
+		{"hosts", "# ads\n0.0.0.0 ads.com tracker.com # bad\n127.0.0.1 localhost\n", "# ads\nads.com # bad\ntracker.com # bad\n"},
+		{"adguard", "! title\n||a.com^\n@@||b.com^\n/ads[0-9]+/\nc.com$third-party\nd.com$important\n", "# title\na.com\nregexp:ads[0-9]+\nd.com\n"},
+		{"dnsmasq", "server=/a.com/b.com/1.1.1.1\naddress=/#/0.0.0.0\ncache-size=100\n", "a.com\nb.com\n"},
+		{"plain", "a.com\n", "a.com\n"},
+	}
+	for _, tt := range tests {
+		if got := string(toPlain("t", tt.format, []byte(tt.in))); got != tt.want {
+			t.Errorf("toPlain(%s, %q) = %q, want %q", tt.format, tt.in, got, tt.want)
+		}
+	}
+}
@@ -2,118 +2,838 @@ package main
 
 import (
 	"bufio"
-	"encoding/base64"
-	"encoding/json"
+	"bytes"
+	"flag"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/devemio/v2raytun-routing/domain"
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
 	"github.com/google/uuid"
+	"golang.org/x/net/idna"
 )
 
-type Route struct {
-	Name           string `json:"name"`
-	DomainStrategy string `json:"domainStrategy"`
-	ID             string `json:"id"`
-	DomainMatcher  string `json:"domainMatcher"`
-	Rules          []Rule `json:"rules"`
-	Balancers      []any  `json:"balancers"`
-}
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			simulate(os.Args[2:])
+			return
+		case "history":
+			historyCmd(os.Args[2:])
+			return
+		case "rollback":
+			rollback(os.Args[2:])
+			return
+		case "daemon":
+			daemon(os.Args[2:])
+			return
+		case "build":
+			build(os.Args[2:])
+			return
+		case "shadow":
+			shadowCmd(os.Args[2:])
+			return
+		case "route":
+			routeCmd(os.Args[2:])
+			return
+		}
+	}
 
-type Rule struct {
-	ID          string   `json:"id"`
-	Type        string   `json:"type"`
-	Domain      []string `json:"domain"`
-	OutboundTag string   `json:"outboundTag"`
-	Name        string   `json:"__name__"`
-}
+	diffAgainst := flag.String("diff-against", "", "Previously generated link, file with it, or \"last\" from history: print semantic changes instead of the link, exit 2 if any")
+	noHistory := flag.Bool("no-history", false, "Do not record the generated link in the history file")
+	withMeta := flag.Bool("meta", false, "Embed build metadata (generator version, source hashes, timestamp) into the route")
+	nameHash := flag.Bool("name-hash", false, "Append a short hash of the rules to the route name, e.g. \"Default #a1b2c3\"")
+	geositeRelease := flag.String("geosite-release", "", "Geosite release to record in build metadata, e.g. 202501010000")
+	jobs := flag.Int("jobs", 4, "Number of sources fetched concurrently")
+	staleAfter := flag.Duration("stale-after", 0, "Warn about URL sources served from a cached copy older than this, e.g. 48h")
+	addLinkFlags(flag.CommandLine)
+	addInputFlags(flag.CommandLine)
+	outPath := flag.String("o", "", "Write output to this file (atomically) instead of stdout")
+	shadowed := flag.String("shadowed", "", "Check for entries shadowed by earlier rules: report or prune")
+	geositePath := flag.String("geosite", "", "Path or URL to geosite.dat used by -shadowed and -winners to evaluate geosite: selectors")
+	outbounds := flag.String("outbounds", "", "Client outbound tags (comma-separated) or its JSON config: warn about rules with an undefined outbound")
+	commentNames := flag.Bool("comment-names", false, "Split rules by the comments of their entries (inline, block header or CSV note) and name them after it")
+	countries := flag.String("countries", "", "Build one route per country code (comma-separated), filling {cc} in the sources, e.g. geosite:category-{cc}; prints \"cc<TAB>link\" lines")
+	var subnets subnetFlag
+	flag.Var(&subnets, "subnet", "Route a LAN subnet with other outbounds, e.g. \"kids 192.168.20.0/24 proxy=block\" (repeatable)")
+	sortMode := flag.String("sort", "source", "Order of entries in each rule: source, alpha, or reverse (by reversed labels, grouping a domain with its subdomains)")
+	var export exportOptions
+	addExportFlags(flag.CommandLine, &export)
+	winners := flag.Bool("winners", false, "Print to stderr which rule and outbound every input domain hits in the generated route")
+	fetch.AddFlags(flag.CommandLine)
+	addDecodeFlags(flag.CommandLine)
+	profile.AddFlags(flag.CommandLine)
+	flag.Parse()
+	startProfile()
+	defer profile.Stop()
 
-func main() {
-	if len(os.Args) != 2 {
-		fail("usage: go run . domains.txt")
+	if flag.NArg() == 0 {
+		fail("usage: go run . [flags] domains.txt [more.txt https://...]")
+	}
+
+	sources, err := fetchSources(flag.Args(), *jobs)
+	if err != nil {
+		fail(err.Error())
+	}
+	staleSources(sources, *staleAfter, time.Now())
+	var known map[string]bool
+	if *outbounds != "" {
+		if known, err = knownOutbounds(*outbounds); err != nil {
+			fail(err.Error())
+		}
+	}
+	var m *geosite.Matcher
+	if *geositePath != "" {
+		if m, err = loadMatcher(*geositePath); err != nil {
+			fail(err.Error())
+		}
+	}
+	// checked builds the route of groups and runs the checks the flags
+	// ask for, on every -countries route as well.
+	checked := func(groups []ruleGroup) Route {
+		route := withSubnets(checkShadowed(buildRoute(groups), *shadowed, m), subnets)
+		if known != nil {
+			checkOutbounds(os.Stderr, route, known)
+		}
+		if *winners {
+			newSimulatorWith(route, m).printWinners(os.Stderr, groupHosts(groups))
+		}
+		return route
 	}
 
-	domains, err := readDomains(os.Args[1])
+	if *countries != "" {
+		if export.Format != "link" || *diffAgainst != "" {
+			fail("-countries only prints links, without -format and -diff-against")
+		}
+		ccs, err := parseCountries(*countries)
+		if err != nil {
+			fail(err.Error())
+		}
+		if err := checkSortMode(*sortMode); err != nil {
+			fail(err.Error())
+		}
+		out := openOutput(*outPath)
+		for _, cc := range ccs {
+			srcs := forCountry(sources, cc)
+			groups, _, err := mergeSources(srcs)
+			if err != nil {
+				fail(err.Error())
+			}
+			sortGroups(groups, *sortMode)
+			if *commentNames {
+				groups = splitByNotes(groups)
+			}
+			if *shadowed != "" || *winners {
+				fmt.Fprintf(os.Stderr, "== %s ==\n", cc)
+			}
+			route := checked(groups)
+			route.Name = countryName("", cc)
+			if *nameHash {
+				route = withContentHash(route)
+			}
+			if *withMeta {
+				route.Meta = newBuildMeta(*geositeRelease, sourceHashes(srcs))
+			}
+			link, err := encodeLink(route)
+			if err != nil {
+				fail(err.Error())
+			}
+			if !*noHistory {
+				if err := recordHistory(link, "country "+cc, sourceHashes(srcs)); err != nil {
+					fmt.Fprintln(os.Stderr, "warning: history:", err)
+				}
+			}
+			fmt.Fprintf(out, "%s\t%s\n", cc, link)
+		}
+		out.commit()
+		return
+	}
+	groups, stats, err := mergeSources(sources)
 	if err != nil {
 		fail(err.Error())
-	} else if len(domains) == 0 {
+	} else if len(groups) == 0 {
 		fail("domain list is empty")
 	}
+	if len(stats) > 1 {
+		printSourceStats(os.Stderr, stats)
+	}
+	if err := checkSortMode(*sortMode); err != nil {
+		fail(err.Error())
+	}
+	sortGroups(groups, *sortMode)
+	if *commentNames {
+		groups = splitByNotes(groups)
+	}
 
-	route := Route{
-		Name:           "Default",
-		DomainStrategy: "AsIs",
-		ID:             uuid.NewString(),
-		DomainMatcher:  "hybrid",
-		Rules: []Rule{
-			{
-				ID:   uuid.NewString(),
-				Type: "field",
-				Domain: []string{
-					"geosite:category-ads-all",
-				},
-				OutboundTag: "block",
-				Name:        "Ads",
+	route := checked(groups)
+	if export.Format != "link" {
+		out := openOutput(*outPath)
+		if err := exportRoute(out, route, export, m, groupSections(groups)); err != nil {
+			fail(err.Error())
+		}
+		out.commit()
+		return
+	}
+	if *nameHash {
+		route = withContentHash(route)
+	}
+	if *withMeta {
+		route.Meta = newBuildMeta(*geositeRelease, sourceHashes(sources))
+	}
+
+	if *diffAgainst != "" {
+		prev, err := loadPrevious(*diffAgainst)
+		if err != nil {
+			fail(err.Error())
+		}
+		changes := diffRoutes(prev, route)
+		if len(changes) == 0 {
+			fmt.Fprintln(os.Stderr, "no changes")
+			return
+		}
+		out := openOutput(*outPath)
+		for _, c := range changes {
+			fmt.Fprintln(out, c)
+		}
+		out.commit()
+		profile.Stop()
+		os.Exit(exitChanged)
+	}
+
+	link, err := encodeLink(route)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	if !*noHistory {
+		if err := recordHistory(link, "", sourceHashes(sources)); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: history:", err)
+		}
+	}
+
+	out := openOutput(*outPath)
+	fmt.Fprint(out, link)
+	out.commit()
+}
+
+func loadPrevious(s string) (Route, error) {
+	if s == "last" {
+		e, err := lastHistory()
+		if err != nil {
+			return Route{}, err
+		}
+		s = e.Link
+	}
+	return loadRoute(s)
+}
+
+// ruleGroup is a set of domains routed to a single outbound.
+type ruleGroup struct {
+	Name     string
+	Outbound string
+	Domains  []string
+	Attrs    map[string][]string // domain -> @attr annotations from the input
+	Sections map[string][]string // [section] name -> domains listed under it
+	Notes    map[string]string   // domain -> its comment, see -comment-names
+	Origins  map[string]string   // domain -> include chain, for entries of !include lists
+}
+
+func buildRoute(groups []ruleGroup) Route {
+	rules := []Rule{
+		{
+			ID:   uuid.NewString(),
+			Type: "field",
+			Domain: []string{
+				"geosite:category-ads-all",
 			},
-			{
+			OutboundTag: "block",
+			Name:        "Ads",
+		},
+	}
+	var bypass, proxied []string
+	for _, g := range groups {
+		var domains, ips, processes []string
+		for _, d := range g.Domains {
+			if p, ok := strings.CutPrefix(d, "process:"); ok {
+				processes = append(processes, p)
+				continue
+			}
+			if strings.HasPrefix(d, "geoip:") || isIP(d) {
+				ips = append(ips, d)
+				continue
+			}
+			pkg, ok := strings.CutPrefix(d, "app:")
+			switch {
+			case !ok:
+				domains = append(domains, d)
+			case g.Outbound == "direct":
+				bypass = append(bypass, pkg)
+			default:
+				proxied = append(proxied, pkg)
+			}
+		}
+		if len(domains)+len(processes) > 0 || len(g.Domains) == 0 {
+			rules = append(rules, Rule{
 				ID:          uuid.NewString(),
 				Type:        "field",
 				Domain:      domains,
-				OutboundTag: "direct",
-				Name:        "Direct",
-			},
-		},
-		Balancers: []any{},
+				Process:     processes,
+				OutboundTag: g.Outbound,
+				Name:        g.Name,
+			})
+		}
+		// v2ray ANDs the fields of a rule, so addresses get their own.
+		if len(ips) > 0 {
+			name := g.Name
+			if name != "" {
+				name += " IP"
+			}
+			rules = append(rules, Rule{
+				ID:          uuid.NewString(),
+				Type:        "field",
+				IP:          ips,
+				OutboundTag: g.Outbound,
+				Name:        name,
+			})
+		}
 	}
 
-	b, err := json.Marshal(route)
-	if err != nil {
-		fail(err.Error())
+	return Route{
+		Name:           "Default",
+		DomainStrategy: "AsIs",
+		ID:             uuid.NewString(),
+		DomainMatcher:  "hybrid",
+		Rules:          rules,
+		Balancers:      []any{},
+		Apps:           appList(bypass, proxied),
 	}
+}
 
-	fmt.Printf("v2rayTun://import_route/%s", base64.URLEncoding.EncodeToString(b))
+// appList turns app: entries into per-app tunneling. Apps routed direct
+// bypass the VPN; apps of other outbounds only define the list when no
+// app is direct, since in bypass mode every other app is tunneled anyway.
+func appList(bypass, proxied []string) *AppList {
+	switch {
+	case len(bypass) > 0:
+		if len(proxied) > 0 {
+			fmt.Fprintf(os.Stderr, "warning: %d apps with a non-direct outbound are tunneled anyway, the list is in bypass mode\n", len(proxied))
+		}
+		return &AppList{Mode: "bypass", Packages: bypass}
+	case len(proxied) > 0:
+		return &AppList{Mode: "proxy", Packages: proxied}
+	}
+	return nil
+}
+
+// splitByNotes gives every note of a group its own rule named
+// "<rule>: <note>", in order of first appearance, so the client shows what
+// each block is for. Entries without a note stay in a rule with the group
+// name.
+func splitByNotes(groups []ruleGroup) []ruleGroup {
+	var out []ruleGroup
+	for _, g := range groups {
+		index := make(map[string]int) // note -> out index
+		for _, d := range g.Domains {
+			n := g.Notes[d]
+			i, ok := index[n]
+			if !ok {
+				i = len(out)
+				index[n] = i
+				sub := g
+				sub.Domains = nil
+				if len(index) > 1 {
+					sub.Sections = nil // listed once
+				}
+				if n != "" {
+					sub.Name = g.Name + ": " + n
+				}
+				out = append(out, sub)
+			}
+			out[i].Domains = append(out[i].Domains, d)
+		}
+	}
+	return out
 }
 
+// groupSections merges the [section] hosts of all groups.
+func groupSections(groups []ruleGroup) map[string][]string {
+	out := make(map[string][]string)
+	for _, g := range groups {
+		for name, ds := range g.Sections {
+			for _, d := range ds {
+				if !slices.Contains(out[name], d) {
+					out[name] = append(out[name], d)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// parseGroups reads a plain domain list into a single Direct rule, or a
+// CSV/TSV mapping, route links or another client's config into one rule
+// per outbound. Hosts, AdGuard and dnsmasq lists are plain ones in
+// another syntax.
+func parseGroups(path string, b []byte) ([]ruleGroup, error) {
+	format := detectFormat(path, b)
+	switch format {
+	case "csv":
+		return parseMapping(path, b)
+	case "json":
+		return parseJSONSource(path, b)
+	case "srs":
+		return parseSRS(path, b)
+	case "clash":
+		return parseClash(path, b)
+	case "surge":
+		return parseSurge(path, b)
+	case "links":
+		return parseRouteLinks(path, b)
+	}
+
+	g, err := parseDomains(path, toPlain(path, format, b))
+	if err != nil || len(g.Domains) == 0 {
+		return nil, err
+	}
+	g.Outbound = fileOutbound(path)
+	g.Name = ruleName(g.Outbound)
+	return []ruleGroup{g}, nil
+}
+
+// fileOutbound is the outbound a plain list is named after,
+// "youtube@proxy.txt" for proxy, and direct for other names.
+func fileOutbound(path string) string {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if _, o, ok := strings.Cut(name, "@"); ok && o != "" {
+		return o
+	}
+	return "direct"
+}
+
+// readDomains reads the entries of a list, or of all lists a glob or
+// directory stands for.
 func readDomains(path string) ([]string, error) {
-	f, err := os.Open(path)
+	files, err := fetch.Expand(path)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	var out []string
+	for _, f := range files {
+		b, err := fetch.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		g, err := parseDomains(f, toPlain(f, detectFormat(f, b), b))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, g.Domains...)
+	}
+	return out, nil
+}
+
+// parseDomains returns the entries of a list, the @attr annotations some
+// of them carry and the [section] they are listed under. Sections only
+// tag entries, e.g. [no-fakedns] for hosts that must get real addresses;
+// the entries are routed as usual and "[]" ends the section. An entry's
+// note is its inline comment, or else the comment lines heading its block
+// of lines, up to the next blank line. "!include" lines splice other
+// lists in, see listParser.include; "$name = ..." lines define macros
+// that "@use $name" lines expand.
+func parseDomains(path string, b []byte) (ruleGroup, error) {
+	p := &listParser{
+		g: ruleGroup{
+			Domains:  make([]string, 0, 64),
+			Attrs:    make(map[string][]string),
+			Sections: make(map[string][]string),
+			Notes:    make(map[string]string),
+			Origins:  make(map[string]string),
+		},
+		seen:       make(map[string]struct{}),
+		lookalikes: make(domain.Homoglyphs),
+		inSection:  make(map[[2]string]bool),
+		macros:     make(map[string][]string),
+	}
+	top := path
+	if !fetch.IsRemote(path) && !fetch.IsGit(path) && path != "-" {
+		top = filepath.Clean(path)
+	}
+	err := p.parse([]string{top}, b)
+	return p.g, err
+}
 
-	seen := make(map[string]struct{})
-	out := make([]string, 0, 64)
+// listParser holds the state shared by a list and the lists it includes.
+type listParser struct {
+	g          ruleGroup
+	seen       map[string]struct{}
+	lookalikes domain.Homoglyphs
+	inSection  map[[2]string]bool
+	macros     map[string][]string // $name -> entries
+}
+
+// parse reads the list at the end of chain, the includes leading to it.
+// Sections and comment blocks do not cross file boundaries.
+func (p *listParser) parse(chain []string, b []byte) error {
+	section := ""
+	header, inHeader := "", false
 
-	sc := bufio.NewScanner(f)
+	sc := bufio.NewScanner(bytes.NewReader(b))
 	for sc.Scan() {
 		s := strings.TrimSpace(sc.Text())
-		if s == "" || strings.HasPrefix(s, "#") {
+		if s == "" {
+			header = ""
 			continue
 		}
+		if target, ok := includeTarget(s); ok {
+			if err := p.include(chain, target); err != nil {
+				return err
+			}
+			header, inHeader = "", false
+			continue
+		}
+		if c, ok := strings.CutPrefix(s, "#"); ok {
+			if c = strings.TrimSpace(c); !inHeader || header == "" {
+				header = c
+			} else if c != "" {
+				header += " " + c
+			}
+			inHeader = true
+			continue
+		}
+		inHeader = false
+		note := header
 		if i := strings.Index(s, "#"); i >= 0 {
+			if c := strings.TrimSpace(s[i+1:]); c != "" {
+				note = c
+			}
 			s = strings.TrimSpace(s[:i])
 		}
+		if name, ok := strings.CutPrefix(s, "["); ok && strings.HasSuffix(name, "]") {
+			section = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(name, "]")))
+			continue
+		}
 
-		s = strings.ToLower(s)
-		s = strings.TrimPrefix(s, "https://")
-		s = strings.TrimPrefix(s, "http://")
-		s = strings.TrimPrefix(s, "www.")
-		s = strings.TrimSuffix(s, ".")
+		if name, value, ok := macroDefinition(s); ok {
+			p.define(chain, name, value)
+			continue
+		}
+		if refs, ok := strings.CutPrefix(s, "@use "); ok {
+			for _, e := range p.use(chain, refs) {
+				p.add(chain, e, e, section, note)
+			}
+			continue
+		}
+		p.add(chain, s, sc.Text(), section, note)
+	}
+	return sc.Err()
+}
 
-		if s == "" {
+// add files one entry of the list, line being its source for warnings.
+func (p *listParser) add(chain []string, s, line, section, note string) {
+	s, a := splitAttrs(s)
+	s, err := normalizeEntry(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: skipping %q: %v\n", line, err)
+		return
+	}
+	g := &p.g
+	if len(a) > 0 {
+		g.Attrs[s] = append(g.Attrs[s], a...)
+	}
+	if k := [2]string{section, s}; section != "" && !p.inSection[k] {
+		p.inSection[k] = true
+		g.Sections[section] = append(g.Sections[section], s)
+	}
+	if _, ok := p.seen[s]; ok {
+		return
+	}
+	if note != "" {
+		g.Notes[s] = note
+	}
+	if len(chain) > 1 {
+		g.Origins[s] = strings.Join(chain, " > ")
+	}
+	if prev, ok := p.lookalikes.Check(s); ok {
+		fmt.Fprintf(os.Stderr, "warning: %q looks like %q but uses mixed scripts\n", displayHost(s), displayHost(prev))
+	}
+
+	p.seen[s] = struct{}{}
+	g.Domains = append(g.Domains, s)
+}
+
+// macroDefinition parses "$banks = sber.ru tinkoff.ru".
+func macroDefinition(s string) (string, string, bool) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !strings.HasPrefix(name, "$") || !isMacroName(name[1:]) {
+		return "", "", false
+	}
+	return name[1:], value, true
+}
+
+func isMacroName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// define stores a macro. Values are whitespace-separated entries and may
+// use earlier macros, which are expanded now, so definitions cannot loop.
+// Macros are shared with included lists: a file of definitions can be
+// included wherever the groups are used.
+func (p *listParser) define(chain []string, name, value string) {
+	if _, ok := p.macros[name]; ok {
+		fmt.Fprintf(os.Stderr, "warning: %s: $%s redefined\n", chain[len(chain)-1], name)
+	}
+	p.macros[name] = p.use(chain, value)
+}
+
+// use expands "$banks $shops vk.com" into entries; undefined macros are
+// skipped with a warning.
+func (p *listParser) use(chain []string, refs string) []string {
+	var out []string
+	for _, f := range strings.Fields(refs) {
+		name, ok := strings.CutPrefix(f, "$")
+		if !ok {
+			out = append(out, f)
 			continue
 		}
-		if _, ok := seen[s]; ok {
+		m, ok := p.macros[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "warning: %s: undefined $%s\n", chain[len(chain)-1], name)
 			continue
 		}
+		out = append(out, m...)
+	}
+	return out
+}
 
-		seen[s] = struct{}{}
-		out = append(out, s)
+// includeTarget returns the list named by an "!include path" line, or
+// AdGuard's "!#include".
+func includeTarget(s string) (string, bool) {
+	for _, d := range []string{"!include", "!#include"} {
+		if t, ok := strings.CutPrefix(s, d); ok && t != "" && (t[0] == ' ' || t[0] == '\t') {
+			return strings.TrimSpace(t), true
+		}
+	}
+	return "", false
+}
+
+// include splices in the lists a target stands for: a path relative to
+// the including list (or its URL), a URL, a glob or a directory. Only
+// line-based lists can be included; an include of a list already on the
+// chain is a cycle.
+func (p *listParser) include(chain []string, target string) error {
+	files, err := fetch.Expand(includePath(chain[len(chain)-1], target))
+	if err != nil {
+		return fmt.Errorf("include %s: %w", target, err)
+	}
+	for _, f := range files {
+		if slices.Contains(chain, f) {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(slices.Clone(chain), f), " > "))
+		}
+		b, err := fetch.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("include %s: %w", f, err)
+		}
+		format := detectFormat(f, b)
+		if !slices.Contains([]string{"plain", "hosts", "adguard", "dnsmasq"}, format) {
+			return fmt.Errorf("include %s: a %s file cannot be included, only domain lists", f, format)
+		}
+		if err := p.parse(append(slices.Clone(chain), f), toPlain(f, format, b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includePath resolves target against the list including it; in a git+
+// list it stays in the same repository and ref.
+func includePath(parent, target string) string {
+	if fetch.IsGit(parent) && !strings.Contains(target, "://") {
+		base, ref, pinned := strings.Cut(parent, "?ref=")
+		i := strings.LastIndex(base, "//")
+		out := base[:i+2] + path.Join(path.Dir(base[i+2:]), target)
+		if pinned {
+			out += "?ref=" + ref
+		}
+		return out
+	}
+	if fetch.IsRemote(parent) && !strings.Contains(target, "://") {
+		if u, err := url.Parse(parent); err == nil {
+			if r, err := u.Parse(target); err == nil {
+				return r.String()
+			}
+		}
+	}
+	if parent == "-" {
+		return target
+	}
+	return relativeTo(parent, target)
+}
+
+// splitAttrs cuts domain-list-community style annotations off an entry:
+// "example.cn @cn" or "example.cn@cn". An email address is not split,
+// attributes never contain a dot. Selectors keep their own @attr.
+func splitAttrs(s string) (string, []string) {
+	if l := strings.ToLower(s); strings.HasPrefix(l, "geosite:") || strings.HasPrefix(l, "process:") {
+		return s, nil // process paths may contain spaces and @
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return s, nil
+	}
+
+	var attrs []string
+	for _, f := range fields[1:] {
+		if a, ok := strings.CutPrefix(f, "@"); ok && a != "" {
+			attrs = append(attrs, strings.ToLower(a))
+		}
+	}
+	host := fields[0]
+	// In a regexp "@" is part of the pattern; only " @attr" annotates it.
+	for !strings.HasPrefix(strings.ToLower(host), "regexp:") {
+		i := strings.LastIndex(host, "@")
+		if i < 0 || i == len(host)-1 || strings.ContainsAny(host[i+1:], ".:/") {
+			break
+		}
+		attrs = append(attrs, strings.ToLower(host[i+1:]))
+		host = host[:i]
+	}
+	return host, attrs
+}
+
+// normalizeEntry turns a list line into a rule entry. Typed v2ray entries
+// (geosite:, domain:, ...) are kept as is, anything else is reduced to its
+// host with the shared normalizer; www. is dropped since plain entries are
+// substring matches anyway.
+func normalizeEntry(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if kind, pkg, ok := strings.Cut(s, ":"); ok && strings.EqualFold(kind, "app") {
+		// Android package names are case-sensitive.
+		if !androidPackage(pkg) {
+			return "", fmt.Errorf("invalid Android package name %q", pkg)
+		}
+		return "app:" + pkg, nil
+	}
+	if kind, p, ok := strings.Cut(s, ":"); ok && strings.EqualFold(kind, "process") {
+		// Process names and paths keep their case, Linux matches exactly.
+		if p = strings.TrimSpace(p); p == "" {
+			return "", fmt.Errorf("empty process name")
+		}
+		return "process:" + p, nil
+	}
+	if kind, val, ok := strings.Cut(s, ":"); ok && typedEntry(strings.ToLower(kind)) {
+		kind = strings.ToLower(kind)
+		// Regexps are matched case-sensitively and ext: names files.
+		if kind != "regexp" && kind != "ext" {
+			val = strings.ToLower(val)
+		}
+		return kind + ":" + val, nil
+	}
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n.String(), nil
+	}
+	if unwrapRedirects {
+		s = unwrap(s)
+	}
+	if d, ok := domain.Extract(s); ok {
+		fmt.Fprintf(os.Stderr, "warning: %q is not a host, using %s\n", s, d)
+		s = d
+	}
+
+	host, err := domain.Normalize(s)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(host, "www."), nil
+}
+
+// androidPackage checks the applicationId syntax: two or more dot
+// separated segments of letters, digits and _, each starting with a
+// letter.
+func androidPackage(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" || !(p[0] >= 'a' && p[0] <= 'z' || p[0] >= 'A' && p[0] <= 'Z') {
+			return false
+		}
+		for _, c := range p {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func typedEntry(kind string) bool {
+	switch kind {
+	case "geosite", "geoip", "ext", "domain", "full", "keyword", "regexp", "dotless":
+		return true
+	}
+	return false
+}
+
+// displayHost shows punycode hosts in Unicode for warnings.
+func displayHost(s string) string {
+	if u, err := idna.ToUnicode(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// unwrapRedirects is set by -unwrap: lists pasted from chats are full of
+// l.facebook.com/l.php?u=... and t.co links.
+var unwrapRedirects bool
+
+func addInputFlags(fs *flag.FlagSet) {
+	fs.Func("input-format", "Format of the inputs: "+strings.Join(inputFormats, ", ")+" (default auto, detected per file)", parseInputFormat)
+	fs.BoolVar(&unwrapRedirects, "unwrap", false, "Use the destination host of redirector URLs (google.com/url?q=..., l.facebook.com/l.php?u=...); shorteners like t.co are resolved over the network")
+}
+
+// unwrap replaces a redirector URL with its destination. Shorteners are
+// asked with a HEAD request; on failure the wrapper itself is kept.
+func unwrap(s string) string {
+	c, err := fetch.Default.Client()
+	if err == nil {
+		s, err = domain.Resolve(c, s)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cannot unwrap %s: %v\n", s, err)
+	}
+	return s
+}
+
+// startProfile starts the -cpuprofile, -memprofile and -trace outputs.
+func startProfile() {
+	if err := profile.Start(); err != nil {
+		fail(err.Error())
 	}
-	return out, sc.Err()
 }
 
 func fail(msg string) {
+	profile.Stop()
 	fmt.Fprint(os.Stderr, msg+"\n")
 	os.Exit(1)
 }
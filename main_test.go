@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuildRouteIPEntries(t *testing.T) {
+	g, err := parseDomains("proxy.txt", []byte("example.com\n10.0.0.0/8\n1.2.3.4\n2001:db8::/32\ngeoip:ru\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Outbound = "proxy"
+	link, err := encodeLink(buildRoute([]ruleGroup{g}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, err := decodeLink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var domains, ips []string
+	for _, r := range route.Rules {
+		if r.OutboundTag == "proxy" {
+			domains = append(domains, r.Domain...)
+			ips = append(ips, r.IP...)
+		}
+	}
+	if want := []string{"example.com"}; !slices.Equal(domains, want) {
+		t.Errorf("domain = %q, want %q", domains, want)
+	}
+	if want := []string{"10.0.0.0/8", "1.2.3.4", "2001:db8::/32", "geoip:ru"}; !slices.Equal(ips, want) {
+		t.Errorf("ip = %q, want %q", ips, want)
+	}
+}
+
+func TestNormalizeEntryTyped(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Domain:Example.COM", "domain:example.com"},
+		{"FULL:WWW.Example.com", "full:www.example.com"},
+		{"keyword:GooGle", "keyword:google"},
+		{"geosite:Category-Ads", "geosite:category-ads"},
+		{`Regexp:^[A-Z]+\S*\.com$`, `regexp:^[A-Z]+\S*\.com$`},
+		{"ext:Custom.dat:Tag", "ext:Custom.dat:Tag"},
+		{"Example.COM", "example.com"},
+		{"10.1.2.3/8", "10.0.0.0/8"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeEntry(tt.in)
+		if err != nil {
+			t.Errorf("normalizeEntry(%q): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("normalizeEntry(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitAttrs(t *testing.T) {
+	tests := []struct {
+		in    string
+		host  string
+		attrs []string
+	}{
+		{"example.cn @cn", "example.cn", []string{"cn"}},
+		{"example.cn@CN@ads", "example.cn", []string{"ads", "cn"}},
+		{"user@example.com", "user@example.com", nil},
+		{`regexp:^a@b\.com$ @cn`, `regexp:^a@b\.com$`, []string{"cn"}},
+		{"regexp:^x@y$", "regexp:^x@y$", nil},
+	}
+	for _, tt := range tests {
+		host, attrs := splitAttrs(tt.in)
+		if host != tt.host || !slices.Equal(attrs, tt.attrs) {
+			t.Errorf("splitAttrs(%q) = %q, %q; want %q, %q", tt.in, host, attrs, tt.host, tt.attrs)
+		}
+	}
+}
+
+func TestParseDomainsIncludesAndMacros(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	write("banks.txt", "$banks = sber.ru tinkoff.ru\n# shops\nozon.ru\n")
+	write("hosts.txt", "0.0.0.0 ads.com\n")
+	body := "!include banks.txt\n!include hosts.txt\n@use $banks vk.com $nope\nozon.ru\n"
+	g, err := parseDomains(write("top.txt", body), []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ozon.ru", "ads.com", "sber.ru", "tinkoff.ru", "vk.com"}; !slices.Equal(g.Domains, want) {
+		t.Errorf("domains = %q, want %q", g.Domains, want)
+	}
+	if g.Notes["ozon.ru"] != "shops" {
+		t.Errorf("note of ozon.ru = %q, want shops", g.Notes["ozon.ru"])
+	}
+	if o := g.Origins["ads.com"]; !strings.HasSuffix(o, "hosts.txt") || !strings.Contains(o, " > ") {
+		t.Errorf("origin of ads.com = %q", o)
+	}
+
+	write("loop.txt", "!include top2.txt\n")
+	if _, err := parseDomains(write("top2.txt", "!include loop.txt\n"), []byte("!include loop.txt\n")); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("include loop: error = %v, want an include cycle", err)
+	}
+}
+
+func TestIncludePath(t *testing.T) {
+	tests := []struct {
+		parent, target, want string
+	}{
+		{"lists/top.txt", "sub/a.txt", filepath.Join("lists", "sub", "a.txt")},
+		{"https://h.com/l/top.txt", "a.txt", "https://h.com/l/a.txt"},
+		{"https://h.com/l/top.txt", "https://o.com/b.txt", "https://o.com/b.txt"},
+		{"git+https://h.com/r.git//l/top.txt?ref=v1", "a.txt", "git+https://h.com/r.git//l/a.txt?ref=v1"},
+	}
+	for _, tt := range tests {
+		if got := includePath(tt.parent, tt.target); got != tt.want {
+			t.Errorf("includePath(%q, %q) = %q, want %q", tt.parent, tt.target, got, tt.want)
+		}
+	}
+}
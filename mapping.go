@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseMapping reads rows of "host,outbound[,note]" (tab-separated for
+// .tsv or without commas) and groups hosts into one rule per outbound, in
+// order of first appearance. An empty outbound means direct. A header row
+// is skipped if present.
+func parseMapping(path string, b []byte) ([]ruleGroup, error) {
+	r := csv.NewReader(bytes.NewReader(b))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	if strings.EqualFold(filepath.Ext(path), ".tsv") || (!bytes.Contains(b, []byte(",")) && bytes.Contains(b, []byte("\t"))) {
+		r.Comma = '\t'
+		r.LazyQuotes = true
+	}
+
+	var groups []ruleGroup
+	index := make(map[string]int)   // outbound -> groups index
+	seen := make(map[string]string) // host -> outbound
+
+	for row := 1; ; row++ {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) == 0 {
+			continue
+		}
+
+		outbound := "direct"
+		if len(rec) > 1 && strings.TrimSpace(rec[1]) != "" {
+			outbound = strings.TrimSpace(rec[1])
+		}
+
+		first := strings.ToLower(strings.TrimSpace(rec[0]))
+		if first == "" || (row == 1 && (first == "host" || first == "domain")) {
+			continue
+		}
+		host, attrs := splitAttrs(rec[0])
+		host, err = normalizeEntry(host)
+		if err != nil {
+			line, _ := r.FieldPos(0)
+			fmt.Fprintf(os.Stderr, "warning: %s:%d: skipping %q: %v\n", path, line, rec[0], err)
+			continue
+		}
+		if prev, ok := seen[host]; ok {
+			if prev != outbound {
+				line, _ := r.FieldPos(0)
+				fmt.Fprintf(os.Stderr, "warning: %s:%d: %s already mapped to %s, ignoring %s\n", path, line, host, prev, outbound)
+			}
+			continue
+		}
+		seen[host] = outbound
+
+		i, ok := index[outbound]
+		if !ok {
+			i = len(groups)
+			index[outbound] = i
+			groups = append(groups, ruleGroup{Name: ruleName(outbound), Outbound: outbound, Attrs: make(map[string][]string), Notes: make(map[string]string)})
+		}
+		groups[i].Domains = append(groups[i].Domains, host)
+		if len(rec) > 2 && strings.TrimSpace(rec[2]) != "" {
+			groups[i].Notes[host] = strings.TrimSpace(rec[2])
+		}
+		if len(attrs) > 0 {
+			groups[i].Attrs[host] = attrs
+		}
+	}
+
+	return groups, nil
+}
+
+// ruleName turns an outbound tag into a rule title: direct -> Direct.
+func ruleName(outbound string) string {
+	if outbound == "" {
+		return ""
+	}
+	return strings.ToUpper(outbound[:1]) + outbound[1:]
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseMapping(t *testing.T) {
+	type group struct {
+		outbound string
+		domains  []string
+	}
+	tests := []struct {
+		name, path, in string
+		want           []group
+	}{
+		{
+			name: "csv with header",
+			path: "map.csv",
+			in:   "host,outbound,note\nexample.com,proxy\nWWW.Bank.ru,direct,bank\nads.com,block\n",
+			want: []group{{"proxy", []string{"example.com"}}, {"direct", []string{"bank.ru"}}, {"block", []string{"ads.com"}}},
+		},
+		{
+			name: "empty outbound is direct",
+			path: "map.csv",
+			in:   "a.com\nb.com,\nc.com,proxy\n",
+			want: []group{{"direct", []string{"a.com", "b.com"}}, {"proxy", []string{"c.com"}}},
+		},
+		{
+			name: "first mapping wins",
+			path: "map.csv",
+			in:   "a.com,proxy\na.com,direct\nb.com,direct\n",
+			want: []group{{"proxy", []string{"a.com"}}, {"direct", []string{"b.com"}}},
+		},
+		{
+			name: "tsv by extension",
+			path: "map.tsv",
+			in:   "domain\toutbound\na.com\tproxy\n\"b.com\tdirect\n",
+			want: []group{{"proxy", []string{"a.com"}}, {"direct", []string{"b.com"}}},
+		},
+		{
+			name: "tabs without commas",
+			path: "map.txt",
+			in:   "# comment\na.com\tproxy\nb.com\tproxy\n",
+			want: []group{{"proxy", []string{"a.com", "b.com"}}},
+		},
+		{
+			name: "bad host skipped",
+			path: "map.csv",
+			in:   "a.com,proxy\nmailto:x,proxy\n",
+			want: []group{{"proxy", []string{"a.com"}}},
+		},
+	}
+	for _, tt := range tests {
+		groups, err := parseMapping(tt.path, []byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var got []group
+		for _, g := range groups {
+			got = append(got, group{g.Outbound, g.Domains})
+		}
+		if !slices.EqualFunc(got, tt.want, func(a, b group) bool {
+			return a.outbound == b.outbound && slices.Equal(a.domains, b.domains)
+		}) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseMappingNotesAndAttrs(t *testing.T) {
+	groups, err := parseMapping("map.csv", []byte("a.com @cn,proxy,video\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := groups[0]
+	if g.Name != "Proxy" || g.Notes["a.com"] != "video" || !slices.Equal(g.Attrs["a.com"], []string{"cn"}) {
+		t.Errorf("got name %q, notes %q, attrs %q", g.Name, g.Notes, g.Attrs)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/devemio/v2raytun-routing/atomicfile"
+	"github.com/devemio/v2raytun-routing/geosite"
+)
+
+// matchCache remembers the geosite matches of each domain for one
+// geosite.dat content. It is kept on disk, so later runs and daemon
+// cycles over a mostly unchanged list only match the new domains.
+type matchCache struct {
+	m    *geosite.Matcher
+	path string
+
+	mu      sync.Mutex
+	entries map[string][]geosite.Match
+	dirty   bool
+}
+
+// matchCacheFile is the on-disk format; Version changes drop old files.
+type matchCacheFile struct {
+	Version int                        `json:"version"`
+	Matches map[string][]geosite.Match `json:"matches"`
+}
+
+const (
+	matchCacheVersion = 3
+	matchCacheMaxAge  = 30 * 24 * time.Hour // unused files are pruned after this
+)
+
+// matchCaches maps a *geosite.Matcher made by loadMatcher to its cache.
+var matchCaches sync.Map
+
+func newMatchCache(m *geosite.Matcher, sum [32]byte) *matchCache {
+	c := &matchCache{
+		m:       m,
+		path:    filepath.Join(xdg.CacheHome, "v2raytun-routing", "matches", hex.EncodeToString(sum[:16])+".json"),
+		entries: make(map[string][]geosite.Match),
+	}
+	if b, err := os.ReadFile(c.path); err == nil {
+		var f matchCacheFile
+		if json.Unmarshal(b, &f) == nil && f.Version == matchCacheVersion && f.Matches != nil {
+			c.entries = f.Matches
+		}
+	}
+	return c
+}
+
+// cachedMatch is m.Match through the cache of m, if it has one.
+func cachedMatch(m *geosite.Matcher, host string) []geosite.Match {
+	v, ok := matchCaches.Load(m)
+	if !ok {
+		return m.Match(host)
+	}
+	c := v.(*matchCache)
+
+	c.mu.Lock()
+	matches, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok {
+		return slices.Clone(matches)
+	}
+	matches = m.Match(host)
+	c.mu.Lock()
+	c.entries[host] = slices.Clone(matches)
+	c.dirty = true
+	c.mu.Unlock()
+	return matches
+}
+
+// saveMatchCaches writes the caches that learned new domains and prunes
+// files no run has used for a while. Failures only cost speed.
+func saveMatchCaches() {
+	matchCaches.Range(func(_, v any) bool {
+		c := v.(*matchCache)
+		if err := c.save(); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: match cache:", err)
+		}
+		return true
+	})
+}
+
+func (c *matchCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !c.dirty {
+		// Touch it so pruning sees it is in use.
+		_ = os.Chtimes(c.path, now, now)
+		return nil
+	}
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := atomicfile.Create(c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(matchCacheFile{Version: matchCacheVersion, Matches: c.entries}); err != nil {
+		return err
+	}
+	if err := f.Commit(); err != nil {
+		return err
+	}
+	c.dirty = false
+
+	old, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, p := range old {
+		if fi, err := os.Stat(p); err == nil && now.Sub(fi.ModTime()) > matchCacheMaxAge {
+			_ = os.Remove(p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// BuildMeta traces a link back to its inputs. v2rayTun ignores unknown
+// fields, the same way it ignores __name__ on rules.
+type BuildMeta struct {
+	Generator string            `json:"generator"`
+	Geosite   string            `json:"geosite,omitempty"`
+	Sources   map[string]string `json:"sources"` // path -> sha256
+	Built     string            `json:"built"`
+}
+
+func newBuildMeta(geositeRelease string, sources map[string]string) *BuildMeta {
+	return &BuildMeta{
+		Generator: generatorVersion(),
+		Geosite:   geositeRelease,
+		Sources:   sources,
+		Built:     time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func generatorVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+				return "dev+" + s.Value[:12]
+			}
+		}
+	}
+	return version
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// withContentHash appends a short hash of the rules to the route name,
+// e.g. "Default #a1b2c3", so users can see in the app whether they have
+// the latest version. IDs are left out since they change on every build.
+func withContentHash(route Route) Route {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\n", route.DomainStrategy, route.DomainMatcher)
+	for _, r := range route.Rules {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\n", r.Name, r.Type, r.OutboundTag, strings.Join(r.Domain, "\x00"))
+		if len(r.IP) > 0 {
+			fmt.Fprintf(h, "ip\x00%s\n", strings.Join(r.IP, "\x00"))
+		}
+		if len(r.Source) > 0 {
+			fmt.Fprintf(h, "source\x00%s\n", strings.Join(r.Source, "\x00"))
+		}
+	}
+	if a := route.Apps; a != nil {
+		fmt.Fprintf(h, "apps\x00%s\x00%s\n", a.Mode, strings.Join(a.Packages, "\x00"))
+	}
+	route.Name += " #" + hex.EncodeToString(h.Sum(nil))[:6]
+	return route
+}
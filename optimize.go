@@ -0,0 +1,151 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/geosite"
+)
+
+// Optimize controls replacing explicit domains with geosite selectors.
+type Optimize struct {
+	MaxSize  int `yaml:"max-size"`  // ignore selectors with more rules, 0 = 1000
+	MinCover int `yaml:"min-cover"` // selector must replace at least this many domains, 0 = 2
+}
+
+// selectorUse records a selector that replaced explicit domains.
+type selectorUse struct {
+	Rule     string
+	Selector string
+	Size     int
+	Replaced []string
+}
+
+// optimizeGroup greedily picks the selector covering the most remaining
+// domains (narrowest first on ties) until none covers MinCover. Selectors
+// covering any excluded host are never used, or they would capture it.
+func optimizeGroup(g ruleGroup, m *geosite.Matcher, opt Optimize, exclude []string) (ruleGroup, []selectorUse) {
+	maxSize, minCover := opt.MaxSize, opt.MinCover
+	if maxSize <= 0 {
+		maxSize = 1000
+	}
+	if minCover <= 0 {
+		minCover = 2
+	}
+
+	type candidate struct {
+		size    int
+		domains map[string]struct{}
+	}
+	candidates := make(map[string]*candidate)
+	for _, d := range g.Domains {
+		if strings.Contains(d, ":") {
+			continue // already a selector or typed entry
+		}
+		for _, match := range cachedMatch(m, d) {
+			if match.GroupSize > maxSize {
+				continue
+			}
+			if a := g.Attrs[d]; len(a) > 0 && !slices.Contains(a, strings.ToLower(match.Attr)) {
+				continue // annotated domains only go to selectors with that attribute
+			}
+			sel := strings.ToLower(match.Selector)
+			c, ok := candidates[sel]
+			if !ok {
+				c = &candidate{size: match.GroupSize, domains: make(map[string]struct{})}
+				candidates[sel] = c
+			}
+			c.domains[d] = struct{}{}
+		}
+	}
+
+	for sel := range candidates {
+		for _, x := range exclude {
+			if m.Covers(sel, x) {
+				delete(candidates, sel)
+				break
+			}
+		}
+	}
+
+	replaced := make(map[string]struct{})
+	var used []selectorUse
+	for {
+		best, bestCount := "", 0
+		for sel, c := range candidates {
+			n := 0
+			for d := range c.domains {
+				if _, done := replaced[d]; !done {
+					n++
+				}
+			}
+			if n > bestCount || (n == bestCount && n > 0 && (c.size < candidates[best].size || (c.size == candidates[best].size && sel < best))) {
+				best, bestCount = sel, n
+			}
+		}
+		if bestCount < minCover {
+			break
+		}
+
+		use := selectorUse{Rule: g.Name, Selector: best, Size: candidates[best].size}
+		for d := range candidates[best].domains {
+			if _, done := replaced[d]; !done {
+				replaced[d] = struct{}{}
+				use.Replaced = append(use.Replaced, d)
+			}
+		}
+		sort.Strings(use.Replaced)
+		used = append(used, use)
+		delete(candidates, best)
+	}
+
+	if len(used) == 0 {
+		return g, nil
+	}
+
+	out := ruleGroup{Name: g.Name, Outbound: g.Outbound, Attrs: g.Attrs, Sections: g.Sections, Notes: maps.Clone(g.Notes)}
+	for _, u := range used {
+		out.Domains = append(out.Domains, u.Selector)
+		// A selector keeps the note its domains agree on.
+		if n := g.Notes[u.Replaced[0]]; n != "" && !slices.ContainsFunc(u.Replaced, func(d string) bool { return g.Notes[d] != n }) {
+			out.Notes[u.Selector] = n
+		}
+	}
+	for _, d := range g.Domains {
+		if _, done := replaced[d]; !done {
+			out.Domains = append(out.Domains, d)
+		}
+	}
+	return out, used
+}
+
+// excludeGroups drops excluded hosts from every group.
+func excludeGroups(groups []ruleGroup, exclude []string) ([]ruleGroup, []string) {
+	if len(exclude) == 0 {
+		return groups, nil
+	}
+	ex := make(map[string]struct{}, len(exclude))
+	for _, x := range exclude {
+		ex[x] = struct{}{}
+	}
+
+	var dropped []string
+	out := make([]ruleGroup, 0, len(groups))
+	for _, g := range groups {
+		kept := g.Domains[:0:0]
+		for _, d := range g.Domains {
+			if _, ok := ex[d]; ok {
+				dropped = append(dropped, d)
+				continue
+			}
+			kept = append(kept, d)
+		}
+		g.Domains = kept
+		if len(g.Domains) > 0 {
+			out = append(out, g)
+		}
+	}
+	return out, dropped
+}
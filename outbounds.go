@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// knownOutbounds returns the outbound and balancer tags of a client: s is
+// a comma-separated list of tags or the path to a v2ray/Xray or sing-box
+// JSON config.
+func knownOutbounds(s string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	b, err := os.ReadFile(s)
+	if err != nil {
+		if strings.ContainsAny(s, "/\\") || strings.HasSuffix(s, ".json") {
+			return nil, err
+		}
+		for _, t := range strings.Split(s, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				known[t] = true
+			}
+		}
+		return known, nil
+	}
+
+	var cfg struct {
+		Outbounds []struct {
+			Tag string `json:"tag"`
+		} `json:"outbounds"`
+		Routing struct {
+			Balancers []struct {
+				Tag string `json:"tag"`
+			} `json:"balancers"`
+		} `json:"routing"`
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", s, err)
+	}
+	for _, o := range cfg.Outbounds {
+		known[o.Tag] = true
+	}
+	for _, o := range cfg.Routing.Balancers {
+		known[o.Tag] = true
+	}
+	delete(known, "")
+	if len(known) == 0 {
+		return nil, fmt.Errorf("%s: no tagged outbounds", s)
+	}
+	return known, nil
+}
+
+// checkOutbounds warns about every rule whose outbound the client does
+// not define; the app would fail on it only at runtime. It returns the
+// number of such rules.
+func checkOutbounds(w io.Writer, route Route, known map[string]bool) int {
+	n := 0
+	for _, r := range route.Rules {
+		if known[r.OutboundTag] {
+			continue
+		}
+		n++
+		hint := ""
+		for t := range known {
+			if strings.EqualFold(t, r.OutboundTag) {
+				hint = fmt.Sprintf(" (did you mean %q?)", t)
+			}
+		}
+		if hint == "" {
+			tags := make([]string, 0, len(known))
+			for t := range known {
+				tags = append(tags, t)
+			}
+			slices.Sort(tags)
+			hint = " (have " + strings.Join(tags, ", ") + ")"
+		}
+		fmt.Fprintf(w, "warning: rule %s: outbound %q is not defined by the client%s\n", ruleLabel(r), r.OutboundTag, hint)
+	}
+	return n
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/devemio/v2raytun-routing/atomicfile"
+)
+
+// output is stdout, or with -o a file that only appears once complete.
+type output struct {
+	io.Writer
+	f *atomicfile.File
+}
+
+func openOutput(path string) *output {
+	if path == "" || path == "-" {
+		return &output{Writer: os.Stdout}
+	}
+	f, err := atomicfile.Create(path)
+	if err != nil {
+		fail(err.Error())
+	}
+	return &output{Writer: f, f: f}
+}
+
+func (o *output) commit() {
+	if o.f == nil {
+		return
+	}
+	if err := o.f.Commit(); err != nil {
+		fail(err.Error())
+	}
+}
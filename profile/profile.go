@@ -0,0 +1,90 @@
+// Package profile adds -cpuprofile, -memprofile and -trace to a command,
+// so performance reports can come with profiles from a stock build.
+package profile
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+)
+
+var (
+	cpuPath, memPath, tracePath string
+
+	mu    sync.Mutex
+	stops []func() error
+)
+
+func AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cpuPath, "cpuprofile", "", "Write a CPU profile to this file (go tool pprof)")
+	fs.StringVar(&memPath, "memprofile", "", "Write a heap profile to this file on exit (go tool pprof)")
+	fs.StringVar(&tracePath, "trace", "", "Write an execution trace to this file (go tool trace)")
+}
+
+// Start begins the profiles requested by the flags. Stop must run before
+// the process exits, also on error paths calling os.Exit.
+func Start() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+		stops = append(stops, func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+	if tracePath != "" {
+		f, err := os.Create(tracePath)
+		if err != nil {
+			return err
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return err
+		}
+		stops = append(stops, func() error {
+			trace.Stop()
+			return f.Close()
+		})
+	}
+	if memPath != "" {
+		stops = append(stops, func() error {
+			f, err := os.Create(memPath)
+			if err != nil {
+				return err
+			}
+			runtime.GC() // up-to-date statistics
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		})
+	}
+	return nil
+}
+
+// Stop writes the profiles; later calls do nothing.
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, stop := range stops {
+		if err := stop(); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: profile:", err)
+		}
+	}
+	stops = nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// resolved is what a host resolves to now, and for how long.
+type resolved struct {
+	Host  string
+	Addrs []netip.Addr
+	TTL   time.Duration // smallest TTL of the answers
+	Err   error
+}
+
+// resolveHosts asks server for A and AAAA records of every host, with at
+// most jobs queries in flight, keeping the input order. The system
+// resolver is not used since it hides TTLs.
+func resolveHosts(server string, hosts []string, jobs int) []resolved {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	out := make([]resolved, len(hosts))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			out[i].Host = h
+			for _, t := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+				addrs, ttl, err := query(server, h, t)
+				if err != nil {
+					out[i].Err = err
+					continue
+				}
+				out[i].Addrs = append(out[i].Addrs, addrs...)
+				if len(addrs) > 0 && (out[i].TTL == 0 || ttl < out[i].TTL) {
+					out[i].TTL = ttl
+				}
+			}
+			if len(out[i].Addrs) > 0 {
+				out[i].Err = nil
+			}
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// query sends one question over UDP, retrying over TCP if truncated.
+func query(server, host string, t dnsmessage.Type) ([]netip.Addr, time.Duration, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	id := uint16(rand.Uint32())
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: t, Class: dnsmessage.ClassINET}},
+	}
+	req, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := exchange("udp", server, req)
+	if err == nil && resp.Truncated {
+		resp, err = exchange("tcp", server, req)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.ID != id {
+		return nil, 0, errors.New("dns: mismatched reply id")
+	}
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("dns: %s: %v", host, resp.RCode)
+	}
+
+	var addrs []netip.Addr
+	var ttl uint32
+	for _, a := range resp.Answers {
+		switch b := a.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, netip.AddrFrom4(b.A))
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, netip.AddrFrom16(b.AAAA))
+		default:
+			continue
+		}
+		if ttl == 0 || a.Header.TTL < ttl {
+			ttl = a.Header.TTL
+		}
+	}
+	return addrs, time.Duration(ttl) * time.Second, nil
+}
+
+func exchange(network, server string, req []byte) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, server, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 65535)
+	var n int
+	if network == "tcp" {
+		// length-prefixed framing, RFC 1035 4.2.2
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(req)))); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(buf[:2]))
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		if n, err = conn.Read(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf[:n]); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const defaultLinkPrefix = "v2rayTun://import_route/"
+
+// linkPrefix is set by -link-prefix, for forks and rebranded clients
+// that use another scheme with the same payload format.
+var linkPrefix = defaultLinkPrefix
+
+func addLinkFlags(fs *flag.FlagSet) {
+	fs.StringVar(&linkPrefix, "link-prefix", linkPrefix, "URL prefix put before the base64 route payload")
+}
+
+type Route struct {
+	Name           string `json:"name"`
+	DomainStrategy string `json:"domainStrategy"`
+	ID             string `json:"id"`
+	DomainMatcher  string `json:"domainMatcher"`
+	Rules          []Rule `json:"rules"`
+	Balancers      []any  `json:"balancers"`
+
+	Apps *AppList   `json:"appList,omitempty"`
+	Meta *BuildMeta `json:"__meta__,omitempty"`
+}
+
+// AppList is per-app split tunneling on Android: with mode "bypass" the
+// listed packages skip the VPN, with "proxy" only they use it.
+type AppList struct {
+	Mode     string   `json:"mode"`
+	Packages []string `json:"packages"`
+}
+
+type Rule struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Domain      []string `json:"domain,omitempty"`
+	IP          []string `json:"ip,omitempty"` // geoip: selectors, addresses, CIDRs
+	OutboundTag string   `json:"outboundTag"`
+	Name        string   `json:"__name__"`
+
+	// Source limits the rule to clients with these addresses or CIDRs.
+	Source []string `json:"source,omitempty"`
+
+	// Process holds process names and paths for desktop cores. The
+	// mobile client cannot match them, so they stay out of the link.
+	Process []string `json:"-"`
+}
+
+func encodeLink(route Route) (string, error) {
+	return encodeLinkPrefix(route, linkPrefix)
+}
+
+func encodeLinkPrefix(route Route, prefix string) (string, error) {
+	// A rule of only process entries would match everything.
+	route.Rules = slices.DeleteFunc(slices.Clone(route.Rules), func(r Rule) bool {
+		return len(r.Domain) == 0 && len(r.Process) > 0
+	})
+	b, err := json.Marshal(route)
+	if err != nil {
+		return "", err
+	}
+	return prefix + base64.URLEncoding.EncodeToString(b), nil
+}
+
+// decodeLink accepts a full import link with the configured or default
+// prefix, any other scheme://.../<payload>, or just the base64 payload.
+func decodeLink(link string) (Route, error) {
+	var route Route
+
+	payload := strings.TrimSpace(link)
+	switch {
+	case strings.HasPrefix(payload, linkPrefix):
+		payload = payload[len(linkPrefix):]
+	case strings.Contains(payload, "import_route/"):
+		payload = payload[strings.Index(payload, "import_route/")+len("import_route/"):]
+	case strings.Contains(payload, "://"):
+		payload = payload[strings.LastIndex(payload, "/")+1:]
+	}
+	if payload == "" {
+		return route, errors.New("empty route link")
+	}
+
+	var b []byte
+	var err error
+	for _, enc := range []*base64.Encoding{
+		base64.URLEncoding, base64.RawURLEncoding, base64.StdEncoding, base64.RawStdEncoding,
+	} {
+		if b, err = enc.DecodeString(payload); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return route, fmt.Errorf("decode route link: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &route); err != nil {
+		return route, fmt.Errorf("parse route json: %w", err)
+	}
+	return route, nil
+}
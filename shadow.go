@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+)
+
+// shadowedEntry is a rule entry that can never win under first-match
+// semantics because an earlier rule already captures it.
+type shadowedEntry struct {
+	Rule    int // index into route.Rules
+	Entry   string
+	ByRule  int
+	ByEntry string
+}
+
+// shadowed checks entries that name a concrete host (plain, domain:,
+// full:) against all earlier rules. Keyword, regexp and selector entries
+// match open-ended sets and are not checked.
+func (s *simulator) shadowed() []shadowedEntry {
+	var out []shadowedEntry
+	for i, r := range s.route.Rules {
+		for _, e := range r.Domain {
+			host, ok := entryHost(e)
+			if !ok {
+				continue
+			}
+		earlier:
+			for j := 0; j < i; j++ {
+				for _, prev := range s.route.Rules[j].Domain {
+					if s.matchEntry(host, prev) {
+						out = append(out, shadowedEntry{Rule: i, Entry: e, ByRule: j, ByEntry: prev})
+						break earlier
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+func entryHost(entry string) (string, bool) {
+	kind, val, ok := strings.Cut(entry, ":")
+	if !ok {
+		return strings.ToLower(entry), entry != ""
+	}
+	switch kind {
+	case "domain", "full":
+		return strings.ToLower(val), val != ""
+	}
+	return "", false
+}
+
+// pruneShadowed removes shadowed entries; rules left empty are dropped.
+func pruneShadowed(route Route, list []shadowedEntry) Route {
+	drop := make(map[int]map[string]struct{})
+	for _, sh := range list {
+		if drop[sh.Rule] == nil {
+			drop[sh.Rule] = make(map[string]struct{})
+		}
+		drop[sh.Rule][sh.Entry] = struct{}{}
+	}
+
+	rules := make([]Rule, 0, len(route.Rules))
+	for i, r := range route.Rules {
+		if d := drop[i]; d != nil {
+			kept := make([]string, 0, len(r.Domain))
+			for _, e := range r.Domain {
+				if _, ok := d[e]; !ok {
+					kept = append(kept, e)
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			r.Domain = kept
+		}
+		rules = append(rules, r)
+	}
+	route.Rules = rules
+	return route
+}
+
+func printShadowed(w io.Writer, route Route, list []shadowedEntry) {
+	for _, sh := range list {
+		r, by := route.Rules[sh.Rule], route.Rules[sh.ByRule]
+		fmt.Fprintf(w, "shadowed: %s in %s (%s) is captured by %s in %s (%s)\n",
+			sh.Entry, ruleLabel(r), r.OutboundTag, sh.ByEntry, ruleLabel(by), by.OutboundTag)
+	}
+}
+
+// checkShadowed implements -shadowed report|prune for the generating commands.
+func checkShadowed(route Route, mode string, m *geosite.Matcher) Route {
+	switch mode {
+	case "":
+		return route
+	case "report", "prune":
+	default:
+		fail(fmt.Sprintf("unknown -shadowed %q (want report or prune)", mode))
+	}
+
+	list := newSimulatorWith(route, m).shadowed()
+	printShadowed(os.Stderr, route, list)
+	if mode == "prune" && len(list) > 0 {
+		route = pruneShadowed(route, list)
+		fmt.Fprintf(os.Stderr, "pruned %d shadowed entries\n", len(list))
+	}
+	return route
+}
+
+func shadowCmd(args []string) {
+	fs := flag.NewFlagSet("shadow", flag.ExitOnError)
+	link := fs.String("route", "", "Route link (v2rayTun://import_route/...) or path to a file containing it")
+	geositePath := fs.String("geosite", "dlc.dat", "Path to geosite.dat, required if the route uses geosite: selectors")
+	prune := fs.Bool("prune", false, "Print the route link with shadowed entries removed")
+	addLinkFlags(fs)
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	_ = fs.Parse(args)
+
+	if *link == "" {
+		fail("usage: go run . shadow -route <link|file> [-geosite dlc.dat] [-prune]")
+	}
+	route, err := loadRoute(*link)
+	if err != nil {
+		fail(err.Error())
+	}
+	sim, err := newSimulator(route, *geositePath)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	list := sim.shadowed()
+	printShadowed(os.Stderr, route, list)
+	if len(list) == 0 {
+		fmt.Fprintln(os.Stderr, "no shadowed entries")
+	}
+	if *prune {
+		l, err := encodeLink(pruneShadowed(route, list))
+		if err != nil {
+			fail(err.Error())
+		}
+		fmt.Print(l)
+	}
+}
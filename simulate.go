@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+	"github.com/devemio/v2raytun-routing/geosite"
+	"github.com/devemio/v2raytun-routing/profile"
+)
+
+const defaultOutbound = "(default)"
+
+func simulate(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	link := fs.String("route", "", "Route link (v2rayTun://import_route/...) or path to a file containing it")
+	domainsPath := fs.String("domains", "domains.txt", "Path, glob, directory or URL of files with test domains (one per line), - for stdin; ignored if hosts are given as arguments")
+	geositePath := fs.String("geosite", "dlc.dat", "Path to geosite.dat, required if the route uses geosite: selectors")
+	outPath := fs.String("o", "", "Write the report to this file (atomically) instead of stdout")
+	addInputFlags(fs)
+	fetch.AddFlags(fs)
+	addDecodeFlags(fs)
+	profile.AddFlags(fs)
+	_ = fs.Parse(args)
+	startProfile()
+	defer profile.Stop()
+
+	if *link == "" {
+		fail("usage: go run . simulate -route <link|file> [-domains test.txt] [-geosite dlc.dat] [host...]")
+	}
+
+	route, err := loadRoute(*link)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	domains, err := inputDomains(fs.Args(), *domainsPath)
+	if err != nil {
+		fail(err.Error())
+	} else if len(domains) == 0 {
+		fail("domain list is empty")
+	}
+
+	sim, err := newSimulator(route, *geositePath)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	out := openOutput(*outPath)
+	counts := sim.printWinners(out, domains)
+	fmt.Fprintln(out)
+	printOutboundCounts(out, counts, len(domains))
+	out.commit()
+}
+
+// inputDomains takes hosts from positional args, where "-" reads stdin,
+// falling back to the domains file.
+func inputDomains(args []string, path string) ([]string, error) {
+	if len(args) == 0 {
+		return readDomains(path)
+	}
+
+	var out []string
+	for _, a := range args {
+		if a == "-" {
+			d, err := readDomains(a)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, d...)
+		} else if s, err := normalizeEntry(a); err == nil {
+			out = append(out, s)
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: skipping %q: %v\n", a, err)
+		}
+	}
+	return out, nil
+}
+
+// printWinners writes the domain -> winning rule -> outbound table and
+// returns the number of domains per outbound.
+func (s *simulator) printWinners(w io.Writer, domains []string) map[string]int {
+	counts := make(map[string]int)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOMAIN\tRULE\tOUTBOUND\tVIA")
+	for _, d := range domains {
+		rule, via := s.winner(d)
+		name, outbound := "-", defaultOutbound
+		if rule != nil {
+			name, outbound = ruleLabel(*rule), rule.OutboundTag
+		}
+		counts[outbound]++
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d, name, outbound, via)
+	}
+	_ = tw.Flush()
+	return counts
+}
+
+func printOutboundCounts(w io.Writer, counts map[string]int, total int) {
+	outbounds := make([]string, 0, len(counts))
+	for o := range counts {
+		outbounds = append(outbounds, o)
+	}
+	sort.Slice(outbounds, func(i, j int) bool {
+		if counts[outbounds[i]] != counts[outbounds[j]] {
+			return counts[outbounds[i]] > counts[outbounds[j]]
+		}
+		return outbounds[i] < outbounds[j]
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OUTBOUND\tDOMAINS")
+	for _, o := range outbounds {
+		fmt.Fprintf(tw, "%s\t%d\n", o, counts[o])
+	}
+	fmt.Fprintf(tw, "total\t%d\n", total)
+	_ = tw.Flush()
+}
+
+// groupHosts lists the concrete hosts of the input groups, skipping
+// selectors and typed entries, which are not domains to route.
+func groupHosts(groups []ruleGroup) []string {
+	var out []string
+	for _, g := range groups {
+		for _, d := range g.Domains {
+			if !strings.Contains(d, ":") {
+				out = append(out, d)
+			}
+		}
+	}
+	return out
+}
+
+// loadRoute accepts either a link or a path to a file holding one.
+func loadRoute(s string) (Route, error) {
+	if !strings.Contains(s, "://") {
+		if b, err := os.ReadFile(s); err == nil {
+			s = string(b)
+		}
+	}
+	return decodeLink(s)
+}
+
+func ruleLabel(r Rule) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.ID
+}
+
+// simulator evaluates route rules with v2ray's first-match semantics.
+type simulator struct {
+	route Route
+	geo   *geosite.Matcher
+	regex map[string]*regexp.Regexp
+}
+
+// newSimulatorWith uses an already loaded matcher; with nil, geosite
+// entries never match.
+func newSimulatorWith(route Route, m *geosite.Matcher) *simulator {
+	return &simulator{route: route, geo: m, regex: make(map[string]*regexp.Regexp)}
+}
+
+func newSimulator(route Route, geositePath string) (*simulator, error) {
+	s := newSimulatorWith(route, nil)
+
+	for _, r := range route.Rules {
+		for _, e := range r.Domain {
+			if !strings.HasPrefix(e, "geosite:") {
+				continue
+			}
+			m, err := loadMatcher(geositePath)
+			if err != nil {
+				return nil, fmt.Errorf("route uses geosite selectors: %w", err)
+			}
+			s.geo = m
+			return s, nil
+		}
+	}
+	return s, nil
+}
+
+// decodeOpts is how every command decodes geosite.dat; -lenient sets it.
+var decodeOpts = geosite.DecodeOptions{Warn: func(err error) {
+	fmt.Fprintln(os.Stderr, "warning:", err)
+}}
+
+func addDecodeFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&decodeOpts.Lenient, "lenient", false, "Skip corrupt geosite.dat entries and keep the tags before a truncated end, with warnings, instead of failing")
+}
+
+// loadMatcher loads geosite.dat and warns about regex rules that will
+// never match. The index is kept per path and only rebuilt when the
+// content changes, so daemon rebuilds reuse it.
+func loadMatcher(path string) (*geosite.Matcher, error) {
+	var prev cachedMatcher
+	if c, ok := matchers.Load(path); ok {
+		prev = c.(cachedMatcher)
+	}
+	list, sum, err := decodeOpts.LoadIfChanged(context.Background(), path, prev.sum)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return prev.m, nil
+	}
+	if prev.m != nil {
+		matchCaches.Delete(prev.m)
+	}
+
+	m := geosite.NewMatcher(list)
+	for _, e := range m.RegexErrors() {
+		fmt.Fprintln(os.Stderr, "warning:", e)
+	}
+	matchers.Store(path, cachedMatcher{sum: sum, m: m})
+	matchCaches.Store(m, newMatchCache(m, sum))
+	return m, nil
+}
+
+// matchers maps a geosite path to its last cachedMatcher.
+var matchers sync.Map
+
+type cachedMatcher struct {
+	sum [sha256.Size]byte
+	m   *geosite.Matcher
+}
+
+// winner returns the first rule matching host and the entry that matched.
+func (s *simulator) winner(host string) (*Rule, string) {
+	for i := range s.route.Rules {
+		r := &s.route.Rules[i]
+		if len(r.Source) > 0 {
+			continue // the simulated client is in no subnet
+		}
+		for _, e := range r.Domain {
+			if s.matchEntry(host, e) {
+				return r, e
+			}
+		}
+	}
+	return nil, "-"
+}
+
+// matchEntry implements the domain syntax of v2ray routing rules:
+// plain strings are substring matches, prefixes select other kinds.
+func (s *simulator) matchEntry(host, entry string) bool {
+	kind, val, ok := strings.Cut(entry, ":")
+	if !ok {
+		return strings.Contains(host, strings.ToLower(entry))
+	}
+
+	// Regexps are compiled as written: lower-casing would turn \S or
+	// [A-Z] into other patterns.
+	switch kind {
+	case "domain":
+		val = strings.ToLower(val)
+		return host == val || strings.HasSuffix(host, "."+val)
+	case "full":
+		return host == strings.ToLower(val)
+	case "keyword":
+		return strings.Contains(host, strings.ToLower(val))
+	case "regexp":
+		re, ok := s.regex[val]
+		if !ok {
+			re, _ = regexp.Compile(val)
+			s.regex[val] = re
+		}
+		return re != nil && re.MatchString(host)
+	case "geosite":
+		return s.geo != nil && s.geo.Covers(strings.ToLower(val), host)
+	case "ext", "ext-domain":
+		// External .dat files are not available to the simulator.
+		return false
+	default:
+		return strings.Contains(host, strings.ToLower(entry))
+	}
+}
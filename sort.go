@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// sortGroups orders the entries of every rule: "source" (or "") keeps
+// input order, "alpha" sorts them, "reverse" sorts by reversed labels so
+// that example.com, api.example.com and cdn.example.com stay together.
+// Selectors and other typed entries go first in either sorted mode.
+func sortGroups(groups []ruleGroup, mode string) {
+	if mode == "" || mode == "source" {
+		return
+	}
+	key := func(s string) string { return s }
+	if mode == "reverse" {
+		key = reversedLabels
+	}
+	for _, g := range groups {
+		slices.SortStableFunc(g.Domains, func(a, b string) int {
+			if sa, sb := isSelector(a), isSelector(b); sa != sb {
+				if sa {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(key(a), key(b))
+		})
+	}
+}
+
+func checkSortMode(mode string) error {
+	switch mode {
+	case "", "source", "alpha", "reverse":
+		return nil
+	}
+	return fmt.Errorf("unknown sort %q (want source, alpha or reverse)", mode)
+}
+
+// isSelector is true for typed entries other than domain: and full:,
+// which name a single host and sort with the plain ones.
+func isSelector(s string) bool {
+	kind, _, ok := strings.Cut(s, ":")
+	return ok && kind != "domain" && kind != "full"
+}
+
+func reversedLabels(s string) string {
+	if kind, host, ok := strings.Cut(s, ":"); ok && (kind == "domain" || kind == "full") {
+		s = host
+	}
+	labels := strings.Split(s, ".")
+	slices.Reverse(labels)
+	return strings.Join(labels, ".")
+}
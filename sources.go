@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+)
+
+type source struct {
+	Path string
+	Data []byte
+}
+
+// sourceStat attributes merged domains to the source that contributed them.
+type sourceStat struct {
+	Path    string
+	Entries int
+	Added   int
+}
+
+// fetchSources reads all paths with at most jobs fetches in flight,
+// keeping the argument order. Globs and directories stand for the files
+// they contain.
+func fetchSources(paths []string, jobs int) ([]source, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	var files []string
+	for _, p := range paths {
+		f, err := fetch.Expand(p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+	paths = files
+
+	out := make([]source, len(paths))
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, jobs)
+
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			out[i].Path = path
+			out[i].Data, errs[i] = fetch.ReadFile(path)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// mergeSources parses every source and merges rules by outbound. A domain
+// already taken by an earlier source is dropped, whatever its outbound.
+func mergeSources(sources []source) ([]ruleGroup, []sourceStat, error) {
+	var groups []ruleGroup
+	index := make(map[string]int) // outbound -> groups index
+	seen := make(map[string]struct{})
+	stats := make([]sourceStat, 0, len(sources))
+
+	for _, src := range sources {
+		parsed, err := parseGroups(src.Path, src.Data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", src.Path, err)
+		}
+
+		// Entries of included lists are counted in rows of their own,
+		// after the list that includes them.
+		st := &sourceStat{Path: src.Path}
+		var included []*sourceStat
+		byChain := make(map[string]*sourceStat)
+		for _, g := range parsed {
+			i, ok := index[g.Outbound]
+			if !ok {
+				i = len(groups)
+				index[g.Outbound] = i
+				groups = append(groups, ruleGroup{Name: g.Name, Outbound: g.Outbound, Attrs: make(map[string][]string), Sections: make(map[string][]string), Notes: make(map[string]string)})
+			}
+			// Sections tag hosts wherever they are listed, duplicates too.
+			for name, ds := range g.Sections {
+				groups[i].Sections[name] = append(groups[i].Sections[name], ds...)
+			}
+			for _, d := range g.Domains {
+				st := st
+				if chain := g.Origins[d]; chain != "" {
+					if st = byChain[chain]; st == nil {
+						st = &sourceStat{Path: chain}
+						byChain[chain] = st
+						included = append(included, st)
+					}
+				}
+				st.Entries++
+				if _, dup := seen[d]; dup {
+					continue
+				}
+				seen[d] = struct{}{}
+				st.Added++
+				groups[i].Domains = append(groups[i].Domains, d)
+				if a := g.Attrs[d]; len(a) > 0 {
+					groups[i].Attrs[d] = a
+				}
+				if n := g.Notes[d]; n != "" {
+					groups[i].Notes[d] = n
+				}
+			}
+		}
+		stats = append(stats, *st)
+		for _, in := range included {
+			stats = append(stats, *in)
+		}
+	}
+
+	return groups, stats, nil
+}
+
+func printSourceStats(w io.Writer, stats []sourceStat) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tENTRIES\tADDED\tDUPLICATES")
+	for _, st := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", st.Path, st.Entries, st.Added, st.Entries-st.Added)
+	}
+	_ = tw.Flush()
+}
+
+func sourceHashes(sources []source) map[string]string {
+	out := make(map[string]string, len(sources))
+	for _, src := range sources {
+		out[src.Path] = hashBytes(src.Data)
+	}
+	return out
+}
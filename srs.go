@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Binary sing-box rule-sets (.srs): "SRS", a version byte, then a zlib
+// stream with the rule count and the rules. Each default rule is a list
+// of typed items up to 0xff and an invert flag; domains and suffixes are
+// stored as a LOUDS-encoded trie of reversed names.
+
+const (
+	srsQueryType = iota
+	srsNetwork
+	srsDomain
+	srsDomainKeyword
+	srsDomainRegex
+	srsSourceIPCIDR
+	srsIPCIDR
+	srsSourcePort
+	srsSourcePortRange
+	srsPort
+	srsPortRange
+	srsProcessName
+	srsProcessPath
+	srsPackageName
+	srsWIFISSID
+	srsWIFIBSSID
+	srsAdGuardDomain
+	srsProcessPathRegex
+	srsNetworkType
+	srsNetworkIsExpensive
+	srsNetworkIsConstrained
+	srsFinal = 0xff
+)
+
+func isSRS(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("SRS"))
+}
+
+func decodeSRS(b []byte) ([]singBoxHeadless, error) {
+	if !isSRS(b) || len(b) < 4 {
+		return nil, errors.New("not a sing-box binary rule-set")
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(b[4:]))
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(zr)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]singBoxHeadless, 0, min(n, 1<<16))
+	for i := uint64(0); i < n; i++ {
+		h, err := readSRSRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("srs rule %d: %w", i, err)
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+func readSRSRule(r *bufio.Reader) (singBoxHeadless, error) {
+	var h singBoxHeadless
+	kind, err := r.ReadByte()
+	if err != nil {
+		return h, err
+	}
+	switch kind {
+	case 0:
+	case 1:
+		// Logical: mode, sub-rules, invert. Read through and mark.
+		h.Type = "logical"
+		if _, err := r.ReadByte(); err != nil {
+			return h, err
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return h, err
+		}
+		for i := uint64(0); i < n; i++ {
+			if _, err := readSRSRule(r); err != nil {
+				return h, err
+			}
+		}
+		_, err = r.ReadByte()
+		return h, err
+	default:
+		return h, fmt.Errorf("unknown rule type %d", kind)
+	}
+
+	other := func(name string) {
+		if h.Other == nil {
+			h.Other = make(map[string]any)
+		}
+		h.Other[name] = true
+	}
+	for {
+		item, err := r.ReadByte()
+		if err != nil {
+			return h, err
+		}
+		switch item {
+		case srsFinal:
+			inv, err := r.ReadByte()
+			h.Invert = inv != 0
+			return h, err
+		case srsDomain:
+			full, suffix, err := readSRSDomains(r)
+			if err != nil {
+				return h, err
+			}
+			h.Domain, h.DomainSuffix = full, suffix
+		case srsDomainKeyword:
+			h.DomainKeyword, err = readSRSStrings(r)
+		case srsDomainRegex:
+			h.DomainRegex, err = readSRSStrings(r)
+		case srsIPCIDR:
+			h.IPCIDR, err = readSRSIPSet(r)
+		case srsProcessName:
+			h.ProcessName, err = readSRSStrings(r)
+		case srsProcessPath:
+			h.ProcessPath, err = readSRSStrings(r)
+		case srsPackageName:
+			h.PackageName, err = readSRSStrings(r)
+		case srsSourceIPCIDR:
+			other("source_ip_cidr")
+			_, err = readSRSIPSet(r)
+		case srsQueryType, srsSourcePort, srsPort:
+			other("port")
+			err = skipSRSSlice(r, 2)
+		case srsNetworkType:
+			other("network_type")
+			err = skipSRSSlice(r, 1)
+		case srsNetwork, srsSourcePortRange, srsPortRange, srsWIFISSID, srsWIFIBSSID, srsProcessPathRegex:
+			other("condition")
+			_, err = readSRSStrings(r)
+		case srsNetworkIsExpensive, srsNetworkIsConstrained:
+			other("network")
+		case srsAdGuardDomain:
+			return h, errors.New("AdGuard domain rules cannot be read back")
+		default:
+			return h, fmt.Errorf("unknown rule item %d", item)
+		}
+		if err != nil {
+			return h, err
+		}
+	}
+}
+
+func readSRSBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > 1<<28 {
+		return nil, errors.New("srs: length too large")
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+func readSRSStrings(r *bufio.Reader) ([]string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, min(n, 1<<16))
+	for i := uint64(0); i < n; i++ {
+		b, err := readSRSBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, string(b))
+	}
+	return out, nil
+}
+
+func skipSRSSlice(r *bufio.Reader, size int) error {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	_, err = r.Discard(int(n) * size)
+	return err
+}
+
+func readSRSUint64s(r *bufio.Reader) ([]uint64, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > 1<<26 {
+		return nil, errors.New("srs: length too large")
+	}
+	out := make([]uint64, n)
+	return out, binary.Read(r, binary.BigEndian, out)
+}
+
+// readSRSIPSet reads address ranges and returns them as CIDRs.
+func readSRSIPSet(r *bufio.Reader) ([]string, error) {
+	if v, err := r.ReadByte(); err != nil {
+		return nil, err
+	} else if v != 1 {
+		return nil, fmt.Errorf("unknown ip set version %d", v)
+	}
+	var n uint64
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	var out []string
+	for i := uint64(0); i < n; i++ {
+		from, err := readSRSBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		to, err := readSRSBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		a, ok1 := netip.AddrFromSlice(from)
+		z, ok2 := netip.AddrFromSlice(to)
+		if !ok1 || !ok2 {
+			return nil, errors.New("bad ip range")
+		}
+		for _, p := range rangePrefixes(a.Unmap(), z.Unmap()) {
+			out = append(out, p.String())
+		}
+	}
+	return out, nil
+}
+
+// rangePrefixes splits the inclusive range a..z into CIDR blocks.
+func rangePrefixes(a, z netip.Addr) []netip.Prefix {
+	var out []netip.Prefix
+	for a.IsValid() && a.Compare(z) <= 0 {
+		bits := a.BitLen()
+		for bits > 0 {
+			p := netip.PrefixFrom(a, bits-1).Masked()
+			if p.Addr() != a || lastAddr(p).Compare(z) > 0 {
+				break
+			}
+			bits--
+		}
+		p := netip.PrefixFrom(a, bits)
+		out = append(out, p)
+		last := lastAddr(p)
+		if last.Compare(z) >= 0 {
+			break
+		}
+		a = last.Next()
+	}
+	return out
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+// Marker labels of reversed keys in the domain trie.
+const (
+	srsPrefixLabel = '\r' // ".x": subdomains of x only
+	srsRootLabel   = '\n' // x and its subdomains
+)
+
+// readSRSDomains decodes the domain trie into exact names and suffixes.
+// Nodes are numbered breadth-first; the label bitmap holds, node after
+// node, a 0 bit per child label and a closing 1 bit.
+func readSRSDomains(r *bufio.Reader) (full, suffix []string, err error) {
+	if _, err = r.ReadByte(); err != nil { // reserved
+		return
+	}
+	leaves, err := readSRSUint64s(r)
+	if err != nil {
+		return
+	}
+	bitmap, err := readSRSUint64s(r)
+	if err != nil {
+		return
+	}
+	labels, err := readSRSBytes(r)
+	if err != nil {
+		return
+	}
+
+	keys := [][]byte{nil} // node -> reversed key
+	node, label := 0, 0
+	for i := 0; i < len(bitmap)*64 && node < len(keys); i++ {
+		if bitmap[i/64]&(1<<(i%64)) != 0 {
+			node++
+			continue
+		}
+		if label >= len(labels) {
+			return nil, nil, errors.New("srs: corrupt domain trie")
+		}
+		keys = append(keys, append(append([]byte(nil), keys[node]...), labels[label]))
+		label++
+	}
+
+	exact := make(map[string]bool)
+	sub := make(map[string]bool)
+	for id, k := range keys {
+		if id/64 >= len(leaves) || leaves[id/64]&(1<<(id%64)) == 0 || len(k) == 0 {
+			continue
+		}
+		rev := slices.Clone(k)
+		slices.Reverse(rev)
+		key := string(rev)
+		switch key[0] {
+		case srsPrefixLabel:
+			sub[strings.TrimPrefix(key[1:], ".")] = true
+		case srsRootLabel:
+			suffix = append(suffix, key[1:])
+		default:
+			exact[key] = true
+		}
+	}
+	for d := range sub {
+		delete(exact, d)
+		suffix = append(suffix, d)
+	}
+	for d := range exact {
+		full = append(full, d)
+	}
+	sort.Strings(full)
+	sort.Strings(suffix)
+	return full, suffix, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/devemio/v2raytun-routing/fetch"
+)
+
+// staleSource is a URL source whose data comes from a cached copy older
+// than the threshold, because the upstream kept failing.
+type staleSource struct {
+	Path    string    `json:"source"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// staleSources lists the URL sources last fetched successfully more than
+// after ago, warning about each. Zero after disables the check.
+func staleSources(sources []source, after time.Duration, now time.Time) []staleSource {
+	if after <= 0 {
+		return nil
+	}
+	var out []staleSource
+	for _, s := range sources {
+		if !fetch.IsRemote(s.Path) {
+			continue
+		}
+		t, ok := fetch.Default.LastFetch(s.Path)
+		if !ok || now.Sub(t) <= after {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s: not updated since %s, older than %s\n", s.Path, t.Local().Format(time.DateTime), after)
+		out = append(out, staleSource{Path: s.Path, Fetched: t})
+	}
+	return out
+}
+
+// alertStale reports stale sources to the profile's webhook and Telegram
+// chat. alerted remembers the fetch time already reported per source, so
+// each outage is sent once; a source that recovers and goes stale again
+// has a newer fetch time and is reported anew.
+func alertStale(p Profile, stale []staleSource, alerted map[string]time.Time) error {
+	var fresh []staleSource
+	for _, s := range stale {
+		key := p.Name + "\x00" + s.Path
+		if alerted[key].Equal(s.Fetched) {
+			continue
+		}
+		alerted[key] = s.Fetched
+		fresh = append(fresh, s)
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	var errs []error
+	if p.Webhook != "" {
+		body, err := json.Marshal(map[string]any{
+			"profile": p.Name,
+			"event":   "stale",
+			"stale":   fresh,
+		})
+		if err == nil {
+			err = post(p.Webhook, "application/json", body)
+		}
+		errs = append(errs, err)
+	}
+	if p.Telegram != nil {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Route %s is built from stale sources:\n", p.Name)
+		for _, s := range fresh {
+			fmt.Fprintf(&sb, "%s: not updated since %s\n", s.Path, s.Fetched.Local().Format(time.DateTime))
+		}
+		form := url.Values{"chat_id": {p.Telegram.Chat}, "text": {sb.String()}}
+		errs = append(errs, post("https://api.telegram.org/bot"+p.Telegram.Token+"/sendMessage",
+			"application/x-www-form-urlencoded", []byte(form.Encode())))
+	}
+	if err := errors.Join(errs...); err != nil {
+		// Sent again with the next build.
+		for _, s := range fresh {
+			delete(alerted, p.Name+"\x00"+s.Path)
+		}
+		return err
+	}
+	return nil
+}
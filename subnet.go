@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Subnet routes the clients of a LAN segment differently with the same
+// lists: every rule whose outbound is remapped is repeated for the
+// subnet's source addresses, ahead of the shared rules.
+type Subnet struct {
+	Name      string            `yaml:"name"`
+	Source    []string          `yaml:"source"`    // client addresses or CIDRs
+	Outbounds map[string]string `yaml:"outbounds"` // rule outbound -> outbound for these clients
+}
+
+func (s Subnet) check() error {
+	if s.Name == "" {
+		return fmt.Errorf("subnet has no name")
+	}
+	if len(s.Source) == 0 {
+		return fmt.Errorf("subnet %s has no source", s.Name)
+	}
+	for _, src := range s.Source {
+		if !isIP(src) {
+			return fmt.Errorf("subnet %s: %q is not an address or CIDR", s.Name, src)
+		}
+	}
+	if len(s.Outbounds) == 0 {
+		return fmt.Errorf("subnet %s has no outbounds", s.Name)
+	}
+	return nil
+}
+
+// subnetFlag is the repeatable -subnet flag: "name cidr[,cidr] from=to[,from=to]".
+type subnetFlag []Subnet
+
+func (f *subnetFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	var parts []string
+	for _, s := range *f {
+		parts = append(parts, s.Name)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *subnetFlag) Set(v string) error {
+	fields := strings.Fields(v)
+	if len(fields) != 3 {
+		return fmt.Errorf("want \"name cidr[,cidr] from=to[,from=to]\", got %q", v)
+	}
+	s := Subnet{Name: fields[0], Source: strings.Split(fields[1], ","), Outbounds: make(map[string]string)}
+	for _, kv := range strings.Split(fields[2], ",") {
+		from, to, ok := strings.Cut(kv, "=")
+		if !ok || from == "" || to == "" {
+			return fmt.Errorf("subnet %s: want from=to, got %q", s.Name, kv)
+		}
+		s.Outbounds[from] = to
+	}
+	if err := s.check(); err != nil {
+		return err
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+// withSubnets puts the subnet rules first, in subnet then rule order, so
+// they win over the shared rules for their clients only.
+func withSubnets(route Route, subnets []Subnet) Route {
+	var rules []Rule
+	for _, s := range subnets {
+		used := false
+		for _, r := range route.Rules {
+			to, ok := s.Outbounds[r.OutboundTag]
+			if !ok || len(r.Source) > 0 {
+				continue
+			}
+			used = true
+			r.ID = uuid.NewString()
+			r.Name = s.Name + ": " + ruleLabel(r)
+			r.OutboundTag = to
+			r.Source = s.Source
+			rules = append(rules, r)
+		}
+		if !used {
+			fmt.Fprintf(os.Stderr, "warning: subnet %s: no rule has a remapped outbound\n", s.Name)
+		}
+	}
+	route.Rules = append(rules, route.Rules...)
+	return route
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Variant is a time window in which a profile is built differently, e.g.
+// stricter blocking during work hours. The first active variant applies.
+type Variant struct {
+	Name    string   `yaml:"name"`
+	Days    []string `yaml:"days"`    // mon..sun or ranges like mon-fri, every day if empty
+	Hours   string   `yaml:"hours"`   // "09:00-18:00", may cross midnight; all day if empty
+	Sources []string `yaml:"sources"` // read before the profile sources, so they win
+	Exclude []string `yaml:"exclude"` // added to the profile exclusions
+	Route   string   `yaml:"route"`   // route name while active
+
+	days     uint8 // weekday bits
+	from, to int   // minutes since midnight
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func (v *Variant) parse() error {
+	if v.Name == "" {
+		return fmt.Errorf("variant has no name")
+	}
+	v.days = 0
+	for _, d := range v.Days {
+		a, b, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(d)), "-")
+		lo, hi := slices.Index(weekdays, a), slices.Index(weekdays, b)
+		if !isRange {
+			hi = lo
+		}
+		if lo < 0 || hi < 0 {
+			return fmt.Errorf("variant %s: invalid day %q (want mon..sun or mon-fri)", v.Name, d)
+		}
+		for i := lo; ; i = (i + 1) % 7 {
+			v.days |= 1 << i
+			if i == hi {
+				break
+			}
+		}
+	}
+	if v.days == 0 {
+		v.days = 1<<7 - 1
+	}
+
+	v.from, v.to = 0, 24*60
+	if v.Hours == "" {
+		return nil
+	}
+	a, b, ok := strings.Cut(v.Hours, "-")
+	from, err1 := time.Parse("15:04", strings.TrimSpace(a))
+	to, err2 := time.Parse("15:04", strings.TrimSpace(b))
+	if !ok || err1 != nil || err2 != nil || from.Equal(to) {
+		return fmt.Errorf("variant %s: invalid hours %q (want 09:00-18:00)", v.Name, v.Hours)
+	}
+	v.from, v.to = from.Hour()*60+from.Minute(), to.Hour()*60+to.Minute()
+	return nil
+}
+
+// active reports whether t is in the window. A window crossing midnight
+// belongs to the day it starts on.
+func (v Variant) active(t time.Time) bool {
+	m, day := t.Hour()*60+t.Minute(), int(t.Weekday())
+	switch {
+	case v.from < v.to:
+		if m < v.from || m >= v.to {
+			return false
+		}
+	case m >= v.from:
+	case m < v.to:
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return v.days&(1<<day) != 0
+}
+
+// activeVariant returns the variant of p active at t, or nil.
+func (p Profile) activeVariant(t time.Time) *Variant {
+	for i := range p.Variants {
+		if p.Variants[i].active(t) {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// at returns the profile as built at t, with the active variant applied.
+func (p Profile) at(t time.Time) (Profile, string) {
+	v := p.activeVariant(t)
+	if v == nil {
+		return p, ""
+	}
+	p.Sources = append(slices.Clone(v.Sources), p.Sources...)
+	p.Exclude = append(slices.Clone(p.Exclude), v.Exclude...)
+	if v.Route != "" {
+		p.Route = v.Route
+	}
+	return p, v.Name
+}
+
+// nextSwitch returns the first minute after now at which some profile
+// changes its variant, or the zero time if none ever does.
+func nextSwitch(profiles []Profile, now time.Time) time.Time {
+	cur := make([]*Variant, len(profiles))
+	for i, p := range profiles {
+		cur[i] = p.activeVariant(now)
+	}
+	t := now.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(0, 0, 8); t.Before(limit); t = t.Add(time.Minute) {
+		for i, p := range profiles {
+			if p.activeVariant(t) != cur[i] {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}